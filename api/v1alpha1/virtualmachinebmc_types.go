@@ -17,7 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -29,18 +31,120 @@ type VirtualMachineBMCSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 
 	// To authenticate who the user is.
+	// Deprecated: use CredentialsSecretRef instead.
 	// +optional
 	Username string `json:"username,omitempty"`
 
 	// The credential part of the IPMI service
+	// Deprecated: use CredentialsSecretRef instead.
 	// +optional
 	Password string `json:"password,omitempty"`
 
+	// CredentialsSecretRef refers to a Secret in the same namespace as the
+	// VirtualMachineBMC. The Secret must contain the "username" and
+	// "password" keys, which are accepted by both the IPMI and the Redfish
+	// services. It takes precedence over Username and Password. When no
+	// credentials are configured, the defaulting webhook refers to the
+	// "<name>-credentials" Secret, which the controller generates with a
+	// random password.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
 	// The namespace where the virtual machine is in
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="vmNamespace is immutable"
 	VirtualMachineNamespace string `json:"vmNamespace"`
 
 	// The actual virtual machine that this BMC controls
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="vmName is immutable"
 	VirtualMachineName string `json:"vmName"`
+
+	// The UID of the virtual machine that this BMC controls. When set, the BMC
+	// refuses to serve a virtual machine that has been recreated under the
+	// same name. It is recorded automatically once the virtual machine is
+	// found.
+	// +kubebuilder:validation:XValidation:rule="oldSelf == '' || self == oldSelf",message="vmUID is immutable once set"
+	// +optional
+	VirtualMachineUID types.UID `json:"vmUID,omitempty"`
+
+	// PodTemplate customizes the Pod running the virtBMC agent. The fields
+	// set here take precedence over the cluster-wide defaults configured on
+	// the controller.
+	// +optional
+	PodTemplate *PodTemplate `json:"podTemplate,omitempty"`
+
+	// Service customizes how the IPMI and Redfish services are exposed
+	// +optional
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// EnableVNC exposes the graphical console of the virtual machine through
+	// a VNC port of the Service. VNC clients authenticate with the
+	// "vncPassword" key of the Secret referred to by CredentialsSecretRef,
+	// never with the password of the BMC. The generated Secrets hold one;
+	// with inline credentials the VNC console refuses every client.
+	// +optional
+	EnableVNC bool `json:"enableVNC,omitempty"`
+}
+
+// PodTemplate holds the scheduling, resource and security settings of the Pod running the virtBMC agent
+type PodTemplate struct {
+	// Compute resources of the virtBMC container
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Node labels the Pod must be scheduled onto
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the Pod
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Scheduling constraints of the Pod
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// Priority class of the Pod
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Secrets for pulling the virtBMC image
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Pod-level security attributes
+	// +optional
+	SecurityContext *corev1.PodSecurityContext `json:"securityContext,omitempty"`
+
+	// Security attributes of the virtBMC container
+	// +optional
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+}
+
+// ServiceSpec holds the settings of the Service exposing the virtBMC agent
+type ServiceSpec struct {
+	// Type of the Service, defaults to ClusterIP
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Annotations added to the Service, e.g., to configure the load balancer
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// The IP address requested from the load balancer, if supported by the provider
+	// +optional
+	LoadBalancerIP string `json:"loadBalancerIP,omitempty"`
+
+	// The class of the load balancer implementation the Service belongs to
+	// +optional
+	LoadBalancerClass *string `json:"loadBalancerClass,omitempty"`
+
+	// How the external traffic is routed to the virtBMC Pod
+	// +kubebuilder:validation:Enum=Cluster;Local
+	// +optional
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicy `json:"externalTrafficPolicy,omitempty"`
 }
 
 // VirtualMachineBMCStatus defines the observed state of VirtualMachineBMC
@@ -51,14 +155,56 @@ type VirtualMachineBMCStatus struct {
 	// The listen IP address for the IPMI service.
 	ServiceIP string `json:"serviceIP"`
 
-	// The indicator that shows the readiness of the IPMI service for the virtual machine
+	// The address exposed by the load balancer, either an IP address or a hostname
+	// +optional
+	ExternalAddress string `json:"externalAddress,omitempty"`
+
+	// The node ports allocated to the IPMI and Redfish services, keyed by port name
+	// +optional
+	NodePorts map[string]int32 `json:"nodePorts,omitempty"`
+
+	// The indicator that shows the readiness of the IPMI service for the virtual machine.
+	// It mirrors the status of the Ready condition.
 	Ready bool `json:"ready"`
+
+	// The generation of the VirtualMachineBMC most recently observed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// The latest available observations of the VirtualMachineBMC's current state
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// Condition types of VirtualMachineBMC
+const (
+	// ConditionReady indicates that the BMC is able to serve IPMI and Redfish requests for the virtual machine, i.e.,
+	// all of AgentPodReady, ServiceReady, VirtualMachineFound and CredentialsValid are true.
+	ConditionReady = "Ready"
+	// ConditionAgentPodReady indicates that the virtBMC Pod is running and ready
+	ConditionAgentPodReady = "AgentPodReady"
+	// ConditionServiceReady indicates that the virtBMC Service has an address allocated
+	ConditionServiceReady = "ServiceReady"
+	// ConditionVirtualMachineFound indicates that the target virtual machine exists and is served by this
+	// VirtualMachineBMC rather than by an older one
+	ConditionVirtualMachineFound = "VirtualMachineFound"
+	// ConditionCredentialsValid indicates that the configured credentials can be handed over to the virtBMC Pod
+	ConditionCredentialsValid = "CredentialsValid"
+	// ConditionDegraded indicates that the BMC is in a state that requires intervention to recover
+	ConditionDegraded = "Degraded"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="VM Namespace",type=string,JSONPath=`.spec.vmNamespace`
+//+kubebuilder:printcolumn:name="VM Name",type=string,JSONPath=`.spec.vmName`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
-// VirtualMachineBMC is the Schema for the virtualmachinebmcs API
+// VirtualMachineBMC is the Schema for the virtualmachinebmcs API. VirtualMachineBMCs are only admitted in the
+// kubevirtbmc-system namespace, where the controller runs the agents and reads the credentials Secrets.
 type VirtualMachineBMC struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -26,10 +26,15 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -71,6 +76,10 @@ func main() {
 		tlsOpts              []func(*tls.Config)
 		agentImageName       string
 		agentImageTag        string
+		agentWorkloadKind    string
+		agentPodTemplateFile string
+		vmSelectionMode      string
+		vmNamespaceSelector  string
 	)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8443", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -79,6 +88,10 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager.")
 	flag.StringVar(&agentImageName, "agent-image-name", ctlvirtualmachinebmc.VirtBMCImageName, "The name of the agent image.")
 	flag.StringVar(&agentImageTag, "agent-image-tag", AppVersion, "The tag of the agent image.")
+	flag.StringVar(&agentWorkloadKind, "agent-workload-kind", ctlvirtualmachinebmc.WorkloadKindDeployment, "The kind of workload running the agent, either Deployment or StatefulSet.")
+	flag.StringVar(&agentPodTemplateFile, "agent-pod-template-file", "", "The file holding the cluster-wide defaults of the agent Pod template, e.g., scheduling, resources and security context.")
+	flag.StringVar(&vmSelectionMode, "vm-selection-mode", ctlvirtualmachine.ModeAll, "Which VirtualMachines get a VirtualMachineBMC automatically: all (unless opted out), opt-in, or disabled.")
+	flag.StringVar(&vmNamespaceSelector, "vm-namespace-selector", "", "The label selector of the namespaces whose VirtualMachines get a VirtualMachineBMC automatically. Empty means all namespaces.")
 	showVersion := flag.Bool("version", false, "Show version.")
 
 	opts := zap.Options{
@@ -95,6 +108,32 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if agentWorkloadKind != ctlvirtualmachinebmc.WorkloadKindDeployment && agentWorkloadKind != ctlvirtualmachinebmc.WorkloadKindStatefulSet {
+		setupLog.Error(fmt.Errorf("unsupported agent workload kind %q", agentWorkloadKind), "invalid flag")
+		os.Exit(1)
+	}
+
+	switch vmSelectionMode {
+	case ctlvirtualmachine.ModeAll, ctlvirtualmachine.ModeOptIn, ctlvirtualmachine.ModeDisabled:
+	default:
+		setupLog.Error(fmt.Errorf("unsupported vm selection mode %q", vmSelectionMode), "invalid flag")
+		os.Exit(1)
+	}
+
+	namespaceSelector, err := labels.Parse(vmNamespaceSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid namespace selector")
+		os.Exit(1)
+	}
+
+	var agentPodTemplate *virtualmachinev1.PodTemplate
+	if agentPodTemplateFile != "" {
+		if agentPodTemplate, err = ctlvirtualmachinebmc.LoadPodTemplate(agentPodTemplateFile); err != nil {
+			setupLog.Error(err, "unable to load agent pod template")
+			os.Exit(1)
+		}
+	}
+
 	// Disable HTTP/2 unless explicitly enabled
 	disableHTTP2 := func(c *tls.Config) {
 		setupLog.Info("disabling http/2")
@@ -121,6 +160,12 @@ func main() {
 		metricsServerOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
 	}
 
+	// The objects making up the BMCs only live in the namespace of the VirtualMachineBMCs, which is also the only one
+	// the manager is allowed to access them in
+	virtualMachineBMCNamespace := cache.ByObject{
+		Namespaces: map[string]cache.Config{ctlvirtualmachinebmc.VirtualMachineBMCNamespace: {}},
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
@@ -128,6 +173,19 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "5e66b2cf.kubevirt.io",
+		// The lease lives next to the agents, where the leader election Role grants access, rather than in the
+		// namespace of the controller manager
+		LeaderElectionNamespace: ctlvirtualmachinebmc.VirtualMachineBMCNamespace,
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Pod{}:         virtualMachineBMCNamespace,
+				&corev1.Service{}:     virtualMachineBMCNamespace,
+				&corev1.Secret{}:      virtualMachineBMCNamespace,
+				&corev1.ConfigMap{}:   virtualMachineBMCNamespace,
+				&appsv1.Deployment{}:  virtualMachineBMCNamespace,
+				&appsv1.StatefulSet{}: virtualMachineBMCNamespace,
+			},
+		},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -146,10 +204,12 @@ func main() {
 	}
 
 	if err = (&ctlvirtualmachinebmc.VirtualMachineBMCReconciler{
-		Client:         mgr.GetClient(),
-		Scheme:         mgr.GetScheme(),
-		AgentImageName: agentImageName,
-		AgentImageTag:  agentImageTag,
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		AgentImageName:     agentImageName,
+		AgentImageTag:      agentImageTag,
+		AgentWorkloadKind:  agentWorkloadKind,
+		DefaultPodTemplate: agentPodTemplate,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VirtualMachineBMC")
 		os.Exit(1)
@@ -162,8 +222,11 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&ctlvirtualmachine.VirtualMachineReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		Recorder:          mgr.GetEventRecorderFor("virtualmachine-controller"),
+		Mode:              vmSelectionMode,
+		NamespaceSelector: namespaceSelector,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VirtualMachine")
 		os.Exit(1)
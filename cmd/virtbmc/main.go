@@ -17,7 +17,9 @@ var (
 )
 
 func main() {
-	var options virtbmc.Options
+	options := virtbmc.Options{
+		Version: AppVersion,
+	}
 
 	app := &cli.App{
 		Name:  "virtbmc",
@@ -43,12 +45,47 @@ func main() {
 				Usage:       "listen on `IPMI PORT`",
 				Destination: &options.IPMIPort,
 			},
+			&cli.IntFlag{
+				Name:        "sol-port",
+				Value:       0,
+				Usage:       "report `SOL PORT` as the port the remote consoles reach the IPMI port at, the IPMI port if 0",
+				Destination: &options.SOLPort,
+			},
+			&cli.StringFlag{
+				Name:        "sol-port-file",
+				Usage:       "read the SOL port from `FILE` whenever it is reported, falling back to --sol-port if it can't be read",
+				Destination: &options.SOLPortFile,
+			},
 			&cli.IntFlag{
 				Name:        "redfish-port",
 				Value:       10080,
 				Usage:       "listen on `REDFISH PORT`",
 				Destination: &options.RedfishPort,
 			},
+			&cli.IntFlag{
+				Name:        "vnc-port",
+				Value:       0,
+				Usage:       "listen on `VNC PORT`, disabled if 0",
+				Destination: &options.VNCPort,
+			},
+			&cli.StringFlag{
+				Name:        "credentials-dir",
+				Usage:       "read the username and password from files under `DIR`",
+				EnvVars:     []string{"VIRTBMC_CREDENTIALS_DIR"},
+				Destination: &options.CredentialsDir,
+			},
+			&cli.StringFlag{
+				Name:        "username",
+				Usage:       "accept `USERNAME`, required when --credentials-dir is not set",
+				EnvVars:     []string{"VIRTBMC_USERNAME"},
+				Destination: &options.Username,
+			},
+			&cli.StringFlag{
+				Name:        "password",
+				Usage:       "accept `PASSWORD`, required when --credentials-dir is not set",
+				EnvVars:     []string{"VIRTBMC_PASSWORD"},
+				Destination: &options.Password,
+			},
 			&cli.BoolFlag{
 				Name:    "version",
 				Aliases: []string{"v"},
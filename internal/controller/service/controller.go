@@ -19,6 +19,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -39,7 +40,7 @@ type ServiceReconciler struct {
 	Scheme *runtime.Scheme
 }
 
-//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch,namespace=kubevirtbmc-system
 //+kubebuilder:rbac:groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs,verbs=get;list;watch
 //+kubebuilder:rbac:groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs/status,verbs=get;update;patch
 
@@ -77,8 +78,17 @@ func (s *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	if svc.Spec.ClusterIP == "" {
 		return ctrl.Result{RequeueAfter: time.Second * 10}, fmt.Errorf("clusterIP is not ready yet")
 	}
-	virtualMachineBMC.Status.Ready = true
+	// Readiness is determined by the VirtualMachineBMC controller based on all the components
+	externalAddress := getExternalAddress(&svc)
+	nodePorts := getNodePorts(&svc)
+	if virtualMachineBMC.Status.ServiceIP == svc.Spec.ClusterIP &&
+		virtualMachineBMC.Status.ExternalAddress == externalAddress &&
+		reflect.DeepEqual(virtualMachineBMC.Status.NodePorts, nodePorts) {
+		return ctrl.Result{}, nil
+	}
 	virtualMachineBMC.Status.ServiceIP = svc.Spec.ClusterIP
+	virtualMachineBMC.Status.ExternalAddress = externalAddress
+	virtualMachineBMC.Status.NodePorts = nodePorts
 	if err := s.Status().Update(ctx, &virtualMachineBMC); err != nil {
 		log.Error(err, "unable to update VirtualMachineBMC status")
 		return ctrl.Result{}, err
@@ -89,6 +99,40 @@ func (s *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	return ctrl.Result{}, nil
 }
 
+// getExternalAddress returns the first address assigned by the load balancer, if any
+func getExternalAddress(svc *corev1.Service) string {
+	if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return ""
+	}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			return ingress.IP
+		}
+		if ingress.Hostname != "" {
+			return ingress.Hostname
+		}
+	}
+	return ""
+}
+
+// getNodePorts returns the node ports allocated to the Service keyed by port name
+func getNodePorts(svc *corev1.Service) map[string]int32 {
+	if svc.Spec.Type != corev1.ServiceTypeNodePort && svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return nil
+	}
+	var nodePorts map[string]int32
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort == 0 {
+			continue
+		}
+		if nodePorts == nil {
+			nodePorts = map[string]int32{}
+		}
+		nodePorts[port.Name] = port.NodePort
+	}
+	return nodePorts
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (s *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -25,6 +25,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
 	ctlvirtualmachinebmc "kubevirt.io/kubevirtbmc/internal/controller/virtualmachinebmc"
@@ -39,6 +40,7 @@ var _ = Describe("Service Controller", func() {
 		testVMName                     = "test-vm"
 		testVMNamespace                = "default"
 		testClusterIP                  = "10.0.0.100"
+		testExternalIP                 = "192.0.2.10"
 
 		timeout  = time.Second * 10
 		duration = time.Second * 10
@@ -110,4 +112,64 @@ var _ = Describe("Service Controller", func() {
 			}, timeout, interval).Should(BeTrue())
 		})
 	})
+
+	Context("When the Service is exposed through a load balancer", func() {
+		It("Should report the external address and the node ports", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachineBMC")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-lb",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName + "-lb",
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Creating a new LoadBalancer Service")
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						ctlvirtualmachinebmc.VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
+					},
+					Name:      virtualMachineBMC.Name,
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeLoadBalancer,
+					Ports: []corev1.ServicePort{
+						{
+							Name:     "ipmi",
+							Protocol: corev1.ProtocolUDP,
+							Port:     ctlvirtualmachinebmc.IPMISvcPort,
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, svc)).To(Succeed())
+
+			By("Assigning an address to the load balancer")
+			svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: testExternalIP}}
+			Expect(k8sClient.Status().Update(ctx, svc)).To(Succeed())
+
+			By("Checking that the VirtualMachineBMC has the external address reflected")
+			virtualMachineBMCLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name, Namespace: virtualMachineBMC.Namespace}
+			updatedVirtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{}
+
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, virtualMachineBMCLookupKey, updatedVirtualMachineBMC)).To(Succeed())
+				g.Expect(updatedVirtualMachineBMC.Status.ExternalAddress).To(Equal(testExternalIP))
+				g.Expect(updatedVirtualMachineBMC.Status.NodePorts).To(HaveKeyWithValue("ipmi", svc.Spec.Ports[0].NodePort))
+			}, timeout, interval).Should(Succeed())
+		})
+	})
 })
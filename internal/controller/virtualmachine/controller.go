@@ -19,64 +19,260 @@ package virtualmachine
 import (
 	"context"
 	"fmt"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
 	ctlvirtualmachinebmc "kubevirt.io/kubevirtbmc/internal/controller/virtualmachinebmc"
 )
 
 const (
-	finalizerName = "kubevirtbmc-virtualmachine-controller"
+	// legacyFinalizerName was added to every VirtualMachine by earlier versions. It is removed from the VirtualMachines
+	// so that their deletion is no longer blocked by the controller.
+	legacyFinalizerName = "kubevirtbmc-virtualmachine-controller"
+
+	// retryInterval is how long to wait for a replaced VirtualMachineBMC to be gone
+	retryInterval = 2 * time.Second
+
+	// EnabledLabel opts a VirtualMachine in ("true") or out ("false") of getting a VirtualMachineBMC automatically. It
+	// is honored as an annotation as well, the label takes precedence.
+	EnabledLabel = "kubevirt.io/virtualmachinebmc-enabled"
+
+	// AutoCreatedLabel marks the VirtualMachineBMCs created by the controller. Only those are removed when their
+	// VirtualMachine is no longer selected, the ones created by hand are left alone.
+	AutoCreatedLabel = ctlvirtualmachinebmc.AutoCreatedLabel
+
+	// ModeAll creates a VirtualMachineBMC for every selected VirtualMachine unless it opts out
+	ModeAll = "all"
+	// ModeOptIn creates a VirtualMachineBMC only for the selected VirtualMachines that opt in
+	ModeOptIn = "opt-in"
+	// ModeDisabled never creates a VirtualMachineBMC automatically
+	ModeDisabled = "disabled"
+
+	// reasonNameConflict is the reason of the event recorded when the name of the VirtualMachineBMC is taken by the
+	// one of another VirtualMachine
+	reasonNameConflict = "VirtualMachineBMCNameConflict"
 )
 
 // VirtualMachineReconciler reconciles a VirtualMachine object
 type VirtualMachineReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Mode is one of ModeAll (default), ModeOptIn and ModeDisabled
+	Mode string
+	// NamespaceSelector restricts the VirtualMachines getting a VirtualMachineBMC to the matching namespaces. A nil
+	// selector matches every namespace.
+	NamespaceSelector labels.Selector
 }
 
-func (v *VirtualMachineReconciler) handleFinalizer(ctx context.Context, vm *kubevirtv1.VirtualMachine) error {
-	log := log.FromContext(ctx)
-	if vm.ObjectMeta.DeletionTimestamp.IsZero() {
-		// add finalizer
-		if !controllerutil.ContainsFinalizer(vm, finalizerName) {
-			ok := controllerutil.AddFinalizer(vm, finalizerName)
-			log.V(1).Info(fmt.Sprintf("add finalizer %s : %t", finalizerName, ok))
-			return v.Update(ctx, vm)
+// isSelected tells whether the VirtualMachine should get a VirtualMachineBMC automatically
+func (v *VirtualMachineReconciler) isSelected(ctx context.Context, vm *kubevirtv1.VirtualMachine) (bool, error) {
+	if v.Mode == ModeDisabled {
+		return false, nil
+	}
+
+	enabled, ok := vm.Labels[EnabledLabel]
+	if !ok {
+		enabled, ok = vm.Annotations[EnabledLabel]
+	}
+	if ok && enabled != "true" {
+		return false, nil
+	}
+	if !ok && v.Mode == ModeOptIn {
+		return false, nil
+	}
+
+	if v.NamespaceSelector == nil || v.NamespaceSelector.Empty() {
+		return true, nil
+	}
+	var ns corev1.Namespace
+	if err := v.Get(ctx, types.NamespacedName{Name: vm.Namespace}, &ns); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return v.NamespaceSelector.Matches(labels.Set(ns.Labels)), nil
+}
+
+// getVirtualMachineBMC returns the VirtualMachineBMC created for the VirtualMachine, or nil if there is none. The
+// VirtualMachineBMCs named by earlier versions are looked up as well so that they keep serving their VirtualMachines.
+// VirtualMachineBMCs targeting other VirtualMachines are never returned.
+func (v *VirtualMachineReconciler) getVirtualMachineBMC(ctx context.Context, vm *kubevirtv1.VirtualMachine) (*virtualmachinev1.VirtualMachineBMC, error) {
+	names := []string{
+		ctlvirtualmachinebmc.VirtualMachineBMCName(vm.Namespace, vm.Name),
+		ctlvirtualmachinebmc.LegacyVirtualMachineBMCName(vm.Namespace, vm.Name),
+	}
+	for _, name := range names {
+		var virtualMachineBMC virtualmachinev1.VirtualMachineBMC
+		if err := v.Get(ctx, types.NamespacedName{
+			Namespace: ctlvirtualmachinebmc.VirtualMachineBMCNamespace,
+			Name:      name,
+		}, &virtualMachineBMC); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
 		}
-	} else {
-		// remove finalizer
-		if controllerutil.ContainsFinalizer(vm, finalizerName) {
-			ok := controllerutil.RemoveFinalizer(vm, finalizerName)
-			log.V(1).Info(fmt.Sprintf("remove finalizer %s : %t", finalizerName, ok))
-			return v.Update(ctx, vm)
+		if virtualMachineBMC.Spec.VirtualMachineNamespace == vm.Namespace && virtualMachineBMC.Spec.VirtualMachineName == vm.Name {
+			return &virtualMachineBMC, nil
 		}
 	}
+	return nil, nil
+}
+
+// deleteVirtualMachineBMC removes the VirtualMachineBMC created for the VirtualMachine by the controller, if any
+func (v *VirtualMachineReconciler) deleteVirtualMachineBMC(ctx context.Context, vm *kubevirtv1.VirtualMachine) error {
+	virtualMachineBMC, err := v.getVirtualMachineBMC(ctx, vm)
+	if err != nil || virtualMachineBMC == nil {
+		return err
+	}
+	if virtualMachineBMC.Labels[AutoCreatedLabel] != "true" {
+		return nil
+	}
+	if err := v.Delete(ctx, virtualMachineBMC); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	log.FromContext(ctx).V(1).Info("removed VirtualMachineBMC for VirtualMachine", "virtualMachineBMC", virtualMachineBMC.Name)
 	return nil
 }
 
-func (v *VirtualMachineReconciler) constructVirtualMachineBMCFromVirtualMachine(vm *kubevirtv1.VirtualMachine) *virtualmachinev1.VirtualMachineBMC {
-	name := fmt.Sprintf("%s-%s", vm.Namespace, vm.Name)
+// removeLegacyFinalizer strips the finalizer added by earlier versions from the VirtualMachine
+func (v *VirtualMachineReconciler) removeLegacyFinalizer(ctx context.Context, vm *kubevirtv1.VirtualMachine) error {
+	if !controllerutil.RemoveFinalizer(vm, legacyFinalizerName) {
+		return nil
+	}
+	log.FromContext(ctx).V(1).Info(fmt.Sprintf("remove legacy finalizer %s", legacyFinalizerName))
+	return v.Update(ctx, vm)
+}
+
+// ensureVirtualMachineBMC creates the VirtualMachineBMC for the VirtualMachine. An existing VirtualMachineBMC gets the
+// UID of the VirtualMachine recorded if it lacks one and the well-known default password removed, and is replaced if it
+// has been created for a former VirtualMachine of the same name. The credentials are generated by the
+// VirtualMachineBMC controller. It tells whether the reconciliation has to be retried because a replaced
+// VirtualMachineBMC is still being deleted.
+func (v *VirtualMachineReconciler) ensureVirtualMachineBMC(ctx context.Context, vm *kubevirtv1.VirtualMachine) (bool, error) {
+	log := log.FromContext(ctx)
 
+	virtualMachineBMC, err := v.getVirtualMachineBMC(ctx, vm)
+	if err != nil {
+		return false, err
+	}
+
+	if virtualMachineBMC != nil {
+		if !virtualMachineBMC.DeletionTimestamp.IsZero() {
+			return true, nil
+		}
+		if uid := virtualMachineBMC.Spec.VirtualMachineUID; uid != "" && uid != vm.UID {
+			bmcUID := virtualMachineBMC.UID
+			if err := v.Delete(ctx, virtualMachineBMC, client.Preconditions{UID: &bmcUID}); client.IgnoreNotFound(err) != nil {
+				return false, err
+			}
+			log.V(1).Info("removed stale VirtualMachineBMC for recreated VirtualMachine", "virtualMachineBMC", virtualMachineBMC.Name)
+			return true, nil
+		}
+
+		update := false
+		if virtualMachineBMC.Spec.VirtualMachineUID == "" {
+			virtualMachineBMC.Spec.VirtualMachineUID = vm.UID
+			update = true
+		}
+		// Earlier versions created the VirtualMachineBMCs under the legacy name without labeling them. Labeling them
+		// lets them be removed once their VirtualMachine is no longer selected.
+		if virtualMachineBMC.Name == ctlvirtualmachinebmc.LegacyVirtualMachineBMCName(vm.Namespace, vm.Name) &&
+			virtualMachineBMC.Labels[AutoCreatedLabel] != "true" {
+			if virtualMachineBMC.Labels == nil {
+				virtualMachineBMC.Labels = map[string]string{}
+			}
+			virtualMachineBMC.Labels[AutoCreatedLabel] = "true"
+			update = true
+		}
+		// Earlier versions created the VirtualMachineBMCs with the well-known default password. Dropping it lets the
+		// VirtualMachineBMC controller generate a random one.
+		if virtualMachineBMC.Spec.CredentialsSecretRef == nil && virtualMachineBMC.Spec.Password == ctlvirtualmachinebmc.DefaultPassword {
+			virtualMachineBMC.Spec.Password = ""
+			update = true
+		}
+		if !update {
+			return false, nil
+		}
+		log.V(1).Info("migrated VirtualMachineBMC created by an earlier version", "virtualMachineBMC", virtualMachineBMC.Name)
+		return false, v.Update(ctx, virtualMachineBMC)
+	}
+
+	// Prepare the VirtualMachineBMC
+	virtualMachineBMC = v.constructVirtualMachineBMCFromVirtualMachine(vm)
+
+	// Create the VirtualMachineBMC on the cluster
+	if err := v.Create(ctx, virtualMachineBMC); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return v.checkNameConflict(ctx, vm, virtualMachineBMC.Name)
+		}
+		return false, err
+	}
+	log.V(1).Info("created VirtualMachineBMC for VirtualMachine", "virtualMachineBMC", virtualMachineBMC.Name)
+
+	return false, nil
+}
+
+// checkNameConflict inspects the VirtualMachineBMC occupying the name of the one to create for the VirtualMachine. It
+// tells whether the reconciliation has to be retried because the cache is lagging behind or the VirtualMachineBMC is
+// being deleted. A VirtualMachineBMC targeting another VirtualMachine, whose name collides on the hash, is reported
+// with an event and never retried.
+func (v *VirtualMachineReconciler) checkNameConflict(ctx context.Context, vm *kubevirtv1.VirtualMachine, name string) (bool, error) {
+	var existing virtualmachinev1.VirtualMachineBMC
+	if err := v.Get(ctx, types.NamespacedName{
+		Namespace: ctlvirtualmachinebmc.VirtualMachineBMCNamespace,
+		Name:      name,
+	}, &existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if !existing.DeletionTimestamp.IsZero() {
+		return true, nil
+	}
+	if existing.Spec.VirtualMachineNamespace == vm.Namespace && existing.Spec.VirtualMachineName == vm.Name {
+		return false, nil
+	}
+
+	log.FromContext(ctx).Info("VirtualMachineBMC name already taken by another VirtualMachine", "virtualMachineBMC", name,
+		"virtualMachine", existing.Spec.VirtualMachineNamespace+"/"+existing.Spec.VirtualMachineName)
+	if v.Recorder != nil {
+		v.Recorder.Eventf(vm, corev1.EventTypeWarning, reasonNameConflict,
+			"VirtualMachineBMC %s/%s already exists for VirtualMachine %s/%s", existing.Namespace, name,
+			existing.Spec.VirtualMachineNamespace, existing.Spec.VirtualMachineName)
+	}
+	return false, nil
+}
+
+func (v *VirtualMachineReconciler) constructVirtualMachineBMCFromVirtualMachine(vm *kubevirtv1.VirtualMachine) *virtualmachinev1.VirtualMachineBMC {
 	virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
+			Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(vm.Namespace, vm.Name),
 			Namespace: ctlvirtualmachinebmc.VirtualMachineBMCNamespace,
+			Labels: map[string]string{
+				AutoCreatedLabel: "true",
+			},
 		},
 		Spec: virtualmachinev1.VirtualMachineBMCSpec{
-			Username:                ctlvirtualmachinebmc.DefaultUsername,
-			Password:                ctlvirtualmachinebmc.DefaultPassword,
 			VirtualMachineNamespace: vm.Namespace,
 			VirtualMachineName:      vm.Name,
+			VirtualMachineUID:       vm.UID,
 		},
 	}
 
@@ -84,6 +280,8 @@ func (v *VirtualMachineReconciler) constructVirtualMachineBMCFromVirtualMachine(
 }
 
 //+kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachines,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs/finalizers,verbs=update
@@ -100,38 +298,36 @@ func (v *VirtualMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	if err := v.handleFinalizer(ctx, &vm); err != nil {
-		log.Error(err, "failed to update finalizer")
+	if err := v.removeLegacyFinalizer(ctx, &vm); err != nil {
+		log.Error(err, "failed to remove legacy finalizer")
 		return ctrl.Result{}, err
 	}
 
-	// Prepare the VirtualMachineBMC
-	virtualMachineBMC := v.constructVirtualMachineBMCFromVirtualMachine(&vm)
+	// The VirtualMachineBMC of a deleted VirtualMachine is garbage-collected by the VirtualMachineBMC controller
+	if !vm.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
 
-	// Create the VirtualMachineBMC on the cluster
-	if err := v.Create(ctx, virtualMachineBMC); err != nil && !apierrors.IsAlreadyExists(err) {
-		log.Error(err, "unable to create VirtualMachineBMC for VirtualMachine", "virtualMachineBMC", virtualMachineBMC)
+	selected, err := v.isSelected(ctx, &vm)
+	if err != nil {
+		log.Error(err, "unable to determine whether VirtualMachine is selected")
 		return ctrl.Result{}, err
 	}
-
-	log.V(1).Info("created VirtualMachineBMC for VirtualMachine", "virtualMachineBMC", virtualMachineBMC)
-
-	if !vm.ObjectMeta.DeletionTimestamp.IsZero() {
-		virtualMachineBMCNamespacedName := types.NamespacedName{
-			Namespace: ctlvirtualmachinebmc.VirtualMachineBMCNamespace,
-			Name:      fmt.Sprintf("%s-%s", vm.Namespace, vm.Name),
-		}
-		var virtualMachineBMC virtualmachinev1.VirtualMachineBMC
-		if err := v.Get(ctx, virtualMachineBMCNamespacedName, &virtualMachineBMC); err != nil {
-			log.Error(err, "unable to fetch VirtualMachineBMC")
+	if !selected {
+		if err := v.deleteVirtualMachineBMC(ctx, &vm); err != nil {
+			log.Error(err, "unable to delete VirtualMachineBMC for unselected VirtualMachine")
 			return ctrl.Result{}, err
 		}
+		return ctrl.Result{}, nil
+	}
 
-		if err := v.Delete(ctx, &virtualMachineBMC); err != nil {
-			log.Error(err, "unable to delete VirtualMachineBMC for VirtualMachine", "virtualMachineBMC", virtualMachineBMC)
-			return ctrl.Result{}, err
-		}
-		log.V(1).Info("removed VirtualMachineBMC for VirtualMachine", "virtualMachineBMC", virtualMachineBMC)
+	retry, err := v.ensureVirtualMachineBMC(ctx, &vm)
+	if err != nil {
+		log.Error(err, "unable to create VirtualMachineBMC for VirtualMachine")
+		return ctrl.Result{}, err
+	}
+	if retry {
+		return ctrl.Result{RequeueAfter: retryInterval}, nil
 	}
 
 	return ctrl.Result{}, nil
@@ -141,5 +337,28 @@ func (v *VirtualMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 func (v *VirtualMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubevirtv1.VirtualMachine{}).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(v.findVirtualMachinesForNamespace)).
 		Complete(v)
 }
+
+// findVirtualMachinesForNamespace maps a Namespace to the VirtualMachines in it, so that a change of its labels is
+// reflected by the namespace selector
+func (v *VirtualMachineReconciler) findVirtualMachinesForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	if v.NamespaceSelector == nil || v.NamespaceSelector.Empty() {
+		return nil
+	}
+
+	var vms kubevirtv1.VirtualMachineList
+	if err := v.List(ctx, &vms, client.InNamespace(obj.GetName())); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list VirtualMachines")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(vms.Items))
+	for _, vm := range vms.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&vm),
+		})
+	}
+	return requests
+}
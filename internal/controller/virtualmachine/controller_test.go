@@ -23,18 +23,21 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+	ctlvirtualmachinebmc "kubevirt.io/kubevirtbmc/internal/controller/virtualmachinebmc"
 )
 
 var _ = Describe("VirtualMachine Controller", func() {
 	const (
 		testVMName                     = "test-vm"
 		testVMNamespace                = "default"
-		testVirtualMachineBMCName      = "default-test-vm"
 		testVirtualMachineBMCNamespace = "kubevirtbmc-system"
 		testUsername                   = "test-username"
 		testPassword                   = "test-password"
@@ -71,13 +74,409 @@ var _ = Describe("VirtualMachine Controller", func() {
 			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
 
 			By("Checking that the VirtualMachineBMC is created")
-			virtualMachineBMCLookupKey := types.NamespacedName{Name: testVirtualMachineBMCName, Namespace: testVirtualMachineBMCNamespace}
+			virtualMachineBMCLookupKey := types.NamespacedName{
+				Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(testVMNamespace, testVMName),
+				Namespace: testVirtualMachineBMCNamespace,
+			}
 			createdVirtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{}
 
 			Eventually(func() bool {
 				err := k8sClient.Get(ctx, virtualMachineBMCLookupKey, createdVirtualMachineBMC)
 				return err == nil
 			}, timeout, interval).Should(BeTrue())
+
+			By("Checking that the VirtualMachine UID is recorded")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm)).To(Succeed())
+			Expect(createdVirtualMachineBMC.Spec.VirtualMachineUID).To(Equal(vm.UID))
+		})
+
+		It("Should not create a VirtualMachineBMC for a VirtualMachine opting out", func() {
+			ctx := context.Background()
+
+			ns := corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, &ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachine opting out")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-vm-opt-out",
+					Namespace: testVMNamespace,
+					Labels:    map[string]string{EnabledLabel: "false"},
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			By("Checking that the VirtualMachineBMC is not created")
+			virtualMachineBMCLookupKey := types.NamespacedName{
+				Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(testVMNamespace, vm.Name),
+				Namespace: testVirtualMachineBMCNamespace,
+			}
+			Consistently(func() bool {
+				err := k8sClient.Get(ctx, virtualMachineBMCLookupKey, &virtualmachinev1.VirtualMachineBMC{})
+				return apierrors.IsNotFound(err)
+			}, time.Second*2, interval).Should(BeTrue())
+		})
+
+		It("Should remove the VirtualMachineBMC once the VirtualMachine opts out", func() {
+			ctx := context.Background()
+
+			ns := corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, &ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachine")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-vm-later-opt-out",
+					Namespace: testVMNamespace,
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			virtualMachineBMCLookupKey := types.NamespacedName{
+				Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(testVMNamespace, vm.Name),
+				Namespace: testVirtualMachineBMCNamespace,
+			}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, virtualMachineBMCLookupKey, &virtualmachinev1.VirtualMachineBMC{})
+			}, timeout, interval).Should(Succeed())
+
+			By("Opting the VirtualMachine out")
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm); err != nil {
+					return err
+				}
+				metav1.SetMetaDataLabel(&vm.ObjectMeta, EnabledLabel, "false")
+				return k8sClient.Update(ctx, vm)
+			}, timeout, interval).Should(Succeed())
+
+			By("Checking that the VirtualMachineBMC is removed")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, virtualMachineBMCLookupKey, &virtualmachinev1.VirtualMachineBMC{})
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("Should keep the VirtualMachineBMC created by hand for a VirtualMachine opting out", func() {
+			ctx := context.Background()
+
+			ns := corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, &ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachine opting out")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-vm-hand-made",
+					Namespace: testVMNamespace,
+					Labels:    map[string]string{EnabledLabel: "false"},
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			By("Creating a VirtualMachineBMC for it by hand")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(testVMNamespace, vm.Name),
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      vm.Name,
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the VirtualMachineBMC is kept")
+			Consistently(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), &virtualmachinev1.VirtualMachineBMC{})
+			}, time.Second*2, interval).Should(Succeed())
+		})
+
+		It("Should not block the deletion of a VirtualMachine", func() {
+			ctx := context.Background()
+
+			ns := corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, &ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachine")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-vm-deletion",
+					Namespace: testVMNamespace,
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			virtualMachineBMCLookupKey := types.NamespacedName{
+				Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(testVMNamespace, vm.Name),
+				Namespace: testVirtualMachineBMCNamespace,
+			}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, virtualMachineBMCLookupKey, &virtualmachinev1.VirtualMachineBMC{})
+			}, timeout, interval).Should(Succeed())
+
+			By("Checking that the VirtualMachine has no finalizer")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm)).To(Succeed())
+			Expect(vm.Finalizers).To(BeEmpty())
+
+			By("Deleting the VirtualMachine")
+			Expect(k8sClient.Delete(ctx, vm)).To(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm)
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("Should remove the finalizer added by earlier versions", func() {
+			ctx := context.Background()
+
+			By("Creating a new VirtualMachine with the legacy finalizer")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-vm-legacy-finalizer",
+					Namespace:  testVMNamespace,
+					Finalizers: []string{legacyFinalizerName},
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			By("Checking that the finalizer is removed")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm)).To(Succeed())
+				g.Expect(controllerutil.ContainsFinalizer(vm, legacyFinalizerName)).To(BeFalse())
+			}, timeout, interval).Should(Succeed())
+		})
+
+		It("Should keep the VirtualMachineBMC named by earlier versions", func() {
+			ctx := context.Background()
+
+			ns := corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, &ns))).Should(Succeed())
+
+			By("Creating a VirtualMachineBMC with the legacy name")
+			const vmName = "test-vm-legacy"
+			legacyVirtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ctlvirtualmachinebmc.LegacyVirtualMachineBMCName(testVMNamespace, vmName),
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					Username:                ctlvirtualmachinebmc.DefaultUsername,
+					Password:                ctlvirtualmachinebmc.DefaultPassword,
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      vmName,
+				},
+			}
+			Expect(k8sClient.Create(ctx, legacyVirtualMachineBMC)).To(Succeed())
+
+			By("Creating the VirtualMachine")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      vmName,
+					Namespace: testVMNamespace,
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			By("Checking that the legacy VirtualMachineBMC is migrated")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyVirtualMachineBMC), legacyVirtualMachineBMC)).To(Succeed())
+				g.Expect(legacyVirtualMachineBMC.Spec.VirtualMachineUID).To(Equal(vm.UID))
+				g.Expect(legacyVirtualMachineBMC.Spec.Password).To(BeEmpty())
+				g.Expect(legacyVirtualMachineBMC.Labels).To(HaveKeyWithValue(AutoCreatedLabel, "true"))
+			}, timeout, interval).Should(Succeed())
+
+			By("Checking that no other VirtualMachineBMC is created")
+			virtualMachineBMCLookupKey := types.NamespacedName{
+				Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(testVMNamespace, vmName),
+				Namespace: testVirtualMachineBMCNamespace,
+			}
+			Consistently(func() bool {
+				err := k8sClient.Get(ctx, virtualMachineBMCLookupKey, &virtualmachinev1.VirtualMachineBMC{})
+				return apierrors.IsNotFound(err)
+			}, time.Second*2, interval).Should(BeTrue())
+		})
+
+		It("Should remove the VirtualMachineBMC named by earlier versions once the VirtualMachine opts out", func() {
+			ctx := context.Background()
+
+			ns := corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, &ns))).Should(Succeed())
+
+			By("Creating an unlabeled VirtualMachineBMC with the legacy name")
+			const vmName = "test-vm-legacy-opt-out"
+			legacyVirtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ctlvirtualmachinebmc.LegacyVirtualMachineBMCName(testVMNamespace, vmName),
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      vmName,
+				},
+			}
+			Expect(k8sClient.Create(ctx, legacyVirtualMachineBMC)).To(Succeed())
+
+			By("Creating the VirtualMachine")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      vmName,
+					Namespace: testVMNamespace,
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			By("Checking that the legacy VirtualMachineBMC is labeled")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyVirtualMachineBMC), legacyVirtualMachineBMC)).To(Succeed())
+				g.Expect(legacyVirtualMachineBMC.Labels).To(HaveKeyWithValue(AutoCreatedLabel, "true"))
+			}, timeout, interval).Should(Succeed())
+
+			By("Opting the VirtualMachine out")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm)).To(Succeed())
+				vm.Labels = map[string]string{EnabledLabel: "false"}
+				g.Expect(k8sClient.Update(ctx, vm)).To(Succeed())
+			}, timeout, interval).Should(Succeed())
+
+			By("Checking that the legacy VirtualMachineBMC is removed")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyVirtualMachineBMC), &virtualmachinev1.VirtualMachineBMC{})
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("Should replace the VirtualMachineBMC of a former VirtualMachine", func() {
+			ctx := context.Background()
+
+			ns := corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, &ns))).Should(Succeed())
+
+			By("Creating a VirtualMachineBMC recorded for another VirtualMachine UID")
+			const vmName = "test-vm-recreated"
+			staleVirtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(testVMNamespace, vmName),
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      vmName,
+					VirtualMachineUID:       types.UID("00000000-0000-0000-0000-000000000000"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, staleVirtualMachineBMC)).To(Succeed())
+
+			By("Creating the VirtualMachine")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      vmName,
+					Namespace: testVMNamespace,
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			By("Checking that the VirtualMachineBMC is recreated for the VirtualMachine")
+			Eventually(func(g Gomega) {
+				var virtualMachineBMC virtualmachinev1.VirtualMachineBMC
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(staleVirtualMachineBMC), &virtualMachineBMC)).To(Succeed())
+				g.Expect(virtualMachineBMC.UID).NotTo(Equal(staleVirtualMachineBMC.UID))
+				g.Expect(virtualMachineBMC.Spec.VirtualMachineUID).To(Equal(vm.UID))
+			}, timeout, interval).Should(Succeed())
+		})
+
+		It("Should report the VirtualMachineBMC name taken by another VirtualMachine", func() {
+			ctx := context.Background()
+
+			ns := corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, &ns))).Should(Succeed())
+
+			By("Creating a VirtualMachineBMC with the name of the VirtualMachine targeting another one")
+			const vmName = "test-vm-name-conflict"
+			conflictingVirtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(testVMNamespace, vmName),
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      "test-vm-other",
+				},
+			}
+			Expect(k8sClient.Create(ctx, conflictingVirtualMachineBMC)).To(Succeed())
+
+			By("Creating the VirtualMachine")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      vmName,
+					Namespace: testVMNamespace,
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			By("Checking that a warning event is recorded for the VirtualMachine")
+			Eventually(func(g Gomega) {
+				var events corev1.EventList
+				g.Expect(k8sClient.List(ctx, &events, client.InNamespace(testVMNamespace))).To(Succeed())
+				found := false
+				for _, event := range events.Items {
+					if event.InvolvedObject.UID == vm.UID && event.Reason == reasonNameConflict {
+						g.Expect(event.Type).To(Equal(corev1.EventTypeWarning))
+						found = true
+					}
+				}
+				g.Expect(found).To(BeTrue())
+			}, timeout, interval).Should(Succeed())
+
+			By("Checking that the VirtualMachineBMC is left alone")
+			Consistently(func(g Gomega) {
+				var virtualMachineBMC virtualmachinev1.VirtualMachineBMC
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(conflictingVirtualMachineBMC), &virtualMachineBMC)).To(Succeed())
+				g.Expect(virtualMachineBMC.UID).To(Equal(conflictingVirtualMachineBMC.UID))
+				g.Expect(virtualMachineBMC.Spec.VirtualMachineName).To(Equal("test-vm-other"))
+			}, time.Second*2, interval).Should(Succeed())
 		})
 	})
 })
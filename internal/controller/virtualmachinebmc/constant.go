@@ -7,11 +7,53 @@ const (
 	VirtBMCImageName           = "starbops/virtbmc"
 	ipmiPort                   = 10623
 	redfishPort                = 10080
+	vncPort                    = 15900
 	IPMISvcPort                = 623
 	RedfishSvcPort             = 80
+	VNCSvcPort                 = 5900
 	ipmiPortName               = "ipmi"
 	redfishPortName            = "redfish"
+	vncPortName                = "vnc"
 	VirtualMachineBMCNameLabel = "kubevirt.io/virtualmachinebmc-name"
 	VMNameLabel                = "kubevirt.io/vm-name"
+	GeneratedCredentialsLabel  = "kubevirt.io/virtualmachinebmc-generated-credentials"
+	AutoCreatedLabel           = "kubevirt.io/virtualmachinebmc-auto-created"
 	VirtualMachineBMCNamespace = "kubevirtbmc-system"
+	SpecHashAnnotation         = "kubevirt.io/virtbmc-spec-hash"
+	TemplateHashAnnotation     = "kubevirt.io/virtbmc-template-hash"
+	ManagedAnnotationKeys      = "kubevirt.io/virtbmc-managed-annotations"
+	WorkloadKindDeployment     = "Deployment"
+	WorkloadKindStatefulSet    = "StatefulSet"
+	probePath                  = "/redfish/v1"
+	credentialsVolumeName      = "credentials"
+	credentialsMountPath       = "/etc/virtbmc/credentials"
+	credentialsSecretSuffix    = "-credentials"
+	configVolumeName           = "config"
+	configMountPath            = "/etc/virtbmc/config"
+	solPortKey                 = "solPort"
+	VNCPasswordSecretKey       = "vncPassword"
+	usernameEnvName            = "VIRTBMC_USERNAME"
+	passwordEnvName            = "VIRTBMC_PASSWORD"
+)
+
+// Reasons of the VirtualMachineBMC conditions
+const (
+	reasonPodNotFound                 = "PodNotFound"
+	reasonPodNotReady                 = "PodNotReady"
+	reasonPodReady                    = "PodReady"
+	reasonPodFailed                   = "PodFailed"
+	reasonServiceNotFound             = "ServiceNotFound"
+	reasonServiceAddressPending       = "AddressPending"
+	reasonServiceAddressAllocated     = "AddressAllocated"
+	reasonVirtualMachineNotFound      = "VirtualMachineNotFound"
+	reasonVirtualMachineFound         = "VirtualMachineFound"
+	reasonVirtualMachineRecreated     = "VirtualMachineRecreated"
+	reasonVirtualMachineAlreadyServed = "VirtualMachineAlreadyServed"
+	reasonSecretNotFound              = "SecretNotFound"
+	reasonSecretInvalid               = "SecretInvalid"
+	reasonSecretValid                 = "SecretValid"
+	reasonInlineCredentials           = "InlineCredentials"
+	reasonCredentialsPending          = "CredentialsPending"
+	reasonAllComponentsReady          = "AllComponentsReady"
+	reasonAsExpected                  = "AsExpected"
 )
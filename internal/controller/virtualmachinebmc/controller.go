@@ -18,19 +18,33 @@ package virtualmachinebmc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"path"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	kubevirtv1 "kubevirt.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+	"kubevirt.io/kubevirtbmc/pkg/credential"
+	"kubevirt.io/kubevirtbmc/pkg/util"
 )
 
 // VirtualMachineBMCReconciler reconciles a VirtualMachineBMC object
@@ -40,24 +54,29 @@ type VirtualMachineBMCReconciler struct {
 
 	AgentImageName string
 	AgentImageTag  string
+	// AgentWorkloadKind is the kind of workload running the virtBMC agent, either Deployment (default) or StatefulSet
+	AgentWorkloadKind string
+	// DefaultPodTemplate holds the cluster-wide defaults of the Pod running the virtBMC agent
+	DefaultPodTemplate *virtualmachinev1.PodTemplate
+
+	// apiReader reads from the API server, bypassing the cache
+	apiReader client.Reader
 }
 
 var (
-	ownerKey = ".metadata.controller"
-	apiGVStr = virtualmachinev1.GroupVersion.String()
+	ownerKey          = ".metadata.controller"
+	virtualMachineKey = ".spec.virtualMachine"
+	secretKey         = ".spec.credentialsSecretRef.name"
+	apiGVStr          = virtualmachinev1.GroupVersion.String()
 )
 
-func (r *VirtualMachineBMCReconciler) constructPodFromVirtualMachineBMC(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) *corev1.Pod {
-	name := fmt.Sprintf("%s-virtbmc", virtualMachineBMC.Name)
-
-	pod := &corev1.Pod{
+func (r *VirtualMachineBMCReconciler) constructPodTemplateFromVirtualMachineBMC(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) corev1.PodTemplateSpec {
+	template := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: map[string]string{
 				VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
 				VMNameLabel:                virtualMachineBMC.Spec.VirtualMachineName,
 			},
-			Name:      name,
-			Namespace: VirtualMachineBMCNamespace,
 		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
@@ -69,6 +88,10 @@ func (r *VirtualMachineBMCReconciler) constructPodFromVirtualMachineBMC(virtualM
 						"0.0.0.0",
 						"--ipmi-port",
 						strconv.Itoa(ipmiPort),
+						"--sol-port",
+						strconv.Itoa(IPMISvcPort),
+						"--sol-port-file",
+						path.Join(configMountPath, solPortKey),
 						"--redfish-port",
 						strconv.Itoa(redfishPort),
 						virtualMachineBMC.Spec.VirtualMachineNamespace,
@@ -86,25 +109,247 @@ func (r *VirtualMachineBMCReconciler) constructPodFromVirtualMachineBMC(virtualM
 							Protocol:      corev1.ProtocolTCP,
 						},
 					},
+					// The Redfish service root is served without authentication
+					LivenessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{
+								Path: probePath,
+								Port: intstr.FromString(redfishPortName),
+							},
+						},
+						PeriodSeconds:    10,
+						FailureThreshold: 3,
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{
+								Path: probePath,
+								Port: intstr.FromString(redfishPortName),
+							},
+						},
+						PeriodSeconds:    5,
+						FailureThreshold: 1,
+					},
 				},
 			},
 			ServiceAccountName: "kubevirtbmc-virtbmc",
 		},
 	}
 
-	return pod
+	setConfigForPod(&template.Spec, virtualMachineBMC)
+	setCredentialsForPod(&template.Spec, virtualMachineBMC)
+	if virtualMachineBMC.Spec.EnableVNC {
+		setVNCForPod(&template.Spec)
+	}
+	applyPodTemplate(&template, mergePodTemplates(r.DefaultPodTemplate, virtualMachineBMC.Spec.PodTemplate))
+
+	return template
 }
 
-func (r *VirtualMachineBMCReconciler) constructServiceFromVirtualMachineBMC(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) *corev1.Service {
-	name := fmt.Sprintf("%s-virtbmc", virtualMachineBMC.Name)
+// setConfigForPod mounts the ConfigMap holding the settings that are only known once the Service exists, e.g., the SOL
+// port. They are read by the agent whenever needed rather than passed as arguments so that a change takes effect
+// without rolling the workload out. The ConfigMap is optional as it is created after the workload, in the meantime
+// the agent falls back to the port of the Service.
+func setConfigForPod(podSpec *corev1.PodSpec, virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) {
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: configVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: virtBMCName(virtualMachineBMC)},
+				Optional:             util.Ptr(true),
+			},
+		},
+	})
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      configVolumeName,
+		MountPath: configMountPath,
+		ReadOnly:  true,
+	})
+}
+
+// solPort returns the port the remote consoles reach the IPMI port at, which the agent reports as the port carrying
+// the SOL payload. That is the node port allocated to a NodePort Service, and the port of the Service otherwise.
+func solPort(svc *corev1.Service) int {
+	if svc.Spec.Type == corev1.ServiceTypeNodePort {
+		for _, port := range svc.Spec.Ports {
+			if port.Name == ipmiPortName && port.NodePort != 0 {
+				return int(port.NodePort)
+			}
+		}
+	}
+	return IPMISvcPort
+}
+
+// setCredentialsForPod hands the BMC credentials over to the virtBMC container. A referenced Secret is mounted as a
+// volume rather than exposed as environment variables so that the kubelet can propagate rotations to the running Pod.
+func setCredentialsForPod(podSpec *corev1.PodSpec, virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) {
+	container := &podSpec.Containers[0]
+
+	if ref := virtualMachineBMC.Spec.CredentialsSecretRef; ref != nil && ref.Name != "" {
+		items := []corev1.KeyToPath{
+			{Key: corev1.BasicAuthUsernameKey, Path: credential.UsernameKey},
+			{Key: corev1.BasicAuthPasswordKey, Path: credential.PasswordKey},
+		}
+		// The VNC console has a password of its own, the VNC authentication scheme truncating it to 8 characters
+		if virtualMachineBMC.Spec.EnableVNC {
+			items = append(items, corev1.KeyToPath{Key: VNCPasswordSecretKey, Path: credential.VNCPasswordKey})
+		}
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: credentialsVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: ref.Name,
+					Items:      items,
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      credentialsVolumeName,
+			MountPath: credentialsMountPath,
+			ReadOnly:  true,
+		})
+		container.Args = append([]string{"--credentials-dir", credentialsMountPath}, container.Args...)
+		return
+	}
+
+	if virtualMachineBMC.Spec.Username != "" {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  usernameEnvName,
+			Value: virtualMachineBMC.Spec.Username,
+		})
+	}
+	if virtualMachineBMC.Spec.Password != "" {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  passwordEnvName,
+			Value: virtualMachineBMC.Spec.Password,
+		})
+	}
+}
+
+// setVNCForPod makes the virtBMC container serve the VNC console of the virtual machine
+func setVNCForPod(podSpec *corev1.PodSpec) {
+	container := &podSpec.Containers[0]
+	container.Args = append([]string{"--vnc-port", strconv.Itoa(vncPort)}, container.Args...)
+	container.Ports = append(container.Ports, corev1.ContainerPort{
+		Name:          vncPortName,
+		ContainerPort: vncPort,
+		Protocol:      corev1.ProtocolTCP,
+	})
+}
+
+// ensureCredentialsSecret makes the VirtualMachineBMC refer to a Secret holding a random password unless credentials
+// are configured already. The well-known default password doesn't count as configured. The defaulting webhook usually
+// refers to the Secret and labels the VirtualMachineBMC already, in which case the Secret only has to be generated. The
+// Secret is named after the VirtualMachineBMC and controlled by it so that they are deleted together. An existing
+// Secret of that name is only reused if it has been generated for this very VirtualMachineBMC.
+func (r *VirtualMachineBMCReconciler) ensureCredentialsSecret(ctx context.Context, virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) error {
+	spec := &virtualMachineBMC.Spec
+	if ref := spec.CredentialsSecretRef; ref != nil && ref.Name != "" {
+		if virtualMachineBMC.Labels[GeneratedCredentialsLabel] != "true" || ref.Name != CredentialsSecretName(virtualMachineBMC.Name) {
+			return nil
+		}
+		return r.generateCredentialsSecret(ctx, virtualMachineBMC, DefaultUsername)
+	}
+	// Inline credentials are deprecated but still honored, unless the password is the well-known default one
+	if spec.Username != "" && spec.Password != "" && spec.Password != DefaultPassword {
+		return nil
+	}
+
+	username := spec.Username
+	if username == "" {
+		username = DefaultUsername
+	}
+	if err := r.generateCredentialsSecret(ctx, virtualMachineBMC, username); err != nil {
+		return err
+	}
 
+	if virtualMachineBMC.Labels == nil {
+		virtualMachineBMC.Labels = map[string]string{}
+	}
+	virtualMachineBMC.Labels[GeneratedCredentialsLabel] = "true"
+	spec.CredentialsSecretRef = &corev1.LocalObjectReference{Name: CredentialsSecretName(virtualMachineBMC.Name)}
+	spec.Username = ""
+	spec.Password = ""
+	return r.Update(ctx, virtualMachineBMC)
+}
+
+// generateCredentialsSecret creates the Secret holding a random password for the VirtualMachineBMC unless it exists
+// already, in which case it must have been generated for this very VirtualMachineBMC. The Secrets generated before the
+// VNC console had a password of its own get one.
+func (r *VirtualMachineBMCReconciler) generateCredentialsSecret(
+	ctx context.Context,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+	username string,
+) error {
+	secretNamespacedName := types.NamespacedName{
+		Namespace: virtualMachineBMC.Namespace,
+		Name:      CredentialsSecretName(virtualMachineBMC.Name),
+	}
+	var secret corev1.Secret
+	err := r.Get(ctx, secretNamespacedName, &secret)
+	switch {
+	case apierrors.IsNotFound(err):
+		password, err := credential.GeneratePassword(credential.GeneratedPasswordLength)
+		if err != nil {
+			return err
+		}
+		vncPassword, err := credential.GeneratePassword(credential.GeneratedVNCPasswordLength)
+		if err != nil {
+			return err
+		}
+		secret = corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretNamespacedName.Name,
+				Namespace: secretNamespacedName.Namespace,
+				Labels: map[string]string{
+					GeneratedCredentialsLabel: "true",
+				},
+			},
+			Type: corev1.SecretTypeBasicAuth,
+			StringData: map[string]string{
+				corev1.BasicAuthUsernameKey: username,
+				corev1.BasicAuthPasswordKey: password,
+				VNCPasswordSecretKey:        vncPassword,
+			},
+		}
+		if err := ctrl.SetControllerReference(virtualMachineBMC, &secret, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, &secret); err != nil {
+			return err
+		}
+		log.FromContext(ctx).V(1).Info("generated credentials for VirtualMachineBMC", "secret", secret.Name)
+		return nil
+	case err != nil:
+		return err
+	case secret.Labels[GeneratedCredentialsLabel] != "true" || !metav1.IsControlledBy(&secret, virtualMachineBMC):
+		return fmt.Errorf("secret %s exists and doesn't hold credentials generated for the VirtualMachineBMC", secretNamespacedName)
+	case len(secret.Data[VNCPasswordSecretKey]) == 0:
+		vncPassword, err := credential.GeneratePassword(credential.GeneratedVNCPasswordLength)
+		if err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[VNCPasswordSecretKey] = []byte(vncPassword)
+		if err := r.Update(ctx, &secret); err != nil {
+			return err
+		}
+		log.FromContext(ctx).V(1).Info("generated VNC password for VirtualMachineBMC", "secret", secret.Name)
+	}
+	return nil
+}
+
+func (r *VirtualMachineBMCReconciler) constructServiceFromVirtualMachineBMC(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) *corev1.Service {
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: map[string]string{
 				VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
 				VMNameLabel:                virtualMachineBMC.Spec.VirtualMachineName,
 			},
-			Name:      name,
+			Name:      virtBMCName(virtualMachineBMC),
 			Namespace: VirtualMachineBMCNamespace,
 		},
 		Spec: corev1.ServiceSpec{
@@ -125,27 +370,266 @@ func (r *VirtualMachineBMCReconciler) constructServiceFromVirtualMachineBMC(virt
 					Port:       RedfishSvcPort,
 				},
 			},
+			Type: corev1.ServiceTypeClusterIP,
 		},
 	}
+	if virtualMachineBMC.Spec.EnableVNC {
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+			Name:       vncPortName,
+			Protocol:   corev1.ProtocolTCP,
+			TargetPort: intstr.FromString(vncPortName),
+			Port:       VNCSvcPort,
+		})
+	}
+
+	if spec := virtualMachineBMC.Spec.Service; spec != nil {
+		if spec.Type != "" {
+			svc.Spec.Type = spec.Type
+		}
+		svc.Annotations = spec.Annotations
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			svc.Spec.LoadBalancerIP = spec.LoadBalancerIP
+			svc.Spec.LoadBalancerClass = spec.LoadBalancerClass
+		}
+		if svc.Spec.Type != corev1.ServiceTypeClusterIP {
+			svc.Spec.ExternalTrafficPolicy = spec.ExternalTrafficPolicy
+		}
+	}
 
 	return svc
 }
 
+// reconcileService creates the virtBMC Service, or restores the fields managed by the controller if they have been
+// modified. Fields allocated by the cluster, e.g., the cluster IP, are left untouched.
+func (r *VirtualMachineBMCReconciler) reconcileService(
+	ctx context.Context,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+	svc *corev1.Service,
+) error {
+	log := log.FromContext(ctx)
+
+	desired := svc.DeepCopy()
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, svc, func() error {
+		mergeLabels(&svc.ObjectMeta, desired.Labels)
+		mutateServiceAnnotations(&svc.ObjectMeta, desired.Annotations)
+		mutateServiceSpec(&svc.Spec, &desired.Spec)
+		return ctrl.SetControllerReference(virtualMachineBMC, svc, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	if op != controllerutil.OperationResultNone {
+		log.V(1).Info(fmt.Sprintf("%s Service for VirtualMachineBMC", op), "svc", svc.Name)
+	}
+
+	return nil
+}
+
+// reconcileConfigMap creates or updates the ConfigMap holding the settings the agent reads from the Service once it
+// has been reconciled, e.g., the node port allocated to it
+func (r *VirtualMachineBMCReconciler) reconcileConfigMap(
+	ctx context.Context,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+	svc *corev1.Service,
+) error {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      virtBMCName(virtualMachineBMC),
+			Namespace: VirtualMachineBMCNamespace,
+		},
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, configMap, func() error {
+		mergeLabels(&configMap.ObjectMeta, map[string]string{
+			VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
+			VMNameLabel:                virtualMachineBMC.Spec.VirtualMachineName,
+		})
+		configMap.Data = map[string]string{
+			solPortKey: strconv.Itoa(solPort(svc)),
+		}
+		return ctrl.SetControllerReference(virtualMachineBMC, configMap, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	if op != controllerutil.OperationResultNone {
+		log.FromContext(ctx).V(1).Info(fmt.Sprintf("%s ConfigMap for VirtualMachineBMC", op), "configMap", configMap.Name)
+	}
+
+	return nil
+}
+
+// mutateServiceAnnotations sets the desired annotations on the Service. The keys set are listed in an annotation of
+// their own so that the ones dropped from the VirtualMachineBMC are removed, while the annotations added by others,
+// e.g., by a load balancer controller, are kept.
+func mutateServiceAnnotations(meta *metav1.ObjectMeta, desired map[string]string) {
+	for _, k := range strings.Split(meta.Annotations[ManagedAnnotationKeys], ",") {
+		if _, ok := desired[k]; !ok {
+			delete(meta.Annotations, k)
+		}
+	}
+	delete(meta.Annotations, ManagedAnnotationKeys)
+	if len(desired) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(desired))
+	for k, v := range desired {
+		metav1.SetMetaDataAnnotation(meta, k, v)
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	metav1.SetMetaDataAnnotation(meta, ManagedAnnotationKeys, strings.Join(keys, ","))
+}
+
+// mutateServiceSpec brings the Service spec in line with the desired one. The node ports and the external traffic
+// policy are defaulted by the API server, so they are kept as long as the Service type allows them. The fields that
+// are only valid for other Service types are cleared when the type changes.
+func mutateServiceSpec(current, desired *corev1.ServiceSpec) {
+	nodePorts := map[string]int32{}
+	for _, port := range current.Ports {
+		nodePorts[port.Name] = port.NodePort
+	}
+
+	current.Type = desired.Type
+	current.Selector = desired.Selector
+	current.Ports = desired.Ports
+	if current.Type != corev1.ServiceTypeClusterIP {
+		for i := range current.Ports {
+			current.Ports[i].NodePort = nodePorts[current.Ports[i].Name]
+		}
+	}
+
+	switch {
+	case current.Type == corev1.ServiceTypeClusterIP:
+		current.ExternalTrafficPolicy = ""
+	case desired.ExternalTrafficPolicy != "":
+		current.ExternalTrafficPolicy = desired.ExternalTrafficPolicy
+	}
+	if current.Type != corev1.ServiceTypeLoadBalancer || current.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyLocal {
+		current.HealthCheckNodePort = 0
+	}
+
+	if current.Type != corev1.ServiceTypeLoadBalancer {
+		current.AllocateLoadBalancerNodePorts = nil
+	}
+	current.LoadBalancerIP = desired.LoadBalancerIP
+	// The load balancer class can't be changed once set
+	if current.LoadBalancerClass == nil || current.Type != corev1.ServiceTypeLoadBalancer {
+		current.LoadBalancerClass = desired.LoadBalancerClass
+	}
+}
+
+// getServingVirtualMachineBMC returns the VirtualMachineBMC serving the virtual machine targeted by the given one. Out
+// of the VirtualMachineBMCs targeting the same virtual machine, e.g., created concurrently so that the webhook couldn't
+// tell, the oldest one serves it, the name settling ties. The outcome thus doesn't depend on the order they are
+// reconciled in.
+func (r *VirtualMachineBMCReconciler) getServingVirtualMachineBMC(
+	ctx context.Context,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+) (*virtualmachinev1.VirtualMachineBMC, error) {
+	var virtualMachineBMCs virtualmachinev1.VirtualMachineBMCList
+	if err := r.List(ctx, &virtualMachineBMCs, client.InNamespace(virtualMachineBMC.Namespace), client.MatchingFields{
+		virtualMachineKey: targetKey(virtualMachineBMC),
+	}); err != nil {
+		return nil, err
+	}
+
+	serving := virtualMachineBMC
+	for i := range virtualMachineBMCs.Items {
+		other := &virtualMachineBMCs.Items[i]
+		// A VirtualMachineBMC being deleted gives way to the others
+		if !other.DeletionTimestamp.IsZero() || other.Name == virtualMachineBMC.Name {
+			continue
+		}
+		if other.CreationTimestamp.Before(&serving.CreationTimestamp) ||
+			(other.CreationTimestamp.Equal(&serving.CreationTimestamp) && other.Name < serving.Name) {
+			serving = other
+		}
+	}
+	return serving, nil
+}
+
+// removeAgent deletes the virtBMC agent of the VirtualMachineBMC, i.e., its workload whatever the kind, its Service and
+// its ConfigMap
+func (r *VirtualMachineBMCReconciler) removeAgent(ctx context.Context, virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) error {
+	objectMeta := metav1.ObjectMeta{Name: virtBMCName(virtualMachineBMC), Namespace: VirtualMachineBMCNamespace}
+	for _, obj := range []client.Object{
+		&corev1.Pod{ObjectMeta: objectMeta},
+		&appsv1.Deployment{ObjectMeta: objectMeta},
+		&appsv1.StatefulSet{ObjectMeta: objectMeta},
+		&corev1.Service{ObjectMeta: objectMeta},
+		&corev1.ConfigMap{ObjectMeta: objectMeta},
+	} {
+		if _, err := r.deleteIfControlled(ctx, virtualMachineBMC, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetKey returns the key of the virtualMachineKey index for the virtual machine targeted by the VirtualMachineBMC
+func targetKey(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) string {
+	return types.NamespacedName{
+		Namespace: virtualMachineBMC.Spec.VirtualMachineNamespace,
+		Name:      virtualMachineBMC.Spec.VirtualMachineName,
+	}.String()
+}
+
+// isVirtualMachineGone tells whether the virtual machine whose UID is recorded on the VirtualMachineBMC, or any virtual
+// machine of that name if none is recorded, no longer exists. The API server is queried directly so that a lagging
+// cache never causes a live BMC to be removed.
+func (r *VirtualMachineBMCReconciler) isVirtualMachineGone(
+	ctx context.Context,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+) (bool, error) {
+	var vm kubevirtv1.VirtualMachine
+	if err := r.apiReader.Get(ctx, types.NamespacedName{
+		Namespace: virtualMachineBMC.Spec.VirtualMachineNamespace,
+		Name:      virtualMachineBMC.Spec.VirtualMachineName,
+	}, &vm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return virtualMachineBMC.Spec.VirtualMachineUID != "" && vm.UID != virtualMachineBMC.Spec.VirtualMachineUID, nil
+}
+
+// isAutoCreated tells whether the VirtualMachineBMC has been created by the VirtualMachine controller, including by
+// earlier versions, which named it after the virtual machine without labeling it
+func isAutoCreated(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) bool {
+	return virtualMachineBMC.Labels[AutoCreatedLabel] == "true" ||
+		virtualMachineBMC.Name == LegacyVirtualMachineBMCName(virtualMachineBMC.Spec.VirtualMachineNamespace, virtualMachineBMC.Spec.VirtualMachineName)
+}
+
+// computeSpecHash returns a digest of the given objects. It is stable as long as their JSON encoding is.
+func computeSpecHash(objs ...interface{}) (string, error) {
+	hasher := fnv.New64a()
+	for _, obj := range objs {
+		b, err := json.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		_, _ = hasher.Write(b)
+	}
+	return strconv.FormatUint(hasher.Sum64(), 16), nil
+}
+
 //+kubebuilder:rbac:groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs/finalizers,verbs=update
-//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
-
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the VirtualMachineBMC object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.16.3/pkg/reconcile
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete,namespace=kubevirtbmc-system
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete,namespace=kubevirtbmc-system
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch,namespace=kubevirtbmc-system
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete,namespace=kubevirtbmc-system
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete,namespace=kubevirtbmc-system
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete,namespace=kubevirtbmc-system
+//+kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachines,verbs=get;list;watch
+
+// Reconcile brings the virtBMC agent of a VirtualMachineBMC, i.e., its credentials, workload, Service and ConfigMap,
+// in line with the VirtualMachineBMC and its virtual machine, and reports their state in the VirtualMachineBMC status.
+// It also garbage-collects the VirtualMachineBMC once its virtual machine is gone, and leaves the VirtualMachineBMCs
+// duplicating the one serving the virtual machine without agent.
 func (r *VirtualMachineBMCReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
@@ -158,39 +642,109 @@ func (r *VirtualMachineBMCReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// Prepare the virtBMC Pod
-	pod := r.constructPodFromVirtualMachineBMC(&virtualMachineBMC)
-	if err := ctrl.SetControllerReference(&virtualMachineBMC, pod, r.Scheme); err != nil {
+	vm, err := r.getVirtualMachine(ctx, &virtualMachineBMC)
+	if err != nil {
+		log.Error(err, "unable to fetch VirtualMachine for VirtualMachineBMC")
+		return ctrl.Result{}, err
+	}
+
+	// Garbage-collect the VirtualMachineBMC once the virtual machine whose UID it records is gone. Without a UID, it is
+	// only collected if it has been created automatically, including by earlier versions which didn't record the UID.
+	// A VirtualMachineBMC created by hand is admitted while its virtual machine exists, but the virtual machine may be
+	// deleted before the UID is recorded. Such a VirtualMachineBMC can't be told apart from one created ahead of its
+	// virtual machine while the webhook is not running, so it is left Degraded for its creator to delete.
+	if isStale(&virtualMachineBMC, vm) ||
+		(vm == nil && (virtualMachineBMC.Spec.VirtualMachineUID != "" || isAutoCreated(&virtualMachineBMC))) {
+		gone, err := r.isVirtualMachineGone(ctx, &virtualMachineBMC)
+		if err != nil {
+			log.Error(err, "unable to fetch VirtualMachine for VirtualMachineBMC")
+			return ctrl.Result{}, err
+		}
+		if gone {
+			if err := r.Delete(ctx, &virtualMachineBMC); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "unable to delete VirtualMachineBMC")
+				return ctrl.Result{}, err
+			}
+			log.V(1).Info("removed VirtualMachineBMC of deleted VirtualMachine", "vmUID", virtualMachineBMC.Spec.VirtualMachineUID)
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// Record the UID of the virtual machine so that the VirtualMachineBMC is garbage-collected once it is gone
+	if vm != nil && virtualMachineBMC.Spec.VirtualMachineUID == "" {
+		virtualMachineBMC.Spec.VirtualMachineUID = vm.UID
+		if err := r.Update(ctx, &virtualMachineBMC); err != nil {
+			log.Error(err, "unable to record VirtualMachine UID on VirtualMachineBMC")
+			return ctrl.Result{}, err
+		}
+		log.V(1).Info("recorded VirtualMachine UID on VirtualMachineBMC", "vmUID", vm.UID)
+	}
+
+	// Only one VirtualMachineBMC serves a virtual machine. The webhook rejects the others unless they are created
+	// concurrently, in which case they are left without agent and Degraded.
+	serving, err := r.getServingVirtualMachineBMC(ctx, &virtualMachineBMC)
+	if err != nil {
+		log.Error(err, "unable to list VirtualMachineBMCs targeting the same VirtualMachine")
 		return ctrl.Result{}, err
 	}
+	if serving.Name != virtualMachineBMC.Name {
+		if err := r.removeAgent(ctx, &virtualMachineBMC); err != nil {
+			log.Error(err, "unable to remove agent of duplicate VirtualMachineBMC")
+			return ctrl.Result{}, err
+		}
+		svc := r.constructServiceFromVirtualMachineBMC(&virtualMachineBMC)
+		if err := r.updateStatus(ctx, &virtualMachineBMC, svc, vm, serving); err != nil {
+			log.Error(err, "unable to update VirtualMachineBMC status")
+			return ctrl.Result{}, err
+		}
+		log.V(1).Info("VirtualMachine is already served by another VirtualMachineBMC", "servedBy", serving.Name)
+		return ctrl.Result{}, nil
+	}
 
-	// Create the virtBMC Pod on the cluster
-	if err := r.Create(ctx, pod); err != nil && !apierrors.IsAlreadyExists(err) {
-		log.Error(err, "unable to create Pod for VirtualMachineBMC", "pod", pod)
+	// Generate the credentials of the VirtualMachineBMC unless some are configured
+	if err := r.ensureCredentialsSecret(ctx, &virtualMachineBMC); err != nil {
+		log.Error(err, "unable to generate credentials for VirtualMachineBMC")
 		return ctrl.Result{}, err
 	}
 
-	log.V(1).Info("created Pod for VirtualMachineBMC", "pod", pod)
+	// Create or update the workload running the virtBMC agent on the cluster
+	retry, err := r.reconcileWorkload(ctx, &virtualMachineBMC)
+	if err != nil {
+		log.Error(err, "unable to reconcile workload for VirtualMachineBMC")
+		return ctrl.Result{}, err
+	}
 
 	// Prepare the virtBMC Service
 	svc := r.constructServiceFromVirtualMachineBMC(&virtualMachineBMC)
-	if err := ctrl.SetControllerReference(&virtualMachineBMC, svc, r.Scheme); err != nil {
+
+	// Create or update the virtBMC Service on the cluster
+	if err := r.reconcileService(ctx, &virtualMachineBMC, svc); err != nil {
+		log.Error(err, "unable to reconcile Service for VirtualMachineBMC", "svc", svc)
 		return ctrl.Result{}, err
 	}
 
-	// Create the virtBMC Service on the cluster
-	if err := r.Create(ctx, svc); err != nil && !apierrors.IsAlreadyExists(err) {
-		log.Error(err, "unable to create Service for VirtualMachineBMC", "svc", svc)
+	// Hand the settings derived from the Service over to the agent
+	if err := r.reconcileConfigMap(ctx, &virtualMachineBMC, svc); err != nil {
+		log.Error(err, "unable to reconcile ConfigMap for VirtualMachineBMC")
 		return ctrl.Result{}, err
 	}
 
-	log.V(1).Info("created Service for VirtualMachineBMC", "svc", svc)
+	// Reflect the observed state of the components in the VirtualMachineBMC status
+	if err := r.updateStatus(ctx, &virtualMachineBMC, svc, vm, serving); err != nil {
+		log.Error(err, "unable to update VirtualMachineBMC status")
+		return ctrl.Result{}, err
+	}
+	if retry {
+		return ctrl.Result{RequeueAfter: retryInterval}, nil
+	}
 
 	return ctrl.Result{}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *VirtualMachineBMCReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.apiReader = mgr.GetAPIReader()
+
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Pod{}, ownerKey, func(rawObj client.Object) []string {
 		// grab the pod object, extract the owner...
 		pod := rawObj.(*corev1.Pod)
@@ -227,9 +781,84 @@ func (r *VirtualMachineBMCReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &virtualmachinev1.VirtualMachineBMC{}, virtualMachineKey, func(rawObj client.Object) []string {
+		return []string{targetKey(rawObj.(*virtualmachinev1.VirtualMachineBMC))}
+	}); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &virtualmachinev1.VirtualMachineBMC{}, secretKey, func(rawObj client.Object) []string {
+		virtualMachineBMC := rawObj.(*virtualmachinev1.VirtualMachineBMC)
+		if ref := virtualMachineBMC.Spec.CredentialsSecretRef; ref != nil && ref.Name != "" {
+			return []string{ref.Name}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&virtualmachinev1.VirtualMachineBMC{}).
-		Owns(&corev1.Pod{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(findVirtualMachineBMCForPod)).
+		Watches(&kubevirtv1.VirtualMachine{}, handler.EnqueueRequestsFromMapFunc(r.findVirtualMachineBMCsForVirtualMachine)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.findVirtualMachineBMCsForSecret)).
+		Watches(&virtualmachinev1.VirtualMachineBMC{}, handler.EnqueueRequestsFromMapFunc(r.findVirtualMachineBMCsForVirtualMachineBMC)).
 		Complete(r)
 }
+
+// findVirtualMachineBMCForPod maps an agent Pod, which is owned by the workload rather than the VirtualMachineBMC, to
+// the VirtualMachineBMC it serves
+func findVirtualMachineBMCForPod(_ context.Context, obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[VirtualMachineBMCNameLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name},
+	}}
+}
+
+// findVirtualMachineBMCsForVirtualMachine maps a VirtualMachine to the VirtualMachineBMCs targeting it
+func (r *VirtualMachineBMCReconciler) findVirtualMachineBMCsForVirtualMachine(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.findVirtualMachineBMCs(ctx, client.MatchingFields{
+		virtualMachineKey: client.ObjectKeyFromObject(obj).String(),
+	})
+}
+
+// findVirtualMachineBMCsForVirtualMachineBMC maps a VirtualMachineBMC to the others targeting the same virtual machine,
+// so that the next one in line takes over once the serving one is deleted
+func (r *VirtualMachineBMCReconciler) findVirtualMachineBMCsForVirtualMachineBMC(ctx context.Context, obj client.Object) []reconcile.Request {
+	requests := r.findVirtualMachineBMCs(ctx, client.InNamespace(obj.GetNamespace()), client.MatchingFields{
+		virtualMachineKey: targetKey(obj.(*virtualmachinev1.VirtualMachineBMC)),
+	})
+	return slices.DeleteFunc(requests, func(request reconcile.Request) bool {
+		return request.Name == obj.GetName()
+	})
+}
+
+// findVirtualMachineBMCsForSecret maps a Secret to the VirtualMachineBMCs taking their credentials from it
+func (r *VirtualMachineBMCReconciler) findVirtualMachineBMCsForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.findVirtualMachineBMCs(ctx, client.InNamespace(obj.GetNamespace()), client.MatchingFields{
+		secretKey: obj.GetName(),
+	})
+}
+
+func (r *VirtualMachineBMCReconciler) findVirtualMachineBMCs(ctx context.Context, opts ...client.ListOption) []reconcile.Request {
+	var virtualMachineBMCs virtualmachinev1.VirtualMachineBMCList
+	if err := r.List(ctx, &virtualMachineBMCs, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list VirtualMachineBMCs")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(virtualMachineBMCs.Items))
+	for _, virtualMachineBMC := range virtualMachineBMCs.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&virtualMachineBMC),
+		})
+	}
+	return requests
+}
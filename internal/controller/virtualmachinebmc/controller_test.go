@@ -22,21 +22,30 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+	"kubevirt.io/kubevirtbmc/pkg/credential"
+	"kubevirt.io/kubevirtbmc/pkg/util"
 )
 
 var _ = Describe("VirtualMachineBMC Controller", func() {
 	const (
-		testVirtualMachineBMCName      = "default-test-vm"
+		testVirtualMachineBMCName      = "test-vm-bmc"
 		testVirtualMachineBMCNamespace = "kubevirtbmc-system"
 		testUsername                   = "test-username"
 		testPassword                   = "test-password"
 		testVMName                     = "test-vm"
 		testVMNamespace                = "default"
+		testSecretName                 = "test-credentials"
 
 		timeout  = time.Second * 10
 		duration = time.Second * 10
@@ -44,7 +53,7 @@ var _ = Describe("VirtualMachineBMC Controller", func() {
 	)
 
 	Context("When creating an VirtualMachineBMC", func() {
-		It("Should create a Pod and a Service", func() {
+		It("Should create a Deployment and a Service", func() {
 			ctx := context.Background()
 
 			// we need to create the namespace in the cluster first
@@ -72,15 +81,19 @@ var _ = Describe("VirtualMachineBMC Controller", func() {
 			}
 			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
 
-			By("Checking that the Pod is created")
-			podLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name + "-virtbmc", Namespace: virtualMachineBMC.Namespace}
-			createdPod := &corev1.Pod{}
+			By("Checking that the Deployment is created")
+			deploymentLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name + "-virtbmc", Namespace: virtualMachineBMC.Namespace}
+			createdDeployment := &appsv1.Deployment{}
 
 			Eventually(func() bool {
-				err := k8sClient.Get(ctx, podLookupKey, createdPod)
+				err := k8sClient.Get(ctx, deploymentLookupKey, createdDeployment)
 				return err == nil
 			}, timeout, interval).Should(BeTrue())
 
+			Expect(*createdDeployment.Spec.Replicas).To(Equal(int32(1)))
+			Expect(createdDeployment.Spec.Template.Spec.Containers[0].LivenessProbe).NotTo(BeNil())
+			Expect(createdDeployment.Spec.Template.Spec.Containers[0].ReadinessProbe).NotTo(BeNil())
+
 			By("Checking that the Service is created")
 			svcLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name + "-virtbmc", Namespace: virtualMachineBMC.Namespace}
 			createdSvc := &corev1.Service{}
@@ -89,6 +102,754 @@ var _ = Describe("VirtualMachineBMC Controller", func() {
 				err := k8sClient.Get(ctx, svcLookupKey, createdSvc)
 				return err == nil
 			}, timeout, interval).Should(BeTrue())
+
+			By("Checking that the ConfigMap hands the SOL port over to the agent")
+			createdConfigMap := &corev1.ConfigMap{}
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, svcLookupKey, createdConfigMap)
+			}, timeout, interval).Should(Succeed())
+			Expect(createdConfigMap.Data).To(HaveKeyWithValue(solPortKey, "623"))
+		})
+
+		It("Should mount the credentials Secret into the Pod", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachineBMC referring to a Secret")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-secret",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					CredentialsSecretRef: &corev1.LocalObjectReference{
+						Name: testSecretName,
+					},
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName + "-secret",
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the Pod template mounts the Secret")
+			deploymentLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name + "-virtbmc", Namespace: virtualMachineBMC.Namespace}
+			createdDeployment := &appsv1.Deployment{}
+
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, deploymentLookupKey, createdDeployment)
+				return err == nil
+			}, timeout, interval).Should(BeTrue())
+
+			podSpec := createdDeployment.Spec.Template.Spec
+			Expect(podSpec.Volumes).To(ContainElement(HaveField("VolumeSource.Secret.SecretName", testSecretName)))
+			Expect(podSpec.Containers[0].Args).To(ContainElement("--credentials-dir"))
+			Expect(podSpec.Containers[0].Env).To(BeEmpty())
+		})
+
+		It("Should apply the Pod template overrides", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachineBMC with a Pod template")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-template",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName + "-template",
+					PodTemplate: &virtualmachinev1.PodTemplate{
+						NodeSelector: map[string]string{
+							"kubernetes.io/os": "linux",
+						},
+						PriorityClassName: "system-cluster-critical",
+						SecurityContext: &corev1.PodSecurityContext{
+							RunAsNonRoot: util.Ptr(true),
+						},
+						ContainerSecurityContext: &corev1.SecurityContext{
+							AllowPrivilegeEscalation: util.Ptr(false),
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the Pod template carries the overrides")
+			deploymentLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name + "-virtbmc", Namespace: virtualMachineBMC.Namespace}
+			createdDeployment := &appsv1.Deployment{}
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, deploymentLookupKey, createdDeployment)
+			}, timeout, interval).Should(Succeed())
+
+			podSpec := createdDeployment.Spec.Template.Spec
+			Expect(podSpec.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "linux"))
+			Expect(podSpec.PriorityClassName).To(Equal("system-cluster-critical"))
+			Expect(*podSpec.SecurityContext.RunAsNonRoot).To(BeTrue())
+			Expect(*podSpec.Containers[0].SecurityContext.AllowPrivilegeEscalation).To(BeFalse())
+		})
+
+		It("Should expose the Service as configured", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachineBMC with a NodePort Service")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-nodeport",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName + "-nodeport",
+					Service: &virtualmachinev1.ServiceSpec{
+						Type: corev1.ServiceTypeNodePort,
+						Annotations: map[string]string{
+							"example.com/exposed": "true",
+						},
+						ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyLocal,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the Service is a NodePort one")
+			svcLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name + "-virtbmc", Namespace: virtualMachineBMC.Namespace}
+			createdSvc := &corev1.Service{}
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, svcLookupKey, createdSvc)
+			}, timeout, interval).Should(Succeed())
+
+			Expect(createdSvc.Spec.Type).To(Equal(corev1.ServiceTypeNodePort))
+			Expect(createdSvc.Spec.ExternalTrafficPolicy).To(Equal(corev1.ServiceExternalTrafficPolicyLocal))
+			Expect(createdSvc.Annotations).To(HaveKeyWithValue("example.com/exposed", "true"))
+			nodePort := createdSvc.Spec.Ports[0].NodePort
+			Expect(nodePort).NotTo(BeZero())
+
+			By("Checking that the allocated node ports are kept across reconciliations")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), virtualMachineBMC)).To(Succeed())
+			virtualMachineBMC.Spec.Service.Annotations["example.com/owner"] = "test"
+			Expect(k8sClient.Update(ctx, virtualMachineBMC)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, svcLookupKey, createdSvc)).To(Succeed())
+				g.Expect(createdSvc.Annotations).To(HaveKeyWithValue("example.com/owner", "test"))
+				g.Expect(createdSvc.Spec.Ports[0].NodePort).To(Equal(nodePort))
+			}, timeout, interval).Should(Succeed())
+
+			By("Annotating the Service by hand")
+			createdSvc.Annotations["example.com/external"] = "kept"
+			Expect(k8sClient.Update(ctx, createdSvc)).To(Succeed())
+
+			By("Checking that the annotations dropped from the VirtualMachineBMC are removed")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), virtualMachineBMC)).To(Succeed())
+			delete(virtualMachineBMC.Spec.Service.Annotations, "example.com/exposed")
+			Expect(k8sClient.Update(ctx, virtualMachineBMC)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, svcLookupKey, createdSvc)).To(Succeed())
+				g.Expect(createdSvc.Annotations).NotTo(HaveKey("example.com/exposed"))
+				g.Expect(createdSvc.Annotations).To(HaveKeyWithValue("example.com/owner", "test"))
+				g.Expect(createdSvc.Annotations).To(HaveKeyWithValue("example.com/external", "kept"))
+			}, timeout, interval).Should(Succeed())
+		})
+
+		It("Should expose the VNC console when enabled", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachineBMC with VNC enabled")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-vnc",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName + "-vnc",
+					EnableVNC:               true,
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the agent listens on the VNC port")
+			lookupKey := types.NamespacedName{Name: virtualMachineBMC.Name + "-virtbmc", Namespace: virtualMachineBMC.Namespace}
+			createdDeployment := &appsv1.Deployment{}
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, createdDeployment)
+			}, timeout, interval).Should(Succeed())
+
+			container := createdDeployment.Spec.Template.Spec.Containers[0]
+			Expect(container.Args).To(ContainElement("--vnc-port"))
+			Expect(container.Ports).To(ContainElement(HaveField("Name", vncPortName)))
+
+			By("Checking that the Service exposes the VNC port")
+			createdSvc := &corev1.Service{}
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, createdSvc)
+			}, timeout, interval).Should(Succeed())
+
+			Expect(createdSvc.Spec.Ports).To(ContainElement(And(
+				HaveField("Name", vncPortName),
+				HaveField("Port", int32(VNCSvcPort)),
+			)))
+
+			By("Checking that the generated credentials hold a VNC password of their own")
+			secretLookupKey := types.NamespacedName{Name: CredentialsSecretName(virtualMachineBMC.Name), Namespace: virtualMachineBMC.Namespace}
+			createdSecret := &corev1.Secret{}
+
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, secretLookupKey, createdSecret)).To(Succeed())
+				g.Expect(createdSecret.Data).To(HaveKey(VNCPasswordSecretKey))
+			}, timeout, interval).Should(Succeed())
+			Expect(createdSecret.Data[VNCPasswordSecretKey]).NotTo(Equal(createdSecret.Data[corev1.BasicAuthPasswordKey]))
+		})
+
+		It("Should reconcile drift on the Deployment and the Service", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachineBMC")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-drift",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					Username:                testUsername,
+					Password:                testPassword,
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName + "-drift",
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			deploymentLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name + "-virtbmc", Namespace: virtualMachineBMC.Namespace}
+			svcLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name + "-virtbmc", Namespace: virtualMachineBMC.Namespace}
+			createdDeployment := &appsv1.Deployment{}
+			createdSvc := &corev1.Service{}
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, deploymentLookupKey, createdDeployment)
+			}, timeout, interval).Should(Succeed())
+			originalHash := createdDeployment.Annotations[SpecHashAnnotation]
+			Expect(originalHash).NotTo(BeEmpty())
+
+			By("Switching the VirtualMachineBMC over to a credentials Secret")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), virtualMachineBMC)).To(Succeed())
+			virtualMachineBMC.Spec.CredentialsSecretRef = &corev1.LocalObjectReference{Name: testSecretName}
+			Expect(k8sClient.Update(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the Pod template is updated")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, deploymentLookupKey, createdDeployment)).To(Succeed())
+				g.Expect(createdDeployment.Annotations[SpecHashAnnotation]).NotTo(Equal(originalHash))
+				g.Expect(createdDeployment.Spec.Template.Spec.Volumes).To(ContainElement(HaveField("VolumeSource.Secret.SecretName", testSecretName)))
+			}, timeout, interval).Should(Succeed())
+
+			By("Editing the Pod template by hand")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, deploymentLookupKey, createdDeployment)).To(Succeed())
+				g.Expect(createdDeployment.Annotations).To(HaveKey(TemplateHashAnnotation))
+				createdDeployment.Spec.Template.Spec.Containers[0].Image = "example.com/virtbmc:edited"
+				g.Expect(k8sClient.Update(ctx, createdDeployment)).To(Succeed())
+			}, timeout, interval).Should(Succeed())
+
+			By("Checking that the Pod template is restored")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, deploymentLookupKey, createdDeployment)).To(Succeed())
+				g.Expect(createdDeployment.Spec.Template.Spec.Containers[0].Image).NotTo(Equal("example.com/virtbmc:edited"))
+			}, timeout, interval).Should(Succeed())
+
+			By("Editing the Service by hand")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, svcLookupKey, createdSvc)
+			}, timeout, interval).Should(Succeed())
+			createdSvc.Spec.Ports[0].Port = 6230
+			Expect(k8sClient.Update(ctx, createdSvc)).To(Succeed())
+
+			By("Checking that the Service is restored")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, svcLookupKey, createdSvc)).To(Succeed())
+				g.Expect(createdSvc.Spec.Ports[0].Port).To(Equal(int32(IPMISvcPort)))
+			}, timeout, interval).Should(Succeed())
+		})
+
+		It("Should replace the Pod created by earlier versions", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachineBMC")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-legacy",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName + "-legacy",
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Creating a bare Pod owned by the VirtualMachineBMC")
+			legacyPod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      virtualMachineBMC.Name + "-virtbmc",
+					Namespace: testVirtualMachineBMCNamespace,
+					Labels: map[string]string{
+						VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: virtBMCContainerName, Image: VirtBMCImageName}},
+				},
+			}
+			Expect(controllerutil.SetControllerReference(virtualMachineBMC, legacyPod, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, legacyPod)).To(Succeed())
+
+			By("Checking that the bare Pod is removed")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyPod), &corev1.Pod{})
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+
+			By("Checking that the Deployment is created once the bare Pod is gone")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyPod), &appsv1.Deployment{})
+			}, timeout, interval).Should(Succeed())
+		})
+
+		It("Should report the status conditions", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachineBMC referring to a nonexistent Secret and VirtualMachine")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-status",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					CredentialsSecretRef: &corev1.LocalObjectReference{
+						Name: testSecretName + "-status",
+					},
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName + "-status",
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the VirtualMachineBMC is degraded")
+			virtualMachineBMCLookupKey := types.NamespacedName{Name: virtualMachineBMC.Name, Namespace: virtualMachineBMC.Namespace}
+			updatedVirtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{}
+
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, virtualMachineBMCLookupKey, updatedVirtualMachineBMC)).To(Succeed())
+				g.Expect(updatedVirtualMachineBMC.Status.ObservedGeneration).To(Equal(updatedVirtualMachineBMC.Generation))
+				g.Expect(updatedVirtualMachineBMC.Status.Ready).To(BeFalse())
+
+				conditions := updatedVirtualMachineBMC.Status.Conditions
+				g.Expect(meta.IsStatusConditionFalse(conditions, virtualmachinev1.ConditionVirtualMachineFound)).To(BeTrue())
+				g.Expect(meta.IsStatusConditionFalse(conditions, virtualmachinev1.ConditionCredentialsValid)).To(BeTrue())
+				g.Expect(meta.IsStatusConditionFalse(conditions, virtualmachinev1.ConditionReady)).To(BeTrue())
+				g.Expect(meta.IsStatusConditionTrue(conditions, virtualmachinev1.ConditionDegraded)).To(BeTrue())
+			}, timeout, interval).Should(Succeed())
+
+			By("Creating the referenced Secret")
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testSecretName + "-status",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Type: corev1.SecretTypeBasicAuth,
+				StringData: map[string]string{
+					corev1.BasicAuthUsernameKey: testUsername,
+					corev1.BasicAuthPasswordKey: testPassword,
+				},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+
+			By("Checking that the credentials become valid")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, virtualMachineBMCLookupKey, updatedVirtualMachineBMC)).To(Succeed())
+				g.Expect(meta.IsStatusConditionTrue(updatedVirtualMachineBMC.Status.Conditions, virtualmachinev1.ConditionCredentialsValid)).To(BeTrue())
+			}, timeout, interval).Should(Succeed())
+		})
+
+		It("Should generate credentials when none are configured", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a VirtualMachineBMC with the well-known default password")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-generated",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					Username:                testUsername,
+					Password:                DefaultPassword,
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName,
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the VirtualMachineBMC refers to a generated Secret it controls")
+			secret := &corev1.Secret{}
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), virtualMachineBMC)).To(Succeed())
+				g.Expect(virtualMachineBMC.Spec.CredentialsSecretRef).NotTo(BeNil())
+				g.Expect(virtualMachineBMC.Spec.Username).To(BeEmpty())
+				g.Expect(virtualMachineBMC.Spec.Password).To(BeEmpty())
+				g.Expect(k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: testVirtualMachineBMCNamespace,
+					Name:      virtualMachineBMC.Spec.CredentialsSecretRef.Name,
+				}, secret)).To(Succeed())
+			}, timeout, interval).Should(Succeed())
+			Expect(secret.Name).To(Equal(CredentialsSecretName(virtualMachineBMC.Name)))
+			Expect(virtualMachineBMC.Labels).To(HaveKeyWithValue(GeneratedCredentialsLabel, "true"))
+			Expect(secret.Labels).To(HaveKeyWithValue(GeneratedCredentialsLabel, "true"))
+			Expect(metav1.IsControlledBy(secret, virtualMachineBMC)).To(BeTrue())
+			Expect(string(secret.Data[corev1.BasicAuthUsernameKey])).To(Equal(testUsername))
+			Expect(secret.Data[corev1.BasicAuthPasswordKey]).To(HaveLen(credential.GeneratedPasswordLength))
+		})
+
+		It("Should generate the credentials Secret referred to by the defaulting webhook", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a VirtualMachineBMC as defaulted by the webhook")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-defaulted",
+					Namespace: testVirtualMachineBMCNamespace,
+					Labels:    map[string]string{GeneratedCredentialsLabel: "true"},
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					CredentialsSecretRef: &corev1.LocalObjectReference{
+						Name: CredentialsSecretName(testVirtualMachineBMCName + "-defaulted"),
+					},
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName,
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the Secret is generated")
+			secret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: testVirtualMachineBMCNamespace,
+					Name:      virtualMachineBMC.Spec.CredentialsSecretRef.Name,
+				}, secret)
+			}, timeout, interval).Should(Succeed())
+			Expect(metav1.IsControlledBy(secret, virtualMachineBMC)).To(BeTrue())
+			Expect(string(secret.Data[corev1.BasicAuthUsernameKey])).To(Equal(DefaultUsername))
+			Expect(secret.Data[corev1.BasicAuthPasswordKey]).To(HaveLen(credential.GeneratedPasswordLength))
+		})
+
+		It("Should not take credentials from a Secret it hasn't generated", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a Secret named after the VirtualMachineBMC")
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      CredentialsSecretName(testVirtualMachineBMCName + "-foreign"),
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Type: corev1.SecretTypeBasicAuth,
+				StringData: map[string]string{
+					corev1.BasicAuthUsernameKey: testUsername,
+					corev1.BasicAuthPasswordKey: testPassword,
+				},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+
+			By("Creating a VirtualMachineBMC configuring no credentials")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-foreign",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      testVMName,
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the Secret is left alone")
+			Consistently(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), virtualMachineBMC)).To(Succeed())
+				g.Expect(virtualMachineBMC.Spec.CredentialsSecretRef).To(BeNil())
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+				g.Expect(metav1.GetControllerOf(secret)).To(BeNil())
+			}, time.Second*2, interval).Should(Succeed())
+		})
+
+		It("Should remove the VirtualMachineBMC once its VirtualMachine is gone", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachine")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVMName + "-gc",
+					Namespace: testVMNamespace,
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			By("Creating VirtualMachineBMCs recorded for the VirtualMachine and for a former one")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-gc",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      vm.Name,
+					VirtualMachineUID:       vm.UID,
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+			staleVirtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-gc-stale",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      vm.Name,
+					VirtualMachineUID:       types.UID("00000000-0000-0000-0000-000000000000"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, staleVirtualMachineBMC)).To(Succeed())
+
+			By("Checking that only the VirtualMachineBMC of the former VirtualMachine is removed")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(staleVirtualMachineBMC), &virtualmachinev1.VirtualMachineBMC{})
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+			Consistently(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), &virtualmachinev1.VirtualMachineBMC{})
+			}, time.Second*2, interval).Should(Succeed())
+
+			By("Deleting the VirtualMachine")
+			Expect(k8sClient.Delete(ctx, vm)).To(Succeed())
+
+			By("Checking that the VirtualMachineBMC is removed")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), &virtualmachinev1.VirtualMachineBMC{})
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("Should remove the VirtualMachineBMC created without a VirtualMachine UID once its VirtualMachine is gone", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a new VirtualMachine")
+			vm := &kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVMName + "-gc-no-uid",
+					Namespace: testVMNamespace,
+				},
+				Spec: kubevirtv1.VirtualMachineSpec{
+					Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+			By("Creating a VirtualMachineBMC without the UID of the VirtualMachine")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-gc-no-uid",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      vm.Name,
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that the UID of the VirtualMachine is recorded")
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), virtualMachineBMC)).To(Succeed())
+				g.Expect(virtualMachineBMC.Spec.VirtualMachineUID).To(Equal(vm.UID))
+			}, timeout, interval).Should(Succeed())
+
+			By("Deleting the VirtualMachine")
+			Expect(k8sClient.Delete(ctx, vm)).To(Succeed())
+
+			By("Checking that the VirtualMachineBMC is removed")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), &virtualmachinev1.VirtualMachineBMC{})
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("Should remove the VirtualMachineBMC created by an earlier version for a VirtualMachine gone since", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating a VirtualMachineBMC under the legacy name without a VirtualMachine and its UID")
+			vmName := testVMName + "-gc-legacy"
+			legacyVirtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      LegacyVirtualMachineBMCName(testVMNamespace, vmName),
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      vmName,
+				},
+			}
+			Expect(k8sClient.Create(ctx, legacyVirtualMachineBMC)).To(Succeed())
+
+			By("Creating a VirtualMachineBMC by hand without a VirtualMachine and its UID")
+			virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVirtualMachineBMCName + "-gc-legacy",
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Spec: virtualmachinev1.VirtualMachineBMCSpec{
+					VirtualMachineNamespace: testVMNamespace,
+					VirtualMachineName:      vmName,
+				},
+			}
+			Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+
+			By("Checking that only the VirtualMachineBMC created by the earlier version is removed")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyVirtualMachineBMC), &virtualmachinev1.VirtualMachineBMC{})
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+			Consistently(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(virtualMachineBMC), virtualMachineBMC)).To(Succeed())
+			}, time.Second*2, interval).Should(Succeed())
+			Expect(meta.IsStatusConditionTrue(virtualMachineBMC.Status.Conditions, virtualmachinev1.ConditionDegraded)).To(BeTrue())
+		})
+
+		It("Should only run the agent of the oldest VirtualMachineBMC targeting a VirtualMachine", func() {
+			ctx := context.Background()
+
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: testVirtualMachineBMCNamespace},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).Should(Succeed())
+
+			By("Creating two VirtualMachineBMCs targeting the same VirtualMachine, as concurrent creations would")
+			var virtualMachineBMCs []*virtualmachinev1.VirtualMachineBMC
+			for _, suffix := range []string{"-dup-a", "-dup-b"} {
+				virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      testVirtualMachineBMCName + suffix,
+						Namespace: testVirtualMachineBMCNamespace,
+					},
+					Spec: virtualmachinev1.VirtualMachineBMCSpec{
+						Username:                testUsername,
+						Password:                testPassword,
+						VirtualMachineNamespace: testVMNamespace,
+						VirtualMachineName:      testVMName + "-dup",
+					},
+				}
+				Expect(k8sClient.Create(ctx, virtualMachineBMC)).To(Succeed())
+				virtualMachineBMCs = append(virtualMachineBMCs, virtualMachineBMC)
+			}
+			// Both are created within the same second, the name settles the tie
+			serving, duplicate := virtualMachineBMCs[0], virtualMachineBMCs[1]
+			if duplicate.CreationTimestamp.Before(&serving.CreationTimestamp) {
+				serving, duplicate = duplicate, serving
+			}
+
+			By("Checking that only the oldest one runs an agent")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: serving.Name + "-virtbmc", Namespace: serving.Namespace}, &appsv1.Deployment{})
+			}, timeout, interval).Should(Succeed())
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(duplicate), duplicate)).To(Succeed())
+				c := meta.FindStatusCondition(duplicate.Status.Conditions, virtualmachinev1.ConditionDegraded)
+				g.Expect(c).NotTo(BeNil())
+				g.Expect(c.Status).To(Equal(metav1.ConditionTrue))
+				g.Expect(c.Reason).To(Equal(reasonVirtualMachineAlreadyServed))
+			}, timeout, interval).Should(Succeed())
+			Consistently(func() bool {
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: duplicate.Name + "-virtbmc", Namespace: duplicate.Namespace}, &appsv1.Deployment{})
+				return apierrors.IsNotFound(err)
+			}, time.Second*2, interval).Should(BeTrue())
+
+			By("Deleting the serving VirtualMachineBMC")
+			Expect(k8sClient.Delete(ctx, serving)).To(Succeed())
+
+			By("Checking that the duplicate takes over")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: duplicate.Name + "-virtbmc", Namespace: duplicate.Namespace}, &appsv1.Deployment{})
+			}, timeout, interval).Should(Succeed())
 		})
 	})
 })
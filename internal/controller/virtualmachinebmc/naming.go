@@ -0,0 +1,94 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualmachinebmc
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+)
+
+const (
+	virtBMCSuffix = "-virtbmc"
+	// maxWorkloadNameLength keeps the names of the workloads short enough for the controller revision hash that
+	// StatefulSets append to them in a label value, which is limited to 63 characters
+	maxWorkloadNameLength = validation.DNS1035LabelMaxLength - 11
+	// maxVirtualMachineBMCNameLength leaves room for the virtBMC suffix so that the names of the workloads are derived
+	// from the generated VirtualMachineBMC names verbatim
+	maxVirtualMachineBMCNameLength = maxWorkloadNameLength - len(virtBMCSuffix)
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// VirtualMachineBMCName returns the name of the VirtualMachineBMC created for a virtual machine. The name is made of
+// the namespace and the name of the virtual machine, truncated if needed, and a hash of both. The hash tells apart
+// the virtual machines whose joined names are the same, e.g., "a-b/c" and "a/b-c".
+func VirtualMachineBMCName(vmNamespace, vmName string) string {
+	return hashedName(
+		fmt.Sprintf("%s-%s", vmNamespace, vmName),
+		types.NamespacedName{Namespace: vmNamespace, Name: vmName}.String(),
+		"",
+		maxVirtualMachineBMCNameLength,
+	)
+}
+
+// LegacyVirtualMachineBMCName returns the name given to the VirtualMachineBMC of a virtual machine by earlier versions
+func LegacyVirtualMachineBMCName(vmNamespace, vmName string) string {
+	return fmt.Sprintf("%s-%s", vmNamespace, vmName)
+}
+
+// CredentialsSecretName returns the name of the Secret holding the credentials generated for a VirtualMachineBMC
+func CredentialsSecretName(virtualMachineBMCName string) string {
+	return virtualMachineBMCName + credentialsSecretSuffix
+}
+
+// virtBMCName returns the name of the workload and the Service of a VirtualMachineBMC. It is the name of the
+// VirtualMachineBMC followed by the virtBMC suffix, unless that would not make a valid Service name. Long or
+// otherwise invalid names are sanitized, truncated and made unique with a hash of the VirtualMachineBMC name.
+func virtBMCName(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) string {
+	name := virtualMachineBMC.Name + virtBMCSuffix
+	if len(name) <= maxWorkloadNameLength && len(validation.IsDNS1035Label(name)) == 0 {
+		return name
+	}
+
+	prefix := invalidLabelChars.ReplaceAllString(strings.ToLower(virtualMachineBMC.Name), "-")
+	if prefix == "" || prefix[0] < 'a' || prefix[0] > 'z' {
+		prefix = "bmc-" + prefix
+	}
+	return hashedName(prefix, virtualMachineBMC.Name, virtBMCSuffix, maxWorkloadNameLength)
+}
+
+// hashedName returns "<prefix>-<hash of key><suffix>", where the prefix is truncated so that the result is no longer
+// than maxLength characters
+func hashedName(prefix, key, suffix string, maxLength int) string {
+	hasher := fnv.New32a()
+	_, _ = hasher.Write([]byte(key))
+	hash := fmt.Sprintf("%08x", hasher.Sum32())
+
+	if maxPrefixLength := maxLength - len(hash) - len(suffix) - 1; len(prefix) > maxPrefixLength {
+		prefix = prefix[:maxPrefixLength]
+	}
+	prefix = strings.TrimRight(prefix, "-.")
+
+	return fmt.Sprintf("%s-%s%s", prefix, hash, suffix)
+}
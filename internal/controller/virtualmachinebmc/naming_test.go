@@ -0,0 +1,89 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualmachinebmc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+)
+
+func TestVirtualMachineBMCName(t *testing.T) {
+	t.Run("joined names do not collide", func(t *testing.T) {
+		assert.NotEqual(t, VirtualMachineBMCName("a-b", "c"), VirtualMachineBMCName("a", "b-c"))
+	})
+
+	t.Run("name is deterministic", func(t *testing.T) {
+		assert.Equal(t, VirtualMachineBMCName("default", "test-vm"), VirtualMachineBMCName("default", "test-vm"))
+		assert.True(t, strings.HasPrefix(VirtualMachineBMCName("default", "test-vm"), "default-test-vm-"))
+	})
+
+	t.Run("long names are truncated", func(t *testing.T) {
+		name := VirtualMachineBMCName(strings.Repeat("n", 63), strings.Repeat("v", 63))
+		assert.LessOrEqual(t, len(name), maxVirtualMachineBMCNameLength)
+		assert.Empty(t, validation.IsDNS1123Subdomain(name))
+		assert.NotEqual(t, name, VirtualMachineBMCName(strings.Repeat("n", 63), strings.Repeat("v", 62)))
+	})
+}
+
+func TestVirtBMCName(t *testing.T) {
+	tests := []struct {
+		name     string
+		bmcName  string
+		expected string
+	}{
+		{
+			name:     "short name is kept",
+			bmcName:  "default-test-vm",
+			expected: "default-test-vm-virtbmc",
+		},
+		{
+			name:    "long name is truncated",
+			bmcName: strings.Repeat("a", 100),
+		},
+		{
+			name:    "name with dots is sanitized",
+			bmcName: "default-test.vm",
+		},
+		{
+			name:    "name starting with a digit is sanitized",
+			bmcName: "1-test-vm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := virtBMCName(&virtualmachinev1.VirtualMachineBMC{ObjectMeta: metav1.ObjectMeta{Name: tt.bmcName}})
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, name)
+			}
+			assert.LessOrEqual(t, len(name), maxWorkloadNameLength)
+			assert.Empty(t, validation.IsDNS1035Label(name))
+		})
+	}
+
+	t.Run("generated names are kept", func(t *testing.T) {
+		bmcName := VirtualMachineBMCName(strings.Repeat("n", 63), strings.Repeat("v", 63))
+		name := virtBMCName(&virtualmachinev1.VirtualMachineBMC{ObjectMeta: metav1.ObjectMeta{Name: bmcName}})
+		assert.Equal(t, bmcName+"-virtbmc", name)
+	})
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualmachinebmc
+
+import (
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+)
+
+// LoadPodTemplate reads the cluster-wide Pod template defaults from a YAML or JSON file, usually a mounted ConfigMap
+func LoadPodTemplate(path string) (*virtualmachinev1.PodTemplate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read pod template: %w", err)
+	}
+
+	var podTemplate virtualmachinev1.PodTemplate
+	if err := yaml.UnmarshalStrict(b, &podTemplate); err != nil {
+		return nil, fmt.Errorf("unable to parse pod template %s: %w", path, err)
+	}
+
+	return &podTemplate, nil
+}
+
+// mergePodTemplates overlays the fields set in overrides onto defaults. Node selectors are merged key by key, while
+// the other fields are replaced as a whole.
+func mergePodTemplates(defaults, overrides *virtualmachinev1.PodTemplate) *virtualmachinev1.PodTemplate {
+	merged := &virtualmachinev1.PodTemplate{}
+	if defaults != nil {
+		merged = defaults.DeepCopy()
+	}
+	if overrides == nil {
+		return merged
+	}
+	overrides = overrides.DeepCopy()
+
+	if overrides.Resources != nil {
+		merged.Resources = overrides.Resources
+	}
+	if len(overrides.NodeSelector) > 0 {
+		if merged.NodeSelector == nil {
+			merged.NodeSelector = map[string]string{}
+		}
+		for k, v := range overrides.NodeSelector {
+			merged.NodeSelector[k] = v
+		}
+	}
+	if len(overrides.Tolerations) > 0 {
+		merged.Tolerations = overrides.Tolerations
+	}
+	if overrides.Affinity != nil {
+		merged.Affinity = overrides.Affinity
+	}
+	if overrides.PriorityClassName != "" {
+		merged.PriorityClassName = overrides.PriorityClassName
+	}
+	if len(overrides.ImagePullSecrets) > 0 {
+		merged.ImagePullSecrets = overrides.ImagePullSecrets
+	}
+	if overrides.SecurityContext != nil {
+		merged.SecurityContext = overrides.SecurityContext
+	}
+	if overrides.ContainerSecurityContext != nil {
+		merged.ContainerSecurityContext = overrides.ContainerSecurityContext
+	}
+
+	return merged
+}
+
+// applyPodTemplate sets the fields of the Pod template onto the generated Pod
+func applyPodTemplate(template *corev1.PodTemplateSpec, podTemplate *virtualmachinev1.PodTemplate) {
+	if podTemplate == nil {
+		return
+	}
+
+	podSpec := &template.Spec
+	container := &podSpec.Containers[0]
+
+	if podTemplate.Resources != nil {
+		container.Resources = *podTemplate.Resources
+	}
+	podSpec.NodeSelector = podTemplate.NodeSelector
+	podSpec.Tolerations = podTemplate.Tolerations
+	podSpec.Affinity = podTemplate.Affinity
+	podSpec.PriorityClassName = podTemplate.PriorityClassName
+	podSpec.ImagePullSecrets = podTemplate.ImagePullSecrets
+	podSpec.SecurityContext = podTemplate.SecurityContext
+	container.SecurityContext = podTemplate.ContainerSecurityContext
+}
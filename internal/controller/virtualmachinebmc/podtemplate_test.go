@@ -0,0 +1,407 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualmachinebmc
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+	"kubevirt.io/kubevirtbmc/pkg/util"
+)
+
+func testResources(cpu string) *corev1.ResourceRequirements {
+	return &corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+	}
+}
+
+func TestMergePodTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		defaults  *virtualmachinev1.PodTemplate
+		overrides *virtualmachinev1.PodTemplate
+		expected  *virtualmachinev1.PodTemplate
+	}{
+		{
+			name:     "no templates",
+			expected: &virtualmachinev1.PodTemplate{},
+		},
+		{
+			name: "defaults only",
+			defaults: &virtualmachinev1.PodTemplate{
+				Resources:         testResources("100m"),
+				NodeSelector:      map[string]string{"zone": "a"},
+				PriorityClassName: "low",
+			},
+			expected: &virtualmachinev1.PodTemplate{
+				Resources:         testResources("100m"),
+				NodeSelector:      map[string]string{"zone": "a"},
+				PriorityClassName: "low",
+			},
+		},
+		{
+			name: "overrides only",
+			overrides: &virtualmachinev1.PodTemplate{
+				Tolerations: []corev1.Toleration{{Key: "bmc", Operator: corev1.TolerationOpExists}},
+			},
+			expected: &virtualmachinev1.PodTemplate{
+				Tolerations: []corev1.Toleration{{Key: "bmc", Operator: corev1.TolerationOpExists}},
+			},
+		},
+		{
+			name: "overrides replace the defaults",
+			defaults: &virtualmachinev1.PodTemplate{
+				Resources:                testResources("100m"),
+				Tolerations:              []corev1.Toleration{{Key: "default", Operator: corev1.TolerationOpExists}},
+				PriorityClassName:        "low",
+				ImagePullSecrets:         []corev1.LocalObjectReference{{Name: "default"}},
+				SecurityContext:          &corev1.PodSecurityContext{RunAsNonRoot: util.Ptr(true)},
+				ContainerSecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: util.Ptr(true)},
+			},
+			overrides: &virtualmachinev1.PodTemplate{
+				Resources:                testResources("200m"),
+				Tolerations:              []corev1.Toleration{{Key: "override", Operator: corev1.TolerationOpExists}},
+				PriorityClassName:        "high",
+				ImagePullSecrets:         []corev1.LocalObjectReference{{Name: "override"}},
+				SecurityContext:          &corev1.PodSecurityContext{RunAsUser: util.Ptr(int64(1000))},
+				ContainerSecurityContext: &corev1.SecurityContext{RunAsNonRoot: util.Ptr(true)},
+			},
+			expected: &virtualmachinev1.PodTemplate{
+				Resources:                testResources("200m"),
+				Tolerations:              []corev1.Toleration{{Key: "override", Operator: corev1.TolerationOpExists}},
+				PriorityClassName:        "high",
+				ImagePullSecrets:         []corev1.LocalObjectReference{{Name: "override"}},
+				SecurityContext:          &corev1.PodSecurityContext{RunAsUser: util.Ptr(int64(1000))},
+				ContainerSecurityContext: &corev1.SecurityContext{RunAsNonRoot: util.Ptr(true)},
+			},
+		},
+		{
+			name: "unset overrides keep the defaults",
+			defaults: &virtualmachinev1.PodTemplate{
+				Resources:         testResources("100m"),
+				Tolerations:       []corev1.Toleration{{Key: "default", Operator: corev1.TolerationOpExists}},
+				PriorityClassName: "low",
+			},
+			overrides: &virtualmachinev1.PodTemplate{},
+			expected: &virtualmachinev1.PodTemplate{
+				Resources:         testResources("100m"),
+				Tolerations:       []corev1.Toleration{{Key: "default", Operator: corev1.TolerationOpExists}},
+				PriorityClassName: "low",
+			},
+		},
+		{
+			name: "node selectors are merged key by key",
+			defaults: &virtualmachinev1.PodTemplate{
+				NodeSelector: map[string]string{"zone": "a", "role": "infra"},
+			},
+			overrides: &virtualmachinev1.PodTemplate{
+				NodeSelector: map[string]string{"zone": "b", "disk": "ssd"},
+			},
+			expected: &virtualmachinev1.PodTemplate{
+				NodeSelector: map[string]string{"zone": "b", "role": "infra", "disk": "ssd"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var defaults *virtualmachinev1.PodTemplate
+			if tt.defaults != nil {
+				defaults = tt.defaults.DeepCopy()
+			}
+
+			assert.Equal(t, tt.expected, mergePodTemplates(defaults, tt.overrides))
+			assert.Equal(t, tt.defaults, defaults, "defaults must not be modified")
+		})
+	}
+}
+
+func TestApplyPodTemplate(t *testing.T) {
+	affinity := &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{
+						Key:      "zone",
+						Operator: corev1.NodeSelectorOpIn,
+						Values:   []string{"a"},
+					}},
+				}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		podTemplate *virtualmachinev1.PodTemplate
+		expected    corev1.PodSpec
+	}{
+		{
+			name: "no template",
+			expected: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: virtBMCContainerName}},
+			},
+		},
+		{
+			name:        "empty template",
+			podTemplate: &virtualmachinev1.PodTemplate{},
+			expected: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: virtBMCContainerName}},
+			},
+		},
+		{
+			name: "all fields",
+			podTemplate: &virtualmachinev1.PodTemplate{
+				Resources:                testResources("100m"),
+				NodeSelector:             map[string]string{"zone": "a"},
+				Tolerations:              []corev1.Toleration{{Key: "bmc", Operator: corev1.TolerationOpExists}},
+				Affinity:                 affinity,
+				PriorityClassName:        "high",
+				ImagePullSecrets:         []corev1.LocalObjectReference{{Name: "registry"}},
+				SecurityContext:          &corev1.PodSecurityContext{RunAsNonRoot: util.Ptr(true)},
+				ContainerSecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: util.Ptr(true)},
+			},
+			expected: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:            virtBMCContainerName,
+					Resources:       *testResources("100m"),
+					SecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: util.Ptr(true)},
+				}},
+				NodeSelector:      map[string]string{"zone": "a"},
+				Tolerations:       []corev1.Toleration{{Key: "bmc", Operator: corev1.TolerationOpExists}},
+				Affinity:          affinity,
+				PriorityClassName: "high",
+				ImagePullSecrets:  []corev1.LocalObjectReference{{Name: "registry"}},
+				SecurityContext:   &corev1.PodSecurityContext{RunAsNonRoot: util.Ptr(true)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: virtBMCContainerName}},
+				},
+			}
+
+			applyPodTemplate(&template, tt.podTemplate)
+			assert.Equal(t, tt.expected, template.Spec)
+		})
+	}
+}
+
+func TestLoadPodTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    *virtualmachinev1.PodTemplate
+		expectError bool
+	}{
+		{
+			name: "yaml",
+			content: `nodeSelector:
+  zone: a
+priorityClassName: high
+resources:
+  requests:
+    cpu: 100m
+`,
+			expected: &virtualmachinev1.PodTemplate{
+				Resources:         testResources("100m"),
+				NodeSelector:      map[string]string{"zone": "a"},
+				PriorityClassName: "high",
+			},
+		},
+		{
+			name:    "json",
+			content: `{"tolerations": [{"key": "bmc", "operator": "Exists"}]}`,
+			expected: &virtualmachinev1.PodTemplate{
+				Tolerations: []corev1.Toleration{{Key: "bmc", Operator: corev1.TolerationOpExists}},
+			},
+		},
+		{
+			name:     "empty file",
+			expected: &virtualmachinev1.PodTemplate{},
+		},
+		{
+			name:        "unknown field",
+			content:     "nodeName: node-1\n",
+			expectError: true,
+		},
+		{
+			name:        "malformed",
+			content:     "nodeSelector: [\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "template.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			podTemplate, err := LoadPodTemplate(path)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, podTemplate)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadPodTemplate(filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.Error(t, err)
+	})
+}
+
+func TestConstructPodTemplateWithDefaults(t *testing.T) {
+	r := &VirtualMachineBMCReconciler{
+		AgentImageName: VirtBMCImageName,
+		AgentImageTag:  "latest",
+		DefaultPodTemplate: &virtualmachinev1.PodTemplate{
+			Resources:         testResources("100m"),
+			NodeSelector:      map[string]string{"zone": "a", "role": "infra"},
+			PriorityClassName: "low",
+		},
+	}
+	virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+		ObjectMeta: metav1.ObjectMeta{Name: "default-test-vm", Namespace: VirtualMachineBMCNamespace},
+		Spec: virtualmachinev1.VirtualMachineBMCSpec{
+			VirtualMachineNamespace: "default",
+			VirtualMachineName:      "test-vm",
+			PodTemplate: &virtualmachinev1.PodTemplate{
+				NodeSelector:      map[string]string{"zone": "b"},
+				PriorityClassName: "high",
+			},
+		},
+	}
+
+	template := r.constructPodTemplateFromVirtualMachineBMC(virtualMachineBMC)
+	assert.Equal(t, *testResources("100m"), template.Spec.Containers[0].Resources)
+	assert.Equal(t, map[string]string{"zone": "b", "role": "infra"}, template.Spec.NodeSelector)
+	assert.Equal(t, "high", template.Spec.PriorityClassName)
+	assert.Equal(t, map[string]string{"zone": "a", "role": "infra"}, r.DefaultPodTemplate.NodeSelector,
+		"cluster-wide defaults must not be modified")
+}
+
+func TestConstructPodTemplateSOLPort(t *testing.T) {
+	r := &VirtualMachineBMCReconciler{AgentImageName: VirtBMCImageName, AgentImageTag: "latest"}
+	virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+		ObjectMeta: metav1.ObjectMeta{Name: "default-test-vm", Namespace: VirtualMachineBMCNamespace},
+		Spec: virtualmachinev1.VirtualMachineBMCSpec{
+			VirtualMachineNamespace: "default",
+			VirtualMachineName:      "test-vm",
+			Service:                 &virtualmachinev1.ServiceSpec{Type: corev1.ServiceTypeNodePort},
+		},
+		Status: virtualmachinev1.VirtualMachineBMCStatus{NodePorts: map[string]int32{"ipmi": 30623}},
+	}
+
+	// The node port is read from the ConfigMap, so that allocating it doesn't roll the workload out
+	template := r.constructPodTemplateFromVirtualMachineBMC(virtualMachineBMC)
+	args := template.Spec.Containers[0].Args
+	i := slices.Index(args, "--sol-port")
+	require.NotEqual(t, -1, i)
+	require.Less(t, i+1, len(args))
+	assert.Equal(t, "623", args[i+1])
+	i = slices.Index(args, "--sol-port-file")
+	require.NotEqual(t, -1, i)
+	require.Less(t, i+1, len(args))
+	assert.Equal(t, "/etc/virtbmc/config/solPort", args[i+1])
+	assert.Contains(t, template.Spec.Volumes, corev1.Volume{
+		Name: configVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "default-test-vm-virtbmc"},
+				Optional:             util.Ptr(true),
+			},
+		},
+	})
+}
+
+func TestSOLPort(t *testing.T) {
+	ports := []corev1.ServicePort{
+		{Name: "ipmi", Port: 623, NodePort: 30623},
+		{Name: "redfish", Port: 80, NodePort: 30080},
+	}
+	tests := []struct {
+		name     string
+		svc      corev1.ServiceSpec
+		expected int
+	}{
+		{
+			name:     "ClusterIP Service",
+			svc:      corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, Ports: []corev1.ServicePort{{Name: "ipmi", Port: 623}}},
+			expected: 623,
+		},
+		{
+			name:     "NodePort Service without allocated node port",
+			svc:      corev1.ServiceSpec{Type: corev1.ServiceTypeNodePort, Ports: []corev1.ServicePort{{Name: "ipmi", Port: 623}}},
+			expected: 623,
+		},
+		{
+			name:     "NodePort Service",
+			svc:      corev1.ServiceSpec{Type: corev1.ServiceTypeNodePort, Ports: ports},
+			expected: 30623,
+		},
+		{
+			name:     "LoadBalancer Service",
+			svc:      corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, Ports: ports},
+			expected: 623,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, solPort(&corev1.Service{Spec: tt.svc}))
+		})
+	}
+}
+
+func TestConstructPodTemplateVNCPassword(t *testing.T) {
+	for _, enableVNC := range []bool{false, true} {
+		r := &VirtualMachineBMCReconciler{AgentImageName: VirtBMCImageName, AgentImageTag: "latest"}
+		virtualMachineBMC := &virtualmachinev1.VirtualMachineBMC{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-test-vm", Namespace: VirtualMachineBMCNamespace},
+			Spec: virtualmachinev1.VirtualMachineBMCSpec{
+				VirtualMachineNamespace: "default",
+				VirtualMachineName:      "test-vm",
+				CredentialsSecretRef:    &corev1.LocalObjectReference{Name: "default-test-vm-credentials"},
+				EnableVNC:               enableVNC,
+			},
+		}
+
+		volumes := r.constructPodTemplateFromVirtualMachineBMC(virtualMachineBMC).Spec.Volumes
+		i := slices.IndexFunc(volumes, func(v corev1.Volume) bool { return v.Name == credentialsVolumeName })
+		require.NotEqual(t, -1, i)
+		require.NotNil(t, volumes[i].Secret)
+		vncItem := corev1.KeyToPath{Key: VNCPasswordSecretKey, Path: "vncPassword"}
+		assert.Equal(t, enableVNC, slices.Contains(volumes[i].Secret.Items, vncItem),
+			"the VNC password must only be mounted when VNC is enabled")
+	}
+}
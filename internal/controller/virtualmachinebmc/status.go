@@ -0,0 +1,351 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualmachinebmc
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+)
+
+// Container waiting reasons that won't resolve without intervention
+var failedWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// readinessConditions are the conditions that must all be true for the BMC to be Ready
+var readinessConditions = []string{
+	virtualmachinev1.ConditionAgentPodReady,
+	virtualmachinev1.ConditionServiceReady,
+	virtualmachinev1.ConditionVirtualMachineFound,
+	virtualmachinev1.ConditionCredentialsValid,
+}
+
+// updateStatus observes the components backing the VirtualMachineBMC and reflects them in its conditions. The status
+// is only written back when something has changed. serving is the VirtualMachineBMC serving the virtual machine, which
+// is the given one unless it is a duplicate.
+func (r *VirtualMachineBMCReconciler) updateStatus(
+	ctx context.Context,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+	svc *corev1.Service,
+	vm *kubevirtv1.VirtualMachine,
+	serving *virtualmachinev1.VirtualMachineBMC,
+) error {
+	status := virtualMachineBMC.Status.DeepCopy()
+	generation := virtualMachineBMC.Generation
+
+	podFailed, err := r.setAgentPodReadyCondition(ctx, status, generation, virtualMachineBMC)
+	if err != nil {
+		return err
+	}
+	if err := r.setServiceReadyCondition(ctx, status, generation, svc); err != nil {
+		return err
+	}
+	setVirtualMachineFoundCondition(status, generation, virtualMachineBMC, vm, serving)
+	if err := r.setCredentialsValidCondition(ctx, status, generation, virtualMachineBMC); err != nil {
+		return err
+	}
+	setReadyCondition(status, generation)
+	setDegradedCondition(status, generation, podFailed)
+
+	status.Ready = meta.IsStatusConditionTrue(status.Conditions, virtualmachinev1.ConditionReady)
+	status.ObservedGeneration = generation
+
+	if equality.Semantic.DeepEqual(&virtualMachineBMC.Status, status) {
+		return nil
+	}
+
+	virtualMachineBMC.Status = *status
+	return r.Status().Update(ctx, virtualMachineBMC)
+}
+
+// setAgentPodReadyCondition reports whether one of the virtBMC Pods is ready. It also tells whether the Pods have
+// failed in a way they won't recover from by themselves.
+func (r *VirtualMachineBMCReconciler) setAgentPodReadyCondition(
+	ctx context.Context,
+	status *virtualmachinev1.VirtualMachineBMCStatus,
+	generation int64,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+) (bool, error) {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(VirtualMachineBMCNamespace), client.MatchingLabels{
+		VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
+	}); err != nil {
+		return false, err
+	}
+
+	var failedMessage, notReadyMessage string
+	for _, pod := range pods.Items {
+		if !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if podReady(&pod) {
+			setCondition(status, generation, virtualmachinev1.ConditionAgentPodReady, metav1.ConditionTrue,
+				reasonPodReady, fmt.Sprintf("pod %s is ready", pod.Name))
+			return false, nil
+		}
+		if message, failed := podFailed(&pod); failed {
+			failedMessage = message
+		} else {
+			notReadyMessage = fmt.Sprintf("pod %s is not ready yet", pod.Name)
+		}
+	}
+
+	switch {
+	case notReadyMessage != "":
+		setCondition(status, generation, virtualmachinev1.ConditionAgentPodReady, metav1.ConditionFalse,
+			reasonPodNotReady, notReadyMessage)
+		return false, nil
+	case failedMessage != "":
+		setCondition(status, generation, virtualmachinev1.ConditionAgentPodReady, metav1.ConditionFalse,
+			reasonPodFailed, failedMessage)
+		return true, nil
+	default:
+		setCondition(status, generation, virtualmachinev1.ConditionAgentPodReady, metav1.ConditionFalse,
+			reasonPodNotFound, fmt.Sprintf("no pod found for %s", virtBMCName(virtualMachineBMC)))
+		return false, nil
+	}
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func podFailed(pod *corev1.Pod) (string, bool) {
+	if pod.Status.Phase == corev1.PodFailed {
+		return fmt.Sprintf("pod %s failed: %s", pod.Name, pod.Status.Message), true
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && failedWaitingReasons[cs.State.Waiting.Reason] {
+			return fmt.Sprintf("container %s of pod %s is waiting: %s", cs.Name, pod.Name, cs.State.Waiting.Reason), true
+		}
+	}
+	return "", false
+}
+
+func (r *VirtualMachineBMCReconciler) setServiceReadyCondition(
+	ctx context.Context,
+	status *virtualmachinev1.VirtualMachineBMCStatus,
+	generation int64,
+	svc *corev1.Service,
+) error {
+	var current corev1.Service
+	if err := r.Get(ctx, client.ObjectKeyFromObject(svc), &current); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		setCondition(status, generation, virtualmachinev1.ConditionServiceReady, metav1.ConditionFalse,
+			reasonServiceNotFound, fmt.Sprintf("service %s not found", svc.Name))
+		return nil
+	}
+
+	if current.Spec.ClusterIP == "" || current.Spec.ClusterIP == corev1.ClusterIPNone {
+		setCondition(status, generation, virtualmachinev1.ConditionServiceReady, metav1.ConditionFalse,
+			reasonServiceAddressPending, fmt.Sprintf("service %s has no cluster IP yet", current.Name))
+		return nil
+	}
+
+	if current.Spec.Type == corev1.ServiceTypeLoadBalancer && len(current.Status.LoadBalancer.Ingress) == 0 {
+		setCondition(status, generation, virtualmachinev1.ConditionServiceReady, metav1.ConditionFalse,
+			reasonServiceAddressPending, fmt.Sprintf("service %s is waiting for the load balancer", current.Name))
+		return nil
+	}
+
+	setCondition(status, generation, virtualmachinev1.ConditionServiceReady, metav1.ConditionTrue,
+		reasonServiceAddressAllocated, fmt.Sprintf("service %s listens on %s", current.Name, current.Spec.ClusterIP))
+	return nil
+}
+
+// getVirtualMachine returns the virtual machine targeted by the VirtualMachineBMC, or nil if it doesn't exist
+func (r *VirtualMachineBMCReconciler) getVirtualMachine(
+	ctx context.Context,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+) (*kubevirtv1.VirtualMachine, error) {
+	var vm kubevirtv1.VirtualMachine
+	if err := r.Get(ctx, types.NamespacedName{
+		Namespace: virtualMachineBMC.Spec.VirtualMachineNamespace,
+		Name:      virtualMachineBMC.Spec.VirtualMachineName,
+	}, &vm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &vm, nil
+}
+
+// isStale tells whether the virtual machine has been recreated since its UID was recorded on the VirtualMachineBMC
+func isStale(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC, vm *kubevirtv1.VirtualMachine) bool {
+	return vm != nil && virtualMachineBMC.Spec.VirtualMachineUID != "" && vm.UID != virtualMachineBMC.Spec.VirtualMachineUID
+}
+
+func setVirtualMachineFoundCondition(
+	status *virtualmachinev1.VirtualMachineBMCStatus,
+	generation int64,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+	vm *kubevirtv1.VirtualMachine,
+	serving *virtualmachinev1.VirtualMachineBMC,
+) {
+	vmNamespacedName := types.NamespacedName{
+		Namespace: virtualMachineBMC.Spec.VirtualMachineNamespace,
+		Name:      virtualMachineBMC.Spec.VirtualMachineName,
+	}
+
+	switch {
+	case vm == nil:
+		setCondition(status, generation, virtualmachinev1.ConditionVirtualMachineFound, metav1.ConditionFalse,
+			reasonVirtualMachineNotFound, fmt.Sprintf("virtual machine %s not found", vmNamespacedName))
+	case isStale(virtualMachineBMC, vm):
+		setCondition(status, generation, virtualmachinev1.ConditionVirtualMachineFound, metav1.ConditionFalse,
+			reasonVirtualMachineRecreated, fmt.Sprintf("virtual machine %s has UID %s instead of %s",
+				vmNamespacedName, vm.UID, virtualMachineBMC.Spec.VirtualMachineUID))
+	case serving.Name != virtualMachineBMC.Name:
+		setCondition(status, generation, virtualmachinev1.ConditionVirtualMachineFound, metav1.ConditionFalse,
+			reasonVirtualMachineAlreadyServed, fmt.Sprintf("virtual machine %s is already served by VirtualMachineBMC %s",
+				vmNamespacedName, serving.Name))
+	default:
+		setCondition(status, generation, virtualmachinev1.ConditionVirtualMachineFound, metav1.ConditionTrue,
+			reasonVirtualMachineFound, fmt.Sprintf("virtual machine %s found", vmNamespacedName))
+	}
+}
+
+func (r *VirtualMachineBMCReconciler) setCredentialsValidCondition(
+	ctx context.Context,
+	status *virtualmachinev1.VirtualMachineBMCStatus,
+	generation int64,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+) error {
+	ref := virtualMachineBMC.Spec.CredentialsSecretRef
+	if ref == nil || ref.Name == "" {
+		if virtualMachineBMC.Spec.Username != "" && virtualMachineBMC.Spec.Password != "" {
+			setCondition(status, generation, virtualmachinev1.ConditionCredentialsValid, metav1.ConditionTrue,
+				reasonInlineCredentials, "credentials are taken from the spec")
+			return nil
+		}
+		setCondition(status, generation, virtualmachinev1.ConditionCredentialsValid, metav1.ConditionFalse,
+			reasonCredentialsPending, "no credentials configured yet, a random password is being generated")
+		return nil
+	}
+
+	secretNamespacedName := types.NamespacedName{
+		Namespace: virtualMachineBMC.Namespace,
+		Name:      ref.Name,
+	}
+
+	var secret corev1.Secret
+	if err := r.Get(ctx, secretNamespacedName, &secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		setCondition(status, generation, virtualmachinev1.ConditionCredentialsValid, metav1.ConditionFalse,
+			reasonSecretNotFound, fmt.Sprintf("secret %s not found", secretNamespacedName))
+		return nil
+	}
+
+	if len(secret.Data[corev1.BasicAuthUsernameKey]) == 0 || len(secret.Data[corev1.BasicAuthPasswordKey]) == 0 {
+		setCondition(status, generation, virtualmachinev1.ConditionCredentialsValid, metav1.ConditionFalse,
+			reasonSecretInvalid, fmt.Sprintf("secret %s must contain non-empty %q and %q keys",
+				secretNamespacedName, corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey))
+		return nil
+	}
+	if virtualMachineBMC.Spec.EnableVNC && len(secret.Data[VNCPasswordSecretKey]) == 0 {
+		setCondition(status, generation, virtualmachinev1.ConditionCredentialsValid, metav1.ConditionFalse,
+			reasonSecretInvalid, fmt.Sprintf("secret %s must contain a non-empty %q key for the VNC console",
+				secretNamespacedName, VNCPasswordSecretKey))
+		return nil
+	}
+
+	setCondition(status, generation, virtualmachinev1.ConditionCredentialsValid, metav1.ConditionTrue,
+		reasonSecretValid, fmt.Sprintf("credentials are taken from secret %s", secretNamespacedName))
+	return nil
+}
+
+// setReadyCondition summarizes the readiness conditions. The first one that is not true determines the reason.
+func setReadyCondition(status *virtualmachinev1.VirtualMachineBMCStatus, generation int64) {
+	for _, conditionType := range readinessConditions {
+		c := meta.FindStatusCondition(status.Conditions, conditionType)
+		if c == nil || c.Status != metav1.ConditionTrue {
+			reason, message := "Unknown", fmt.Sprintf("%s is unknown", conditionType)
+			if c != nil {
+				reason, message = c.Reason, fmt.Sprintf("%s: %s", conditionType, c.Message)
+			}
+			setCondition(status, generation, virtualmachinev1.ConditionReady, metav1.ConditionFalse, reason, message)
+			return
+		}
+	}
+
+	setCondition(status, generation, virtualmachinev1.ConditionReady, metav1.ConditionTrue,
+		reasonAllComponentsReady, "the BMC is ready to serve requests")
+}
+
+// setDegradedCondition flags the problems that won't go away by waiting, as opposed to the ones that are expected
+// while the BMC is starting up.
+func setDegradedCondition(status *virtualmachinev1.VirtualMachineBMCStatus, generation int64, podFailed bool) {
+	degradingConditions := []string{
+		virtualmachinev1.ConditionVirtualMachineFound,
+		virtualmachinev1.ConditionCredentialsValid,
+	}
+	if podFailed {
+		degradingConditions = append(degradingConditions, virtualmachinev1.ConditionAgentPodReady)
+	}
+
+	for _, conditionType := range degradingConditions {
+		if c := meta.FindStatusCondition(status.Conditions, conditionType); c != nil && c.Status == metav1.ConditionFalse {
+			setCondition(status, generation, virtualmachinev1.ConditionDegraded, metav1.ConditionTrue,
+				c.Reason, fmt.Sprintf("%s: %s", conditionType, c.Message))
+			return
+		}
+	}
+
+	setCondition(status, generation, virtualmachinev1.ConditionDegraded, metav1.ConditionFalse,
+		reasonAsExpected, "the BMC is working as expected")
+}
+
+func setCondition(
+	status *virtualmachinev1.VirtualMachineBMCStatus,
+	generation int64,
+	conditionType string,
+	conditionStatus metav1.ConditionStatus,
+	reason, message string,
+) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
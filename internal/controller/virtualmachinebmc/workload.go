@@ -0,0 +1,291 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualmachinebmc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+	"kubevirt.io/kubevirtbmc/pkg/util"
+)
+
+// retryInterval is how long to wait for a leftover workload to be gone
+const retryInterval = 2 * time.Second
+
+func (r *VirtualMachineBMCReconciler) workloadKind() string {
+	if r.AgentWorkloadKind == WorkloadKindStatefulSet {
+		return WorkloadKindStatefulSet
+	}
+	return WorkloadKindDeployment
+}
+
+func (r *VirtualMachineBMCReconciler) constructDeploymentFromVirtualMachineBMC(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
+				VMNameLabel:                virtualMachineBMC.Spec.VirtualMachineName,
+			},
+			Name:      virtBMCName(virtualMachineBMC),
+			Namespace: VirtualMachineBMCNamespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: util.Ptr(int32(1)),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
+				},
+			},
+			// Never let two agents serve the same virtual machine at the same time
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
+			Template: r.constructPodTemplateFromVirtualMachineBMC(virtualMachineBMC),
+		},
+	}
+}
+
+func (r *VirtualMachineBMCReconciler) constructStatefulSetFromVirtualMachineBMC(virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
+				VMNameLabel:                virtualMachineBMC.Spec.VirtualMachineName,
+			},
+			Name:      virtBMCName(virtualMachineBMC),
+			Namespace: VirtualMachineBMCNamespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: util.Ptr(int32(1)),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					VirtualMachineBMCNameLabel: virtualMachineBMC.Name,
+				},
+			},
+			ServiceName: virtBMCName(virtualMachineBMC),
+			Template:    r.constructPodTemplateFromVirtualMachineBMC(virtualMachineBMC),
+		},
+	}
+}
+
+// reconcileWorkload creates or updates the workload running the virtBMC agent. The Pod template is replaced when its
+// spec hash differs from the desired one or when it has been changed since it was last written, while the fields
+// defaulted by the API server don't cause an update on every reconciliation. Leftovers from other kinds of workload,
+// including the bare Pod used by earlier versions, are removed beforehand. It tells whether the reconciliation has to be
+// retried because a leftover is still being deleted.
+func (r *VirtualMachineBMCReconciler) reconcileWorkload(ctx context.Context, virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) (bool, error) {
+	objectMeta := metav1.ObjectMeta{Name: virtBMCName(virtualMachineBMC), Namespace: VirtualMachineBMCNamespace}
+
+	leftovers := []client.Object{&corev1.Pod{ObjectMeta: objectMeta}}
+	switch r.workloadKind() {
+	case WorkloadKindStatefulSet:
+		leftovers = append(leftovers, &appsv1.Deployment{ObjectMeta: objectMeta})
+	default:
+		leftovers = append(leftovers, &appsv1.StatefulSet{ObjectMeta: objectMeta})
+	}
+
+	pending := false
+	for _, leftover := range leftovers {
+		gone, err := r.deleteIfControlled(ctx, virtualMachineBMC, leftover)
+		if err != nil {
+			return false, err
+		}
+		pending = pending || !gone
+	}
+	// Never let the Service select the leftover agent and the new one at the same time
+	if pending {
+		log.FromContext(ctx).V(1).Info("waiting for leftover workload of VirtualMachineBMC to be gone")
+		return true, nil
+	}
+
+	var (
+		obj client.Object
+		err error
+	)
+	switch r.workloadKind() {
+	case WorkloadKindStatefulSet:
+		obj, err = r.reconcileStatefulSet(ctx, virtualMachineBMC)
+	default:
+		obj, err = r.reconcileDeployment(ctx, virtualMachineBMC)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	log.FromContext(ctx).V(1).Info("reconciled workload for VirtualMachineBMC", "kind", r.workloadKind(), "name", obj.GetName())
+
+	return false, nil
+}
+
+func (r *VirtualMachineBMCReconciler) reconcileDeployment(ctx context.Context, virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) (client.Object, error) {
+	desired := r.constructDeploymentFromVirtualMachineBMC(virtualMachineBMC)
+	hash, err := computeSpecHash(desired.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, deployment, func() error {
+		mergeLabels(&deployment.ObjectMeta, desired.Labels)
+		deployment.Spec.Replicas = desired.Spec.Replicas
+		deployment.Spec.Strategy = desired.Spec.Strategy
+		// The selector is immutable
+		if deployment.CreationTimestamp.IsZero() {
+			deployment.Spec.Selector = desired.Spec.Selector
+		}
+		drifted, err := templateDrifted(&deployment.ObjectMeta, deployment.Spec.Template)
+		if err != nil {
+			return err
+		}
+		if deployment.Annotations[SpecHashAnnotation] != hash || drifted {
+			metav1.SetMetaDataAnnotation(&deployment.ObjectMeta, SpecHashAnnotation, hash)
+			delete(deployment.Annotations, TemplateHashAnnotation)
+			deployment.Spec.Template = desired.Spec.Template
+		}
+		return ctrl.SetControllerReference(virtualMachineBMC, deployment, r.Scheme)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deployment, r.recordTemplateHash(ctx, deployment, deployment.Spec.Template)
+}
+
+func (r *VirtualMachineBMCReconciler) reconcileStatefulSet(ctx context.Context, virtualMachineBMC *virtualmachinev1.VirtualMachineBMC) (client.Object, error) {
+	desired := r.constructStatefulSetFromVirtualMachineBMC(virtualMachineBMC)
+	hash, err := computeSpecHash(desired.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, statefulSet, func() error {
+		mergeLabels(&statefulSet.ObjectMeta, desired.Labels)
+		statefulSet.Spec.Replicas = desired.Spec.Replicas
+		// The selector and the service name are immutable
+		if statefulSet.CreationTimestamp.IsZero() {
+			statefulSet.Spec.Selector = desired.Spec.Selector
+			statefulSet.Spec.ServiceName = desired.Spec.ServiceName
+		}
+		drifted, err := templateDrifted(&statefulSet.ObjectMeta, statefulSet.Spec.Template)
+		if err != nil {
+			return err
+		}
+		if statefulSet.Annotations[SpecHashAnnotation] != hash || drifted {
+			metav1.SetMetaDataAnnotation(&statefulSet.ObjectMeta, SpecHashAnnotation, hash)
+			delete(statefulSet.Annotations, TemplateHashAnnotation)
+			statefulSet.Spec.Template = desired.Spec.Template
+		}
+		return ctrl.SetControllerReference(virtualMachineBMC, statefulSet, r.Scheme)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return statefulSet, r.recordTemplateHash(ctx, statefulSet, statefulSet.Spec.Template)
+}
+
+// templateDrifted tells whether the Pod template of a workload has been changed since it was last written by the
+// controller. A workload without a recorded template hash is not considered drifted.
+func templateDrifted(meta *metav1.ObjectMeta, template corev1.PodTemplateSpec) (bool, error) {
+	recorded, ok := meta.Annotations[TemplateHashAnnotation]
+	if !ok {
+		return false, nil
+	}
+	hash, err := computeSpecHash(template)
+	if err != nil {
+		return false, err
+	}
+	return hash != recorded, nil
+}
+
+// recordTemplateHash records the hash of the Pod template of a workload as returned by the API server, defaulted fields
+// included, unless it has been recorded already
+func (r *VirtualMachineBMCReconciler) recordTemplateHash(ctx context.Context, obj client.Object, template corev1.PodTemplateSpec) error {
+	if _, ok := obj.GetAnnotations()[TemplateHashAnnotation]; ok {
+		return nil
+	}
+	hash, err := computeSpecHash(template)
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[TemplateHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+	return r.Patch(ctx, obj, patch)
+}
+
+// deleteIfControlled removes the given object if it exists and is controlled by the VirtualMachineBMC. The workloads
+// are deleted in the foreground so that they are only gone once their Pods are. It tells whether the object is gone.
+func (r *VirtualMachineBMCReconciler) deleteIfControlled(
+	ctx context.Context,
+	virtualMachineBMC *virtualmachinev1.VirtualMachineBMC,
+	obj client.Object,
+) (bool, error) {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if !metav1.IsControlledBy(obj, virtualMachineBMC) {
+		return true, nil
+	}
+	if !obj.GetDeletionTimestamp().IsZero() {
+		return false, nil
+	}
+
+	uid := obj.GetUID()
+	opts := []client.DeleteOption{client.Preconditions{UID: &uid}}
+	if _, ok := obj.(*corev1.Pod); !ok {
+		opts = append(opts, client.PropagationPolicy(metav1.DeletePropagationForeground))
+	}
+	if err := r.Delete(ctx, obj, opts...); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	log.FromContext(ctx).V(1).Info("deleted object of VirtualMachineBMC", "kind", fmt.Sprintf("%T", obj), "name", obj.GetName())
+
+	return false, nil
+}
+
+func mergeLabels(meta *metav1.ObjectMeta, labels map[string]string) {
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		meta.Labels[k] = v
+	}
+}
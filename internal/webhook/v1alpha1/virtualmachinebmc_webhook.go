@@ -19,30 +19,51 @@ package v1alpha1
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kubevirtv1 "kubevirt.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	virtualmachinev1alpha1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+	ctlvirtualmachinebmc "kubevirt.io/kubevirtbmc/internal/controller/virtualmachinebmc"
 )
 
 // nolint:unused
 // log is for logging in this package.
 var virtualmachinebmclog = logf.Log.WithName("virtualmachinebmc-resource")
 
+// minPasswordLength is the length under which a password is considered weak
+const minPasswordLength = 8
+
+// commonPasswords are the passwords shipped by default on physical BMCs or otherwise easy to guess
+var commonPasswords = map[string]bool{
+	"admin":    true,
+	"calvin":   true,
+	"changeme": true,
+	"password": true,
+	"root":     true,
+	"12345678": true,
+}
+
 // SetupVirtualMachineBMCWebhookWithManager registers the webhook for VirtualMachineBMC in the manager.
 func SetupVirtualMachineBMCWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).For(&virtualmachinev1alpha1.VirtualMachineBMC{}).
-		WithValidator(&VirtualMachineBMCCustomValidator{}).
+		WithValidator(&VirtualMachineBMCCustomValidator{Reader: mgr.GetAPIReader()}).
 		WithDefaulter(&VirtualMachineBMCCustomDefaulter{}).
 		Complete()
 }
 
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-
 // +kubebuilder:webhook:path=/mutate-virtualmachine-kubevirt-io-v1alpha1-virtualmachinebmc,mutating=true,failurePolicy=fail,sideEffects=None,groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs,verbs=create;update,versions=v1alpha1,name=mvirtualmachinebmc-v1alpha1.kb.io,admissionReviewVersions=v1
 
 // VirtualMachineBMCCustomDefaulter struct is responsible for setting default values on the custom resource of the
@@ -50,9 +71,7 @@ func SetupVirtualMachineBMCWebhookWithManager(mgr ctrl.Manager) error {
 //
 // NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
 // as it is used only for temporary operations and does not need to be deeply copied.
-type VirtualMachineBMCCustomDefaulter struct {
-	// TODO(user): Add more fields as needed for defaulting
-}
+type VirtualMachineBMCCustomDefaulter struct{}
 
 var _ webhook.CustomDefaulter = &VirtualMachineBMCCustomDefaulter{}
 
@@ -65,12 +84,32 @@ func (d *VirtualMachineBMCCustomDefaulter) Default(_ context.Context, obj runtim
 	}
 	virtualmachinebmclog.Info("Defaulting for VirtualMachineBMC", "name", virtualmachinebmc.GetName())
 
-	// TODO(user): fill in your defaulting logic.
+	// Refer to a Secret holding a random password unless credentials are configured. The Secret is generated by the
+	// controller, which holds the permission to create Secrets, and its name only depends on the VirtualMachineBMC.
+	spec := &virtualmachinebmc.Spec
+	if spec.CredentialsSecretRef == nil && spec.Username == "" && spec.Password == "" && virtualmachinebmc.Name != "" {
+		if virtualmachinebmc.Labels == nil {
+			virtualmachinebmc.Labels = map[string]string{}
+		}
+		virtualmachinebmc.Labels[ctlvirtualmachinebmc.GeneratedCredentialsLabel] = "true"
+		spec.CredentialsSecretRef = &corev1.LocalObjectReference{
+			Name: ctlvirtualmachinebmc.CredentialsSecretName(virtualmachinebmc.Name),
+		}
+	}
+
+	if svc := virtualmachinebmc.Spec.Service; svc != nil {
+		if svc.Type == "" {
+			svc.Type = corev1.ServiceTypeClusterIP
+		}
+		if svc.Type != corev1.ServiceTypeClusterIP && svc.ExternalTrafficPolicy == "" {
+			svc.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyCluster
+		}
+	}
 
 	return nil
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
+// Deletions aren't validated, they are always allowed.
 // NOTE: The 'path' attribute must follow a specific pattern and should not be modified directly here.
 // Modifying the path for an invalid path can cause API server errors; failing to locate the webhook.
 // +kubebuilder:webhook:path=/validate-virtualmachine-kubevirt-io-v1alpha1-virtualmachinebmc,mutating=false,failurePolicy=fail,sideEffects=None,groups=virtualmachine.kubevirt.io,resources=virtualmachinebmcs,verbs=create;update,versions=v1alpha1,name=vvirtualmachinebmc-v1alpha1.kb.io,admissionReviewVersions=v1
@@ -81,35 +120,231 @@ func (d *VirtualMachineBMCCustomDefaulter) Default(_ context.Context, obj runtim
 // NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
 // as this struct is used only for temporary operations and does not need to be deeply copied.
 type VirtualMachineBMCCustomValidator struct {
-	// TODO(user): Add more fields as needed for validation
+	// Reader looks up the VirtualMachines, VirtualMachineBMCs and Secrets the validated objects refer to
+	Reader client.Reader
 }
 
 var _ webhook.CustomValidator = &VirtualMachineBMCCustomValidator{}
 
 // ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type VirtualMachineBMC.
-func (v *VirtualMachineBMCCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+func (v *VirtualMachineBMCCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
 	virtualmachinebmc, ok := obj.(*virtualmachinev1alpha1.VirtualMachineBMC)
 	if !ok {
 		return nil, fmt.Errorf("expected a VirtualMachineBMC object but got %T", obj)
 	}
 	virtualmachinebmclog.Info("Validation for VirtualMachineBMC upon creation", "name", virtualmachinebmc.GetName())
 
-	// TODO(user): fill in your validation logic upon object creation.
+	var allErrs field.ErrorList
+	// The controller only has access to the agents and the credentials Secrets in its own namespace
+	if virtualmachinebmc.Namespace != ctlvirtualmachinebmc.VirtualMachineBMCNamespace {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("metadata", "namespace"), virtualmachinebmc.Namespace,
+			[]string{ctlvirtualmachinebmc.VirtualMachineBMCNamespace}))
+	}
+	for _, msg := range validation.IsValidLabelValue(virtualmachinebmc.Name) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "name"), virtualmachinebmc.Name, msg))
+	}
 
-	return nil, nil
+	targetErrs, err := v.validateTarget(ctx, virtualmachinebmc)
+	if err != nil {
+		return nil, err
+	}
+	allErrs = append(allErrs, targetErrs...)
+	allErrs = append(allErrs, validatePodTemplate(virtualmachinebmc.Spec.PodTemplate)...)
+
+	warnings, err := v.credentialWarnings(ctx, virtualmachinebmc)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allErrs) > 0 {
+		return warnings, invalid(virtualmachinebmc, allErrs)
+	}
+	return warnings, nil
 }
 
 // ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type VirtualMachineBMC.
-func (v *VirtualMachineBMCCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+func (v *VirtualMachineBMCCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
 	virtualmachinebmc, ok := newObj.(*virtualmachinev1alpha1.VirtualMachineBMC)
 	if !ok {
 		return nil, fmt.Errorf("expected a VirtualMachineBMC object for the newObj but got %T", newObj)
 	}
+	oldVirtualmachinebmc, ok := oldObj.(*virtualmachinev1alpha1.VirtualMachineBMC)
+	if !ok {
+		return nil, fmt.Errorf("expected a VirtualMachineBMC object for the oldObj but got %T", oldObj)
+	}
 	virtualmachinebmclog.Info("Validation for VirtualMachineBMC upon update", "name", virtualmachinebmc.GetName())
 
-	// TODO(user): fill in your validation logic upon object update.
+	// The target virtual machine may be gone already, e.g., while the VirtualMachineBMC is being garbage-collected,
+	// so only its immutability is checked
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	if virtualmachinebmc.Spec.VirtualMachineNamespace != oldVirtualmachinebmc.Spec.VirtualMachineNamespace {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("vmNamespace"), "field is immutable"))
+	}
+	if virtualmachinebmc.Spec.VirtualMachineName != oldVirtualmachinebmc.Spec.VirtualMachineName {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("vmName"), "field is immutable"))
+	}
+	if oldVirtualmachinebmc.Spec.VirtualMachineUID != "" &&
+		virtualmachinebmc.Spec.VirtualMachineUID != oldVirtualmachinebmc.Spec.VirtualMachineUID {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("vmUID"), "field is immutable once set"))
+	}
+	allErrs = append(allErrs, validatePodTemplate(virtualmachinebmc.Spec.PodTemplate)...)
+
+	warnings, err := v.credentialWarnings(ctx, virtualmachinebmc)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil, nil
+	if len(allErrs) > 0 {
+		return warnings, invalid(virtualmachinebmc, allErrs)
+	}
+	return warnings, nil
+}
+
+// validateTarget checks that the target virtual machine exists and is not served by another VirtualMachineBMC. The
+// latter is best effort: the VirtualMachineBMCs created concurrently all pass, and the controller then lets the oldest
+// one serve the virtual machine while it reports the others Degraded.
+func (v *VirtualMachineBMCCustomValidator) validateTarget(
+	ctx context.Context,
+	virtualmachinebmc *virtualmachinev1alpha1.VirtualMachineBMC,
+) (field.ErrorList, error) {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	spec := virtualmachinebmc.Spec
+
+	if spec.VirtualMachineNamespace == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("vmNamespace"), "the namespace of the virtual machine is required"))
+	}
+	if spec.VirtualMachineName == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("vmName"), "the name of the virtual machine is required"))
+	}
+	if len(allErrs) > 0 {
+		return allErrs, nil
+	}
+
+	vmNamespacedName := types.NamespacedName{Namespace: spec.VirtualMachineNamespace, Name: spec.VirtualMachineName}
+	var vm kubevirtv1.VirtualMachine
+	if err := v.Reader.Get(ctx, vmNamespacedName, &vm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		return field.ErrorList{field.NotFound(specPath.Child("vmName"), vmNamespacedName.String())}, nil
+	}
+	if spec.VirtualMachineUID != "" && spec.VirtualMachineUID != vm.UID {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("vmUID"), spec.VirtualMachineUID,
+			fmt.Sprintf("virtual machine %s has UID %s", vmNamespacedName, vm.UID)))
+	}
+
+	var virtualmachinebmcs virtualmachinev1alpha1.VirtualMachineBMCList
+	if err := v.Reader.List(ctx, &virtualmachinebmcs, client.InNamespace(virtualmachinebmc.Namespace)); err != nil {
+		return nil, err
+	}
+	for _, other := range virtualmachinebmcs.Items {
+		// A VirtualMachineBMC being deleted is about to be replaced
+		if !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if other.Namespace == virtualmachinebmc.Namespace && other.Name == virtualmachinebmc.Name {
+			continue
+		}
+		if other.Spec.VirtualMachineNamespace == spec.VirtualMachineNamespace && other.Spec.VirtualMachineName == spec.VirtualMachineName {
+			allErrs = append(allErrs, field.Duplicate(specPath.Child("vmName"),
+				fmt.Sprintf("virtual machine %s is already served by VirtualMachineBMC %s/%s",
+					vmNamespacedName, other.Namespace, other.Name)))
+			break
+		}
+	}
+
+	return allErrs, nil
+}
+
+// validatePodTemplate denies the container security settings granting the virtBMC agent more privileges than it needs.
+// It holds the BMC credentials and access to the virtual machines, so it must not be able to escape its container.
+func validatePodTemplate(podTemplate *virtualmachinev1alpha1.PodTemplate) field.ErrorList {
+	if podTemplate == nil || podTemplate.ContainerSecurityContext == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	securityContext := podTemplate.ContainerSecurityContext
+	path := field.NewPath("spec", "podTemplate", "containerSecurityContext")
+
+	if securityContext.Privileged != nil && *securityContext.Privileged {
+		allErrs = append(allErrs, field.Forbidden(path.Child("privileged"), "privileged containers are not allowed"))
+	}
+	if securityContext.AllowPrivilegeEscalation != nil && *securityContext.AllowPrivilegeEscalation {
+		allErrs = append(allErrs, field.Forbidden(path.Child("allowPrivilegeEscalation"), "privilege escalation is not allowed"))
+	}
+	if securityContext.Capabilities != nil && len(securityContext.Capabilities.Add) > 0 {
+		allErrs = append(allErrs, field.Forbidden(path.Child("capabilities", "add"), "adding capabilities is not allowed"))
+	}
+
+	return allErrs
+}
+
+// credentialWarnings flags the credentials that make the BMC easy to take over. A missing Secret is not an error as it
+// may be created afterwards, which the CredentialsValid condition reflects.
+func (v *VirtualMachineBMCCustomValidator) credentialWarnings(
+	ctx context.Context,
+	virtualmachinebmc *virtualmachinev1alpha1.VirtualMachineBMC,
+) (admission.Warnings, error) {
+	spec := virtualmachinebmc.Spec
+
+	if ref := spec.CredentialsSecretRef; ref != nil && ref.Name != "" {
+		secretNamespacedName := types.NamespacedName{Namespace: virtualmachinebmc.Namespace, Name: ref.Name}
+		var secret corev1.Secret
+		if err := v.Reader.Get(ctx, secretNamespacedName, &secret); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			// The controller generates the Secret the defaulting webhook referred to
+			if virtualmachinebmc.Labels[ctlvirtualmachinebmc.GeneratedCredentialsLabel] == "true" &&
+				ref.Name == ctlvirtualmachinebmc.CredentialsSecretName(virtualmachinebmc.Name) {
+				return nil, nil
+			}
+			return admission.Warnings{fmt.Sprintf("spec.credentialsSecretRef: secret %s not found", secretNamespacedName)}, nil
+		}
+		username := string(secret.Data[corev1.BasicAuthUsernameKey])
+		password := string(secret.Data[corev1.BasicAuthPasswordKey])
+		if reason := weakPasswordReason(username, password); reason != "" {
+			return admission.Warnings{fmt.Sprintf("spec.credentialsSecretRef: secret %s %s", secretNamespacedName, reason)}, nil
+		}
+		return nil, nil
+	}
+
+	// The controller generates the credentials of the VirtualMachineBMCs configuring none
+	if spec.Username == "" && spec.Password == "" {
+		return nil, nil
+	}
+
+	warnings := admission.Warnings{"spec.username and spec.password are deprecated, use spec.credentialsSecretRef instead"}
+	if reason := weakPasswordReason(spec.Username, spec.Password); reason != "" {
+		warnings = append(warnings, "spec.password "+reason)
+	}
+	return warnings, nil
+}
+
+// weakPasswordReason tells why the password is weak, or returns an empty string if it isn't
+func weakPasswordReason(username, password string) string {
+	switch {
+	case password == "":
+		return "has an empty password"
+	case password == ctlvirtualmachinebmc.DefaultPassword || commonPasswords[strings.ToLower(password)]:
+		return "uses a default or well-known password"
+	case password == username:
+		return "uses the username as password"
+	case len(password) < minPasswordLength:
+		return fmt.Sprintf("uses a password shorter than %d characters", minPasswordLength)
+	}
+	return ""
+}
+
+func invalid(virtualmachinebmc *virtualmachinev1alpha1.VirtualMachineBMC, allErrs field.ErrorList) error {
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: virtualmachinev1alpha1.GroupVersion.Group, Kind: "VirtualMachineBMC"},
+		virtualmachinebmc.Name,
+		allErrs,
+	)
 }
 
 // ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type VirtualMachineBMC.
@@ -120,7 +355,5 @@ func (v *VirtualMachineBMCCustomValidator) ValidateDelete(ctx context.Context, o
 	}
 	virtualmachinebmclog.Info("Validation for VirtualMachineBMC upon deletion", "name", virtualmachinebmc.GetName())
 
-	// TODO(user): fill in your validation logic upon object deletion.
-
 	return nil, nil
 }
@@ -17,71 +17,271 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"strings"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	virtualmachinev1alpha1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
-	// TODO (user): Add any additional imports if needed
+	ctlvirtualmachinebmc "kubevirt.io/kubevirtbmc/internal/controller/virtualmachinebmc"
+	"kubevirt.io/kubevirtbmc/pkg/util"
 )
 
 var _ = Describe("VirtualMachineBMC Webhook", func() {
+	const (
+		testVirtualMachineBMCNamespace = "kubevirtbmc-system"
+		testVMNamespace                = "default"
+		testVMName                     = "test-vm"
+		testVMUID                      = types.UID("3a1f5c9e-0d1b-4c4e-9a43-5f3e1c1b2a77")
+		testSecretName                 = "test-credentials"
+	)
+
 	var (
 		obj       *virtualmachinev1alpha1.VirtualMachineBMC
 		oldObj    *virtualmachinev1alpha1.VirtualMachineBMC
 		validator VirtualMachineBMCCustomValidator
 		defaulter VirtualMachineBMCCustomDefaulter
+		objects   []runtime.Object
 	)
 
+	newVirtualMachineBMC := func(name string) *virtualmachinev1alpha1.VirtualMachineBMC {
+		return &virtualmachinev1alpha1.VirtualMachineBMC{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testVirtualMachineBMCNamespace,
+			},
+			Spec: virtualmachinev1alpha1.VirtualMachineBMCSpec{
+				CredentialsSecretRef:    &corev1.LocalObjectReference{Name: testSecretName},
+				VirtualMachineNamespace: testVMNamespace,
+				VirtualMachineName:      testVMName,
+			},
+		}
+	}
+
+	newClient := func() client.Client {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(kubevirtv1.AddToScheme(s)).To(Succeed())
+		Expect(virtualmachinev1alpha1.AddToScheme(s)).To(Succeed())
+		return fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(objects...).Build()
+	}
+
+	newValidator := func() VirtualMachineBMCCustomValidator {
+		return VirtualMachineBMCCustomValidator{Reader: newClient()}
+	}
+
 	BeforeEach(func() {
-		obj = &virtualmachinev1alpha1.VirtualMachineBMC{}
-		oldObj = &virtualmachinev1alpha1.VirtualMachineBMC{}
-		validator = VirtualMachineBMCCustomValidator{}
+		obj = newVirtualMachineBMC("default-test-vm")
+		oldObj = newVirtualMachineBMC("default-test-vm")
+		objects = []runtime.Object{
+			&kubevirtv1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testVMName,
+					Namespace: testVMNamespace,
+					UID:       testVMUID,
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testSecretName,
+					Namespace: testVirtualMachineBMCNamespace,
+				},
+				Data: map[string][]byte{
+					corev1.BasicAuthUsernameKey: []byte("operator"),
+					corev1.BasicAuthPasswordKey: []byte("Xk7#pQ2!vR9z"),
+				},
+			},
+		}
+		validator = newValidator()
 		Expect(validator).NotTo(BeNil(), "Expected validator to be initialized")
 		defaulter = VirtualMachineBMCCustomDefaulter{}
 		Expect(defaulter).NotTo(BeNil(), "Expected defaulter to be initialized")
 		Expect(oldObj).NotTo(BeNil(), "Expected oldObj to be initialized")
 		Expect(obj).NotTo(BeNil(), "Expected obj to be initialized")
-		// TODO (user): Add any setup logic common to all tests
 	})
 
-	AfterEach(func() {
-		// TODO (user): Add any teardown logic common to all tests
+	Context("When creating VirtualMachineBMC under Defaulting Webhook", func() {
+		It("Should default the Service settings", func() {
+			obj.Spec.Service = &virtualmachinev1alpha1.ServiceSpec{}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Service.Type).To(Equal(corev1.ServiceTypeClusterIP))
+			Expect(obj.Spec.Service.ExternalTrafficPolicy).To(BeEmpty())
+
+			obj.Spec.Service = &virtualmachinev1alpha1.ServiceSpec{Type: corev1.ServiceTypeNodePort}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Service.ExternalTrafficPolicy).To(Equal(corev1.ServiceExternalTrafficPolicyCluster))
+		})
 	})
 
-	Context("When creating VirtualMachineBMC under Defaulting Webhook", func() {
-		// TODO (user): Add logic for defaulting webhooks
-		// Example:
-		// It("Should apply defaults when a required field is empty", func() {
-		//     By("simulating a scenario where defaults should be applied")
-		//     obj.SomeFieldWithDefault = ""
-		//     By("calling the Default method to apply defaults")
-		//     defaulter.Default(ctx, obj)
-		//     By("checking that the default values are set")
-		//     Expect(obj.SomeFieldWithDefault).To(Equal("default_value"))
-		// })
+	Context("When creating VirtualMachineBMC without credentials under Defaulting Webhook", func() {
+		It("Should refer to the Secret generated by the controller", func() {
+			obj.Spec.CredentialsSecretRef = nil
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.CredentialsSecretRef).NotTo(BeNil())
+			Expect(obj.Spec.CredentialsSecretRef.Name).To(Equal("default-test-vm-credentials"))
+			Expect(obj.Labels).To(HaveKeyWithValue(ctlvirtualmachinebmc.GeneratedCredentialsLabel, "true"))
+
+			By("admitting it without warning although the Secret doesn't exist yet")
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("Should keep the configured credentials", func() {
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.CredentialsSecretRef.Name).To(Equal(testSecretName))
+			Expect(obj.Labels).NotTo(HaveKey(ctlvirtualmachinebmc.GeneratedCredentialsLabel))
+
+			obj.Spec.CredentialsSecretRef = nil
+			obj.Spec.Username = "operator"
+			obj.Spec.Password = "Xk7#pQ2!vR9z"
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.CredentialsSecretRef).To(BeNil())
+		})
 	})
 
 	Context("When creating or updating VirtualMachineBMC under Validating Webhook", func() {
-		// TODO (user): Add logic for validating webhooks
-		// Example:
-		// It("Should deny creation if a required field is missing", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = ""
-		//     Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
-		// })
-		//
-		// It("Should admit creation if all required fields are present", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = "valid_value"
-		//     Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
-		// })
-		//
-		// It("Should validate updates correctly", func() {
-		//     By("simulating a valid update scenario")
-		//     oldObj.SomeRequiredField = "updated_value"
-		//     obj.SomeRequiredField = "updated_value"
-		//     Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(BeNil())
-		// })
+		It("Should admit creation if the target VirtualMachine exists", func() {
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("Should deny creation if the target VirtualMachine is missing", func() {
+			By("leaving the target empty")
+			obj.Spec.VirtualMachineNamespace = ""
+			obj.Spec.VirtualMachineName = ""
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.vmNamespace"))
+			Expect(err.Error()).To(ContainSubstring("spec.vmName"))
+
+			By("pointing to a nonexistent VirtualMachine")
+			obj.Spec.VirtualMachineNamespace = testVMNamespace
+			obj.Spec.VirtualMachineName = "nonexistent"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("default/nonexistent"))
+		})
+
+		It("Should deny creation if the recorded UID doesn't match the VirtualMachine", func() {
+			obj.Spec.VirtualMachineUID = "00000000-0000-0000-0000-000000000000"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.vmUID"))
+		})
+
+		It("Should deny creation if the VirtualMachine already has a VirtualMachineBMC", func() {
+			objects = append(objects, newVirtualMachineBMC("existing"))
+			validator = newValidator()
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("kubevirtbmc-system/existing"))
+		})
+
+		It("Should deny creation outside of the kubevirtbmc-system namespace", func() {
+			obj.Namespace = testVMNamespace
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("metadata.namespace"))
+		})
+
+		It("Should deny creation if the name is too long", func() {
+			obj.Name = strings.Repeat("a", 64)
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("metadata.name"))
+		})
+
+		It("Should deny privileged container security settings", func() {
+			By("admitting an unprivileged container")
+			obj.Spec.PodTemplate = &virtualmachinev1alpha1.PodTemplate{
+				ContainerSecurityContext: &corev1.SecurityContext{
+					Privileged:               util.Ptr(false),
+					AllowPrivilegeEscalation: util.Ptr(false),
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("denying a privileged container on creation")
+			obj.Spec.PodTemplate.ContainerSecurityContext = &corev1.SecurityContext{
+				Privileged:               util.Ptr(true),
+				AllowPrivilegeEscalation: util.Ptr(true),
+				Capabilities:             &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}},
+			}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.podTemplate.containerSecurityContext.privileged"))
+			Expect(err.Error()).To(ContainSubstring("spec.podTemplate.containerSecurityContext.allowPrivilegeEscalation"))
+			Expect(err.Error()).To(ContainSubstring("spec.podTemplate.containerSecurityContext.capabilities.add"))
+
+			By("denying a privileged container on update")
+			_, err = validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.podTemplate.containerSecurityContext.privileged"))
+		})
+
+		It("Should warn about weak or default credentials", func() {
+			By("configuring no credentials")
+			obj.Spec.CredentialsSecretRef = nil
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+
+			By("configuring the default credentials inline")
+			obj.Spec.Username = "admin"
+			obj.Spec.Password = "password"
+			warnings, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("deprecated")))
+			Expect(warnings).To(ContainElement(ContainSubstring("well-known password")))
+
+			By("configuring a short password inline")
+			obj.Spec.Password = "s3cr#t"
+			warnings, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("shorter than 8 characters")))
+
+			By("referring to a nonexistent Secret")
+			obj.Spec.CredentialsSecretRef = &corev1.LocalObjectReference{Name: "nonexistent"}
+			warnings, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("not found")))
+		})
+
+		It("Should deny changes of the target VirtualMachine", func() {
+			By("changing the name of the VirtualMachine")
+			obj.Spec.VirtualMachineName = "another-vm"
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.vmName"))
+
+			By("changing the recorded UID")
+			obj.Spec.VirtualMachineName = testVMName
+			oldObj.Spec.VirtualMachineUID = testVMUID
+			obj.Spec.VirtualMachineUID = "00000000-0000-0000-0000-000000000000"
+			_, err = validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.vmUID"))
+		})
+
+		It("Should admit updates recording the UID", func() {
+			obj.Spec.VirtualMachineUID = testVMUID
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
 	})
 
 })
@@ -2,6 +2,7 @@ package builder
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 )
 
@@ -51,6 +52,22 @@ func (b *VirtualMachineBuilder) AddDisk(name string, bootOrder *uint) *VirtualMa
 	return b
 }
 
+func (b *VirtualMachineBuilder) AddCDRom(name string, bootOrder *uint) *VirtualMachineBuilder {
+	b.AddDisk(name, bootOrder)
+	disks := b.vm.Spec.Template.Spec.Domain.Devices.Disks
+	disks[len(disks)-1].CDRom = &kubevirtv1.CDRomTarget{}
+
+	return b
+}
+
+func (b *VirtualMachineBuilder) AddUSBDisk(name string, bootOrder *uint) *VirtualMachineBuilder {
+	b.AddDisk(name, bootOrder)
+	disks := b.vm.Spec.Template.Spec.Domain.Devices.Disks
+	disks[len(disks)-1].Disk = &kubevirtv1.DiskTarget{Bus: kubevirtv1.DiskBusUSB}
+
+	return b
+}
+
 func (b *VirtualMachineBuilder) AddInterface(name string, bootOrder *uint) *VirtualMachineBuilder {
 	intf := kubevirtv1.Interface{
 		Name: name,
@@ -67,7 +84,34 @@ func (b *VirtualMachineBuilder) AddInterface(name string, bootOrder *uint) *Virt
 	return b
 }
 
+func (b *VirtualMachineBuilder) FirmwareUUID(uuid string) *VirtualMachineBuilder {
+	b.firmware().UUID = types.UID(uuid)
+	return b
+}
+
+func (b *VirtualMachineBuilder) EFI() *VirtualMachineBuilder {
+	b.firmware().Bootloader = &kubevirtv1.Bootloader{
+		EFI: &kubevirtv1.EFI{},
+	}
+	return b
+}
+
+func (b *VirtualMachineBuilder) firmware() *kubevirtv1.Firmware {
+	if b.vm.Spec.Template == nil {
+		b.vm.Spec.Template = &kubevirtv1.VirtualMachineInstanceTemplateSpec{}
+	}
+	if b.vm.Spec.Template.Spec.Domain.Firmware == nil {
+		b.vm.Spec.Template.Spec.Domain.Firmware = &kubevirtv1.Firmware{}
+	}
+	return b.vm.Spec.Template.Spec.Domain.Firmware
+}
+
 func (b *VirtualMachineBuilder) Ready(ready bool) *VirtualMachineBuilder {
 	b.vm.Status.Ready = ready
 	return b
 }
+
+func (b *VirtualMachineBuilder) PrintableStatus(status kubevirtv1.VirtualMachinePrintableStatus) *VirtualMachineBuilder {
+	b.vm.Status.PrintableStatus = status
+	return b
+}
@@ -0,0 +1,134 @@
+package credential
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// UsernameKey is the file name (and Secret key) holding the BMC username
+	UsernameKey = "username"
+	// PasswordKey is the file name (and Secret key) holding the BMC password
+	PasswordKey = "password"
+	// VNCPasswordKey is the file name (and Secret key) holding the password of the VNC console, kept apart from the BMC
+	// password as the VNC authentication scheme only protects 8 characters
+	VNCPasswordKey = "vncPassword"
+
+	// GeneratedPasswordLength is the length of the generated passwords. IPMI v1.5 authentication doesn't accept
+	// passwords longer than 16 bytes.
+	GeneratedPasswordLength = 16
+	// GeneratedVNCPasswordLength is the length of the generated VNC passwords, the VNC authentication scheme ignoring
+	// the characters beyond 8
+	GeneratedVNCPasswordLength = 8
+
+	passwordChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// Credential is a pair of username and password accepted by the BMC
+type Credential struct {
+	Username string
+	Password string
+	// VNCPassword is the password of the VNC console, if any
+	VNCPassword string
+}
+
+// Provider returns the credential the BMC currently accepts. Implementations
+// may return a different credential on every call, e.g., after a rotation.
+type Provider interface {
+	Credential() (Credential, error)
+}
+
+type staticProvider struct {
+	credential Credential
+}
+
+// NewStaticProvider returns a Provider that always hands out the same credential
+func NewStaticProvider(username, password string) Provider {
+	return &staticProvider{
+		credential: Credential{
+			Username: username,
+			Password: password,
+		},
+	}
+}
+
+func (p *staticProvider) Credential() (Credential, error) {
+	return p.credential, nil
+}
+
+type fileProvider struct {
+	dir string
+}
+
+// NewFileProvider returns a Provider that reads the username and password
+// from the files named after UsernameKey and PasswordKey under dir, and the
+// VNC password from the optional one named after VNCPasswordKey. The files
+// are read on every call so that a Secret volume updated by the kubelet takes
+// effect without restarting the process.
+func NewFileProvider(dir string) Provider {
+	return &fileProvider{
+		dir: dir,
+	}
+}
+
+func (p *fileProvider) Credential() (Credential, error) {
+	username, err := p.read(UsernameKey)
+	if err != nil {
+		return Credential{}, err
+	}
+	password, err := p.read(PasswordKey)
+	if err != nil {
+		return Credential{}, err
+	}
+	vncPassword, err := p.read(VNCPasswordKey)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Credential{}, err
+	}
+	return Credential{
+		Username:    username,
+		Password:    password,
+		VNCPassword: vncPassword,
+	}, nil
+}
+
+func (p *fileProvider) read(key string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(p.dir, key))
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s: %w", key, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Verify reports whether username and password match the credential currently
+// handed out by the provider.
+func Verify(p Provider, username, password string) (bool, error) {
+	c, err := p.Credential()
+	if err != nil {
+		return false, err
+	}
+	usernameOK := subtle.ConstantTimeCompare([]byte(c.Username), []byte(username)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(c.Password), []byte(password)) == 1
+	return usernameOK && passwordOK, nil
+}
+
+// GeneratePassword returns a random password of the given length made of
+// letters and digits, which can be typed on any BMC client.
+func GeneratePassword(length int) (string, error) {
+	charCount := big.NewInt(int64(len(passwordChars)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, charCount)
+		if err != nil {
+			return "", fmt.Errorf("unable to generate password: %w", err)
+		}
+		b[i] = passwordChars[n.Int64()]
+	}
+	return string(b), nil
+}
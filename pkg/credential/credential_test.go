@@ -0,0 +1,76 @@
+package credential
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	p := NewStaticProvider("admin", "secret")
+
+	testCases := []struct {
+		name     string
+		username string
+		password string
+		expected bool
+	}{
+		{name: "valid credential", username: "admin", password: "secret", expected: true},
+		{name: "invalid username", username: "root", password: "secret", expected: false},
+		{name: "invalid password", username: "admin", password: "password", expected: false},
+		{name: "empty credential", username: "", password: "", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := Verify(p, tc.username, tc.password)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ok)
+		})
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	p := NewFileProvider(dir)
+
+	_, err := p.Credential()
+	assert.Error(t, err, "missing files should fail")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, UsernameKey), []byte("admin\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, PasswordKey), []byte("secret"), 0o600))
+
+	c, err := p.Credential()
+	require.NoError(t, err)
+	assert.Equal(t, Credential{Username: "admin", Password: "secret"}, c)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, VNCPasswordKey), []byte("vncs3cr3"), 0o600))
+	c, err = p.Credential()
+	require.NoError(t, err)
+	assert.Equal(t, Credential{Username: "admin", Password: "secret", VNCPassword: "vncs3cr3"}, c)
+
+	// Rotation is picked up without re-creating the provider
+	require.NoError(t, os.WriteFile(filepath.Join(dir, PasswordKey), []byte("rotated"), 0o600))
+
+	ok, err := Verify(p, "admin", "secret")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = Verify(p, "admin", "rotated")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestGeneratePassword(t *testing.T) {
+	password, err := GeneratePassword(GeneratedPasswordLength)
+	require.NoError(t, err)
+	assert.Len(t, password, GeneratedPasswordLength)
+	assert.Regexp(t, "^[A-Za-z0-9]+$", password)
+
+	another, err := GeneratePassword(GeneratedPasswordLength)
+	require.NoError(t, err)
+	assert.NotEqual(t, password, another)
+}
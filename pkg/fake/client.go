@@ -1,7 +1,12 @@
 package fake
 
 import (
+	"context"
+	"io"
+
 	"github.com/stretchr/testify/mock"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+
 	kubevirttypev1 "kubevirt.io/kubevirtbmc/pkg/generated/clientset/versioned/typed/core/v1"
 )
 
@@ -18,3 +23,41 @@ func (m *MockKubevirtClient) VirtualMachineInstances(namespace string) kubevirtt
 	args := m.Called(namespace)
 	return args.Get(0).(kubevirttypev1.VirtualMachineInstanceInterface)
 }
+
+func (m *MockKubevirtClient) SerialConsole(namespace, name string) (io.ReadWriteCloser, error) {
+	args := m.Called(namespace, name)
+	console, _ := args.Get(0).(io.ReadWriteCloser)
+	return console, args.Error(1)
+}
+
+func (m *MockKubevirtClient) VNC(namespace, name string) (io.ReadWriteCloser, error) {
+	args := m.Called(namespace, name)
+	console, _ := args.Get(0).(io.ReadWriteCloser)
+	return console, args.Error(1)
+}
+
+func (m *MockKubevirtClient) Stop(ctx context.Context, namespace, name string, options *kubevirtv1.StopOptions) error {
+	args := m.Called(ctx, namespace, name, options)
+	return args.Error(0)
+}
+
+func (m *MockKubevirtClient) Restart(
+	ctx context.Context, namespace, name string, options *kubevirtv1.RestartOptions,
+) error {
+	args := m.Called(ctx, namespace, name, options)
+	return args.Error(0)
+}
+
+func (m *MockKubevirtClient) Pause(
+	ctx context.Context, namespace, name string, options *kubevirtv1.PauseOptions,
+) error {
+	args := m.Called(ctx, namespace, name, options)
+	return args.Error(0)
+}
+
+func (m *MockKubevirtClient) Unpause(
+	ctx context.Context, namespace, name string, options *kubevirtv1.UnpauseOptions,
+) error {
+	args := m.Called(ctx, namespace, name, options)
+	return args.Error(0)
+}
@@ -17,7 +17,9 @@ type MockVirtualMachineInstanceInterface struct {
 func (m *MockVirtualMachineInstanceInterface) Get(
 	ctx context.Context, name string, options metav1.GetOptions,
 ) (*kubevirtv1.VirtualMachineInstance, error) {
-	panic("implement me")
+	args := m.Called(ctx, name, options)
+	vmi, _ := args.Get(0).(*kubevirtv1.VirtualMachineInstance)
+	return vmi, args.Error(1)
 }
 
 func (m *MockVirtualMachineInstanceInterface) Create(
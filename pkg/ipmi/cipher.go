@@ -0,0 +1,166 @@
+package ipmi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"hash"
+)
+
+// Authentication, integrity and confidentiality algorithm numbers per section 13.28
+const (
+	authRAKPHMACSHA1   = 0x01
+	authRAKPHMACSHA256 = 0x03
+
+	integrityHMACSHA196    = 0x01
+	integrityHMACSHA256128 = 0x04
+
+	confidentialityAESCBC128 = 0x01
+)
+
+// maxPasswordLength is the length of the user password (Kuid) in IPMI v2.0
+const maxPasswordLength = 20
+
+var (
+	// constant1 and constant2 are the constants K1 and K2 are derived from per section 13.32
+	constant1 = bytes.Repeat([]byte{0x01}, 20)
+	constant2 = bytes.Repeat([]byte{0x02}, 20)
+
+	errInvalidPayload = errors.New("invalid encrypted payload")
+)
+
+// cipherSuite is a combination of RMCP+ algorithms per section 22.15.2
+type cipherSuite struct {
+	id              uint8
+	auth            uint8
+	integrity       uint8
+	confidentiality uint8
+}
+
+// cipherSuites lists the supported cipher suites, the most preferred first. Only the suites providing both
+// integrity and confidentiality are offered.
+var cipherSuites = []cipherSuite{
+	{id: 17, auth: authRAKPHMACSHA256, integrity: integrityHMACSHA256128, confidentiality: confidentialityAESCBC128},
+	{id: 3, auth: authRAKPHMACSHA1, integrity: integrityHMACSHA196, confidentiality: confidentialityAESCBC128},
+}
+
+func findCipherSuite(auth, integrity, confidentiality uint8) *cipherSuite {
+	for i := range cipherSuites {
+		c := &cipherSuites[i]
+		if c.auth == auth && c.integrity == integrity && c.confidentiality == confidentiality {
+			return c
+		}
+	}
+	return nil
+}
+
+// authHMAC computes the HMAC of the authentication algorithm, used by the RAKP messages and the key derivation
+func (c *cipherSuite) authHMAC(key []byte, data ...[]byte) []byte {
+	return hmacSum(hashFunc(c.auth == authRAKPHMACSHA256), key, data...)
+}
+
+// integrityCheckLength is the length of the Integrity Check Value of RAKP message 4
+func (c *cipherSuite) integrityCheckLength() int {
+	if c.auth == authRAKPHMACSHA256 {
+		return 16
+	}
+	return 12
+}
+
+// authCode computes the AuthCode of the session trailer of a packet with the integrity algorithm
+func (c *cipherSuite) authCode(k1 []byte, data []byte) []byte {
+	if c.integrity == integrityHMACSHA256128 {
+		return hmacSum(sha256.New, k1, data)[:16]
+	}
+	return hmacSum(sha1.New, k1, data)[:12]
+}
+
+// authCodeLength is the length of the AuthCode of the session trailer
+func (c *cipherSuite) authCodeLength() int {
+	if c.integrity == integrityHMACSHA256128 {
+		return 16
+	}
+	return 12
+}
+
+func hashFunc(sha256Hash bool) func() hash.Hash {
+	if sha256Hash {
+		return sha256.New
+	}
+	return sha1.New
+}
+
+func hmacSum(h func() hash.Hash, key []byte, data ...[]byte) []byte {
+	mac := hmac.New(h, key)
+	for _, d := range data {
+		_, _ = mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// passwordKey returns the user key (Kuid) for a password
+func passwordKey(password string) []byte {
+	key := []byte(password)
+	if len(key) > maxPasswordLength {
+		key = key[:maxPasswordLength]
+	}
+	return key
+}
+
+// encryptAESCBC encrypts a payload with AES-CBC-128 per section 13.29, prepending the random initialization vector
+// and appending the confidentiality trailer
+func encryptAESCBC(key, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key[:aes.BlockSize])
+	if err != nil {
+		return nil, err
+	}
+
+	padLength := (aes.BlockSize - (len(payload)+1)%aes.BlockSize) % aes.BlockSize
+	plaintext := make([]byte, 0, len(payload)+padLength+1)
+	plaintext = append(plaintext, payload...)
+	for i := 1; i <= padLength; i++ {
+		plaintext = append(plaintext, byte(i))
+	}
+	plaintext = append(plaintext, byte(padLength))
+
+	out := make([]byte, aes.BlockSize+len(plaintext))
+	iv := out[:aes.BlockSize]
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out[aes.BlockSize:], plaintext)
+
+	return out, nil
+}
+
+// decryptAESCBC reverses encryptAESCBC
+func decryptAESCBC(key, data []byte) ([]byte, error) {
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, errInvalidPayload
+	}
+	block, err := aes.NewCipher(key[:aes.BlockSize])
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plaintext, data[aes.BlockSize:])
+
+	padLength := int(plaintext[len(plaintext)-1])
+	if padLength >= aes.BlockSize || padLength+1 > len(plaintext) {
+		return nil, errInvalidPayload
+	}
+	payloadLength := len(plaintext) - padLength - 1
+	for i := 0; i < padLength; i++ {
+		if plaintext[payloadLength+i] != byte(i+1) {
+			return nil, errInvalidPayload
+		}
+	}
+
+	return plaintext[:payloadLength], nil
+}
@@ -1,22 +1,201 @@
 package ipmi
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	goipmi "github.com/vmware/goipmi"
 
 	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
 )
 
+// Commands missing from the goipmi command numbers
+const (
+	commandSetACPIPowerState = goipmi.Command(0x06)
+	commandGetACPIPowerState = goipmi.Command(0x07)
+	commandGetSystemGUID     = goipmi.Command(0x37)
+)
+
+// System power states of the ACPI power state per section 20.6
+const (
+	// acpiSetSystemPowerState tells whether the system power state of the request is to be set
+	acpiSetSystemPowerState = 0x80
+	acpiPowerStateMask      = 0x7f
+
+	acpiPowerStateS0       = 0x00
+	acpiPowerStateS1       = 0x01
+	acpiPowerStateS2       = 0x02
+	acpiPowerStateS3       = 0x03
+	acpiPowerStateS5       = 0x05
+	acpiPowerStateSleeping = 0x08
+	acpiPowerStateG1       = 0x09
+	acpiPowerStateLegacyOn = 0x20
+)
+
+// Device power states of the ACPI power state per section 20.6
+const (
+	acpiDevicePowerStateD0 = 0x00
+	acpiDevicePowerStateD3 = 0x03
+)
+
+// Completion codes specific to the boot options commands per section 28.12 and 28.13
+const (
+	errBootParamNotSupported  = goipmi.CompletionCode(0x80)
+	errBootParamSetInProgress = goipmi.CompletionCode(0x81)
+)
+
+// Values of the set in progress parameter per section 28.13
+const (
+	bootParamSetComplete   = 0x00
+	bootParamSetInProgress = 0x01
+	bootParamCommitWrite   = 0x02
+)
+
+// bootParamDataLength is the length of the data of the boot option parameters that can be set per section 28.13
+var bootParamDataLength = map[uint8]int{
+	goipmi.BootParamSetInProgress: 1,
+	goipmi.BootParamInfoAck:       2,
+	goipmi.BootParamBootFlags:     5,
+}
+
+// Bits of the first byte of the boot flags parameter per section 28.13
+const (
+	bootFlagValid      = 0x80
+	bootFlagPersistent = 0x40
+	bootFlagEFI        = 0x20
+)
+
+// bootDeviceSelectorMask selects the boot device in the second byte of the boot flags parameter per section 28.13
+const bootDeviceSelectorMask = 0x3c
+
+// bootDeviceMap maps the boot device selectors to the devices of the virtual machine. Floppies are taken as any
+// removable media.
+var bootDeviceMap = map[goipmi.BootDevice]resourcemanager.BootDevice{
+	goipmi.BootDeviceNone:   resourcemanager.BootDeviceNone,
+	goipmi.BootDevicePxe:    resourcemanager.BootDevicePxe,
+	goipmi.BootDeviceDisk:   resourcemanager.BootDeviceHdd,
+	goipmi.BootDeviceCdrom:  resourcemanager.BootDeviceCd,
+	goipmi.BootDeviceFloppy: resourcemanager.BootDeviceUsb,
+}
+
+// powerRestorePolicyShift is the offset of the power restore policy in the current power state of the chassis status
+// per section 28.2
+const powerRestorePolicyShift = 5
+
+// powerRestorePolicyMap maps the restore policies of the virtual machine to the power restore policies
+var powerRestorePolicyMap = map[resourcemanager.PowerRestorePolicy]uint8{
+	resourcemanager.PowerRestorePolicyAlwaysOff: goipmi.PowerRestorePolicyAlwaysOff,
+	resourcemanager.PowerRestorePolicyLastState: goipmi.PowerRestorePolicyPrevious,
+	resourcemanager.PowerRestorePolicyAlwaysOn:  goipmi.PowerRestorePolicyAlwaysOn,
+	resourcemanager.PowerRestorePolicyUnknown:   goipmi.PowerRestorePolicyUnknown,
+}
+
+// deviceIDResponse per section 20.1. goipmi.DeviceIDResponse can't be used as its manufacturer ID is one byte short.
+type deviceIDResponse struct {
+	goipmi.CompletionCode
+	DeviceID                  uint8
+	DeviceRevision            uint8
+	FirmwareRevision1         uint8
+	FirmwareRevision2         uint8
+	IPMIVersion               uint8
+	AdditionalDeviceSupport   uint8
+	ManufacturerID            [3]uint8
+	ProductID                 uint16
+	AuxiliaryFirmwareRevision [4]uint8
+}
+
+// setACPIPowerStateRequest per section 20.6
+type setACPIPowerStateRequest struct {
+	SystemPowerState uint8
+	DevicePowerState uint8
+}
+
+// setACPIPowerStateResponse per section 20.6
+type setACPIPowerStateResponse struct {
+	goipmi.CompletionCode
+}
+
+// getACPIPowerStateResponse per section 20.7
+type getACPIPowerStateResponse struct {
+	goipmi.CompletionCode
+	SystemPowerState uint8
+	DevicePowerState uint8
+}
+
+// systemGUIDResponse per section 22.14
+type systemGUIDResponse struct {
+	goipmi.CompletionCode
+	GUID [16]uint8
+}
+
 type handler struct {
-	rm resourcemanager.ResourceManager
+	rm      resourcemanager.ResourceManager
+	version string
+
+	// The set in progress and boot info acknowledge boot option parameters are kept by the BMC itself
+	mu                  sync.Mutex
+	setInProgress       uint8
+	bootInfoAcknowledge uint8
 }
 
-func NewHandler(resourceManager resourcemanager.ResourceManager) *handler {
+func NewHandler(resourceManager resourcemanager.ResourceManager, version string) *handler {
 	return &handler{
-		rm: resourceManager,
+		rm:      resourceManager,
+		version: version,
+	}
+}
+
+func (h *handler) deviceIDHandler(*goipmi.Message) goipmi.Response {
+	// Development builds, e.g., "main-head", are reported as 0.0.0
+	var major, minor, patch uint
+	_, _ = fmt.Sscanf(strings.TrimPrefix(h.version, "v"), "%d.%d.%d", &major, &minor, &patch)
+	major = min(major, 0x7f)
+	minor = min(minor, 99)
+
+	return &deviceIDResponse{
+		CompletionCode:    goipmi.CommandCompleted,
+		DeviceID:          0x20,
+		FirmwareRevision1: uint8(major),
+		// The minor revision is BCD encoded
+		FirmwareRevision2: uint8(minor/10<<4 | minor%10),
+		// IPMI 2.0
+		IPMIVersion: 0x02,
+		// Chassis Device
+		AdditionalDeviceSupport:   0x80,
+		AuxiliaryFirmwareRevision: [4]uint8{uint8(min(patch, 0xff))},
 	}
 }
 
+func (h *handler) systemGUIDHandler(*goipmi.Message) goipmi.Response {
+	systemUUID, err := h.rm.GetSystemUUID()
+	if err != nil {
+		logrus.Errorf("unable to get the system UUID: %v", err)
+		return &systemGUIDResponse{
+			CompletionCode: goipmi.ErrInvalidState,
+		}
+	}
+	u, err := uuid.Parse(systemUUID)
+	if err != nil {
+		logrus.Errorf("invalid system UUID %q: %v", systemUUID, err)
+		return &systemGUIDResponse{
+			CompletionCode: goipmi.ErrUnspecified,
+		}
+	}
+
+	// The GUID is sent least significant byte first per section 20.8
+	res := &systemGUIDResponse{
+		CompletionCode: goipmi.CommandCompleted,
+	}
+	for i := range u {
+		res.GUID[i] = u[len(u)-1-i]
+	}
+	return res
+}
+
 func (h *handler) chassisControlHandler(m *goipmi.Message) goipmi.Response {
 	r := &goipmi.ChassisControlRequest{}
 	if err := m.Request(r); err != nil {
@@ -26,17 +205,31 @@ func (h *handler) chassisControlHandler(m *goipmi.Message) goipmi.Response {
 	var err error
 
 	switch r.ChassisControl {
-	case goipmi.ControlPowerDown, goipmi.ControlPowerAcpiSoft:
+	case goipmi.ControlPowerDown:
 		logrus.Info("power off")
-		err = h.rm.PowerOff()
+		err = h.rm.PowerOff(true)
+	case goipmi.ControlPowerAcpiSoft:
+		logrus.Info("soft off")
+		err = h.rm.PowerOff(false)
 	case goipmi.ControlPowerUp:
 		logrus.Info("power on")
 		err = h.rm.PowerOn()
 	case goipmi.ControlPowerCycle, goipmi.ControlPowerHardReset:
+		// Like on physical servers, the guest gets no chance to shut down
 		logrus.Info("power cycle")
-		err = h.rm.PowerCycle()
+		err = h.rm.PowerCycle(true)
+	case goipmi.ControlPowerPulseDiag:
+		logrus.Info("diagnostic interrupt")
+		err = h.rm.NMI()
 	}
 
+	// The command is supported, only the diagnostic interrupt value of its data field isn't
+	if errors.Is(err, resourcemanager.ErrNMINotSupported) {
+		logrus.Warn("diagnostic interrupt: not supported")
+		return &goipmi.ChassisControlResponse{
+			CompletionCode: goipmi.ErrInvalidPacket,
+		}
+	}
 	if err != nil {
 		return &goipmi.ChassisControlResponse{
 			CompletionCode: goipmi.ErrInvalidState,
@@ -51,49 +244,173 @@ func (h *handler) chassisControlHandler(m *goipmi.Message) goipmi.Response {
 func (h *handler) chassisStatusHandler(*goipmi.Message) goipmi.Response {
 	logrus.Info("power status")
 
-	isUp, err := h.rm.GetPowerStatus()
+	status, err := h.rm.GetChassisStatus()
 	if err != nil {
 		return &goipmi.ChassisStatusResponse{
 			CompletionCode: goipmi.ErrInvalidState,
 		}
 	}
-	if !isUp {
-		return &goipmi.ChassisStatusResponse{
+
+	res := &goipmi.ChassisStatusResponse{
+		CompletionCode: goipmi.CommandCompleted,
+		PowerState:     powerRestorePolicyMap[status.RestorePolicy] << powerRestorePolicyShift,
+	}
+	// The guest keeps running while powering off, and has yet to run while powering on
+	switch status.PowerState {
+	case resourcemanager.PowerStateOn, resourcemanager.PowerStatePoweringOff, resourcemanager.PowerStatePaused:
+		res.PowerState |= goipmi.SystemPower
+	}
+	if status.PowerFault {
+		res.PowerState |= goipmi.MainPowerFault
+		if status.PowerState == resourcemanager.PowerStateOff {
+			res.LastPowerEvent |= goipmi.PowerEventFault
+		}
+	}
+	// Pausing and resuming the guest leave it powered on, so that neither counts as powering it on
+	if event := status.LastPowerEvent; event != nil &&
+		(event.Action == resourcemanager.PowerActionOn || event.Action == resourcemanager.PowerActionCycle) {
+		res.LastPowerEvent |= goipmi.PowerEventCommand
+	}
+	if status.DriveFault {
+		res.State |= goipmi.DriveFault
+	}
+	return res
+}
+
+// setACPIPowerStateHandler pauses the guest when asked for a sleeping state, and resumes it when asked for the working
+// state. The device power state is ignored.
+func (h *handler) setACPIPowerStateHandler(m *goipmi.Message) goipmi.Response {
+	r := &setACPIPowerStateRequest{}
+	if err := m.Request(r); err != nil {
+		return err
+	}
+	if r.SystemPowerState&acpiSetSystemPowerState == 0 {
+		return &setACPIPowerStateResponse{
 			CompletionCode: goipmi.CommandCompleted,
-			PowerState:     goipmi.PowerOverload,
 		}
 	}
-	return &goipmi.ChassisStatusResponse{
+
+	var err error
+
+	switch state := r.SystemPowerState & acpiPowerStateMask; state {
+	case acpiPowerStateS0, acpiPowerStateLegacyOn:
+		logrus.Info("resume")
+		err = h.rm.Unpause()
+	case acpiPowerStateS1, acpiPowerStateS2, acpiPowerStateS3, acpiPowerStateSleeping, acpiPowerStateG1:
+		logrus.Info("pause")
+		err = h.rm.Pause()
+	default:
+		// The soft off states are left to the chassis control command
+		logrus.Warnf("unsupported ACPI system power state 0x%02x", state)
+		return &setACPIPowerStateResponse{
+			CompletionCode: goipmi.ErrInvalidPacket,
+		}
+	}
+
+	if err != nil {
+		logrus.Errorf("set ACPI power state: %v", err)
+		return &setACPIPowerStateResponse{
+			CompletionCode: goipmi.ErrInvalidState,
+		}
+	}
+
+	return &setACPIPowerStateResponse{
 		CompletionCode: goipmi.CommandCompleted,
-		PowerState:     goipmi.SystemPower,
 	}
 }
 
-func (h *handler) setSystemBootOptionsHandler(m *goipmi.Message) goipmi.Response {
-	logrus.Info("set boot device")
+// getACPIPowerStateHandler reports a paused guest as sleeping in S1, i.e., with its context kept
+func (h *handler) getACPIPowerStateHandler(*goipmi.Message) goipmi.Response {
+	status, err := h.rm.GetChassisStatus()
+	if err != nil {
+		return &getACPIPowerStateResponse{
+			CompletionCode: goipmi.ErrInvalidState,
+		}
+	}
 
+	res := &getACPIPowerStateResponse{
+		CompletionCode: goipmi.CommandCompleted,
+	}
+	switch status.PowerState {
+	case resourcemanager.PowerStateOn, resourcemanager.PowerStatePoweringOff:
+		res.SystemPowerState = acpiPowerStateS0
+		res.DevicePowerState = acpiDevicePowerStateD0
+	case resourcemanager.PowerStatePaused:
+		res.SystemPowerState = acpiPowerStateS1
+		res.DevicePowerState = acpiDevicePowerStateD0
+	default:
+		res.SystemPowerState = acpiPowerStateS5
+		res.DevicePowerState = acpiDevicePowerStateD3
+	}
+	return res
+}
+
+func (h *handler) setSystemBootOptionsHandler(m *goipmi.Message) goipmi.Response {
 	r := &goipmi.SetSystemBootOptionsRequest{}
 	if err := m.Request(r); err != nil {
 		return err
 	}
 
-	if r.Param != 5 {
+	// goipmi checks the length of the data for the parameter without its invalid bit only
+	param := r.Param & 0x7f
+	if length, ok := bootParamDataLength[param]; ok && len(r.Data) < length {
+		return &goipmi.SetSystemBootOptionsResponse{
+			CompletionCode: goipmi.ErrRequestData,
+		}
+	}
+
+	switch param {
+	case goipmi.BootParamSetInProgress:
+		return h.setBootParamSetInProgress(r.Data[0] & 0x03)
+	case goipmi.BootParamInfoAck:
+		return h.setBootParamInfoAcknowledge(r.Data[0], r.Data[1])
+	case goipmi.BootParamBootFlags:
+		return h.setBootParamBootFlags(r.Data)
+	default:
+		return &goipmi.SetSystemBootOptionsResponse{
+			CompletionCode: errBootParamNotSupported,
+		}
+	}
+}
+
+func (h *handler) setBootParamBootFlags(flags []uint8) goipmi.Response {
+	logrus.Info("set boot device")
+
+	// The boot flags are ignored unless marked as valid
+	if flags[0]&bootFlagValid == 0 {
 		return &goipmi.SetSystemBootOptionsResponse{
 			CompletionCode: goipmi.CommandCompleted,
 		}
 	}
+	persistent := flags[0]&bootFlagPersistent != 0
+	efi := flags[0]&bootFlagEFI != 0
 
-	var device resourcemanager.BootDevice
-	switch r.Data[1] {
-	case uint8(goipmi.BootDevicePxe):
-		logrus.Infof("set bootdev pxe")
-		device = resourcemanager.BootDevicePxe
-	case uint8(goipmi.BootDeviceDisk):
-		logrus.Infof("set bootdev disk")
-		device = resourcemanager.BootDeviceHdd
+	selector := goipmi.BootDevice(flags[1] & bootDeviceSelectorMask)
+	if selector == goipmi.BootDeviceBios {
+		// KubeVirt offers no way to make the firmware of a virtual machine enter its setup on the next boot, the
+		// setup being reachable from the VNC console only, by pressing the key the firmware prompts for while booting
+		logrus.Warn("entering the BIOS setup is not supported")
+		return &goipmi.SetSystemBootOptionsResponse{
+			CompletionCode: goipmi.ErrInvalidState,
+		}
 	}
+	device, ok := bootDeviceMap[selector]
+	if !ok {
+		// Virtual machines have no remote media
+		logrus.Warnf("unsupported boot device selector 0x%02x", uint8(selector))
+		return &goipmi.SetSystemBootOptionsResponse{
+			CompletionCode: goipmi.ErrInvalidPacket,
+		}
+	}
+	logrus.Infof("set bootdev %s", selector)
 
-	err := h.rm.SetBootDevice(device)
+	err := h.rm.SetBootDevice(device, persistent, efi)
+	if errors.Is(err, resourcemanager.ErrBootDeviceNotFound) {
+		logrus.Errorf("set bootdev %s: %v", selector, err)
+		return &goipmi.SetSystemBootOptionsResponse{
+			CompletionCode: goipmi.ErrNoObj,
+		}
+	}
 	if err != nil {
 		return &goipmi.SetSystemBootOptionsResponse{
 			CompletionCode: goipmi.ErrUnspecified,
@@ -104,3 +421,104 @@ func (h *handler) setSystemBootOptionsHandler(m *goipmi.Message) goipmi.Response
 		CompletionCode: goipmi.CommandCompleted,
 	}
 }
+
+func (h *handler) setBootParamInfoAcknowledge(mask, data uint8) goipmi.Response {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.bootInfoAcknowledge = h.bootInfoAcknowledge&^mask | data&mask
+
+	return &goipmi.SetSystemBootOptionsResponse{
+		CompletionCode: goipmi.CommandCompleted,
+	}
+}
+
+func (h *handler) setBootParamSetInProgress(state uint8) goipmi.Response {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch state {
+	case bootParamSetInProgress:
+		if h.setInProgress == bootParamSetInProgress {
+			return &goipmi.SetSystemBootOptionsResponse{
+				CompletionCode: errBootParamSetInProgress,
+			}
+		}
+		h.setInProgress = bootParamSetInProgress
+	case bootParamSetComplete, bootParamCommitWrite:
+		// The parameters are applied as they are written, there is nothing left to commit
+		h.setInProgress = bootParamSetComplete
+	default:
+		return &goipmi.SetSystemBootOptionsResponse{
+			CompletionCode: goipmi.ErrInvalidPacket,
+		}
+	}
+
+	return &goipmi.SetSystemBootOptionsResponse{
+		CompletionCode: goipmi.CommandCompleted,
+	}
+}
+
+func (h *handler) getSystemBootOptionsHandler(m *goipmi.Message) goipmi.Response {
+	r := &goipmi.SystemBootOptionsRequest{}
+	if err := m.Request(r); err != nil {
+		return err
+	}
+
+	var data []uint8
+	param := r.Param & 0x7f
+	switch param {
+	case goipmi.BootParamSetInProgress:
+		h.mu.Lock()
+		data = []uint8{h.setInProgress}
+		h.mu.Unlock()
+	case goipmi.BootParamInfoAck:
+		h.mu.Lock()
+		data = []uint8{0x00, h.bootInfoAcknowledge}
+		h.mu.Unlock()
+	case goipmi.BootParamBootFlags:
+		logrus.Info("get boot device")
+		options, err := h.rm.GetBootOptions()
+		if err != nil {
+			logrus.Errorf("unable to get the boot options: %v", err)
+			return goipmi.ErrUnspecified
+		}
+		data = bootFlags(options)
+	default:
+		return errBootParamNotSupported
+	}
+
+	return &goipmi.SystemBootOptionsResponse{
+		CompletionCode: goipmi.CommandCompleted,
+		Version:        0x01,
+		Param:          param,
+		Data:           data,
+	}
+}
+
+// bootFlags encodes the boot flags parameter per section 28.13
+func bootFlags(options *resourcemanager.BootOptions) []uint8 {
+	flags := make([]uint8, 5)
+
+	switch options.Device {
+	case resourcemanager.BootDevicePxe:
+		flags[1] = uint8(goipmi.BootDevicePxe)
+	case resourcemanager.BootDeviceHdd:
+		flags[1] = uint8(goipmi.BootDeviceDisk)
+	case resourcemanager.BootDeviceCd:
+		flags[1] = uint8(goipmi.BootDeviceCdrom)
+	case resourcemanager.BootDeviceUsb:
+		flags[1] = uint8(goipmi.BootDeviceFloppy)
+	}
+	if flags[1] != uint8(goipmi.BootDeviceNone) {
+		flags[0] |= bootFlagValid
+	}
+	if options.Persistent {
+		flags[0] |= bootFlagPersistent
+	}
+	if options.EFI {
+		flags[0] |= bootFlagEFI
+	}
+
+	return flags
+}
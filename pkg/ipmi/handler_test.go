@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	goipmi "github.com/vmware/goipmi"
 	"go.uber.org/mock/gomock"
 
@@ -16,7 +17,7 @@ func TestChassisControlHandler(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRM := resourcemanager.NewMockResourceManager(ctrl)
-	handler := NewHandler(mockRM)
+	handler := NewHandler(mockRM, "v0.5.1")
 
 	testCases := []struct {
 		name           string
@@ -44,7 +45,15 @@ func TestChassisControlHandler(t *testing.T) {
 			name:           "PowerOff success",
 			chassisControl: goipmi.ControlPowerDown,
 			expectedCall: func() {
-				mockRM.EXPECT().PowerOff().Return(nil)
+				mockRM.EXPECT().PowerOff(true).Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:           "SoftOff success",
+			chassisControl: goipmi.ControlPowerAcpiSoft,
+			expectedCall: func() {
+				mockRM.EXPECT().PowerOff(false).Return(nil)
 			},
 			expectedCode: goipmi.CommandCompleted,
 		},
@@ -52,7 +61,7 @@ func TestChassisControlHandler(t *testing.T) {
 			name:           "PowerOff failure",
 			chassisControl: goipmi.ControlPowerDown,
 			expectedCall: func() {
-				mockRM.EXPECT().PowerOff().Return(fmt.Errorf("error"))
+				mockRM.EXPECT().PowerOff(true).Return(fmt.Errorf("error"))
 			},
 			expectedCode: goipmi.ErrInvalidState,
 		},
@@ -60,7 +69,15 @@ func TestChassisControlHandler(t *testing.T) {
 			name:           "PowerCycle success",
 			chassisControl: goipmi.ControlPowerCycle,
 			expectedCall: func() {
-				mockRM.EXPECT().PowerCycle().Return(nil)
+				mockRM.EXPECT().PowerCycle(true).Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:           "HardReset success",
+			chassisControl: goipmi.ControlPowerHardReset,
+			expectedCall: func() {
+				mockRM.EXPECT().PowerCycle(true).Return(nil)
 			},
 			expectedCode: goipmi.CommandCompleted,
 		},
@@ -68,10 +85,26 @@ func TestChassisControlHandler(t *testing.T) {
 			name:           "PowerCycle failure",
 			chassisControl: goipmi.ControlPowerCycle,
 			expectedCall: func() {
-				mockRM.EXPECT().PowerCycle().Return(fmt.Errorf("error"))
+				mockRM.EXPECT().PowerCycle(true).Return(fmt.Errorf("error"))
 			},
 			expectedCode: goipmi.ErrInvalidState,
 		},
+		{
+			name:           "DiagnosticInterrupt success",
+			chassisControl: goipmi.ControlPowerPulseDiag,
+			expectedCall: func() {
+				mockRM.EXPECT().NMI().Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:           "DiagnosticInterrupt not supported",
+			chassisControl: goipmi.ControlPowerPulseDiag,
+			expectedCall: func() {
+				mockRM.EXPECT().NMI().Return(resourcemanager.ErrNMINotSupported)
+			},
+			expectedCode: goipmi.ErrInvalidPacket,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -96,42 +129,122 @@ func TestChassisStatusHandler(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRM := resourcemanager.NewMockResourceManager(ctrl)
-	handler := NewHandler(mockRM)
+	handler := NewHandler(mockRM, "v0.5.1")
 
 	testCases := []struct {
-		name           string
-		expectedStatus uint8
-		expectedCall   func()
-		expectedCode   goipmi.CompletionCode
+		name         string
+		status       *resourcemanager.ChassisStatus
+		err          error
+		expected     *goipmi.ChassisStatusResponse
+		expectedCode goipmi.CompletionCode
 	}{
 		{
-			name:           "PowerStatus on",
-			expectedStatus: goipmi.SystemPower,
-			expectedCall: func() {
-				mockRM.EXPECT().GetPowerStatus().Return(true, nil)
+			name: "Powered on through the BMC",
+			status: &resourcemanager.ChassisStatus{
+				PowerState:     resourcemanager.PowerStateOn,
+				RestorePolicy:  resourcemanager.PowerRestorePolicyLastState,
+				LastPowerEvent: &resourcemanager.PowerEvent{Action: resourcemanager.PowerActionOn},
+			},
+			expected: &goipmi.ChassisStatusResponse{
+				PowerState:     goipmi.SystemPower | goipmi.PowerRestorePolicyPrevious<<5,
+				LastPowerEvent: goipmi.PowerEventCommand,
 			},
 			expectedCode: goipmi.CommandCompleted,
 		},
 		{
-			name:           "PowerStatus off",
-			expectedStatus: goipmi.PowerOverload,
-			expectedCall: func() {
-				mockRM.EXPECT().GetPowerStatus().Return(false, nil)
+			name: "Powered off through the BMC",
+			status: &resourcemanager.ChassisStatus{
+				PowerState:     resourcemanager.PowerStateOff,
+				RestorePolicy:  resourcemanager.PowerRestorePolicyAlwaysOff,
+				LastPowerEvent: &resourcemanager.PowerEvent{Action: resourcemanager.PowerActionOff},
 			},
+			expected:     &goipmi.ChassisStatusResponse{},
 			expectedCode: goipmi.CommandCompleted,
 		},
 		{
-			name: "PowerStatus error",
-			expectedCall: func() {
-				mockRM.EXPECT().GetPowerStatus().Return(false, fmt.Errorf("error"))
+			name: "Powering on",
+			status: &resourcemanager.ChassisStatus{
+				PowerState:    resourcemanager.PowerStatePoweringOn,
+				RestorePolicy: resourcemanager.PowerRestorePolicyAlwaysOn,
+			},
+			expected: &goipmi.ChassisStatusResponse{
+				PowerState: goipmi.PowerRestorePolicyAlwaysOn << 5,
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name: "Powering off",
+			status: &resourcemanager.ChassisStatus{
+				PowerState:     resourcemanager.PowerStatePoweringOff,
+				RestorePolicy:  resourcemanager.PowerRestorePolicyAlwaysOff,
+				LastPowerEvent: &resourcemanager.PowerEvent{Action: resourcemanager.PowerActionCycle},
+			},
+			expected: &goipmi.ChassisStatusResponse{
+				PowerState:     goipmi.SystemPower,
+				LastPowerEvent: goipmi.PowerEventCommand,
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name: "Paused",
+			status: &resourcemanager.ChassisStatus{
+				PowerState:    resourcemanager.PowerStatePaused,
+				RestorePolicy: resourcemanager.PowerRestorePolicyAlwaysOn,
 			},
+			expected: &goipmi.ChassisStatusResponse{
+				PowerState: goipmi.SystemPower | goipmi.PowerRestorePolicyAlwaysOn<<5,
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name: "Paused through the BMC after powering on",
+			status: &resourcemanager.ChassisStatus{
+				PowerState:     resourcemanager.PowerStatePaused,
+				RestorePolicy:  resourcemanager.PowerRestorePolicyAlwaysOn,
+				LastPowerEvent: &resourcemanager.PowerEvent{Action: resourcemanager.PowerActionPause},
+			},
+			expected: &goipmi.ChassisStatusResponse{
+				PowerState: goipmi.SystemPower | goipmi.PowerRestorePolicyAlwaysOn<<5,
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name: "Resumed through the BMC",
+			status: &resourcemanager.ChassisStatus{
+				PowerState:     resourcemanager.PowerStateOn,
+				RestorePolicy:  resourcemanager.PowerRestorePolicyAlwaysOn,
+				LastPowerEvent: &resourcemanager.PowerEvent{Action: resourcemanager.PowerActionResume},
+			},
+			expected: &goipmi.ChassisStatusResponse{
+				PowerState: goipmi.SystemPower | goipmi.PowerRestorePolicyAlwaysOn<<5,
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name: "Failed with missing volumes",
+			status: &resourcemanager.ChassisStatus{
+				PowerState:    resourcemanager.PowerStateOff,
+				RestorePolicy: resourcemanager.PowerRestorePolicyUnknown,
+				PowerFault:    true,
+				DriveFault:    true,
+			},
+			expected: &goipmi.ChassisStatusResponse{
+				PowerState:     goipmi.MainPowerFault | goipmi.PowerRestorePolicyUnknown<<5,
+				LastPowerEvent: goipmi.PowerEventFault,
+				State:          goipmi.DriveFault,
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:         "PowerStatus error",
+			err:          fmt.Errorf("error"),
 			expectedCode: goipmi.ErrInvalidState,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.expectedCall()
+			mockRM.EXPECT().GetChassisStatus().Return(tc.status, tc.err)
 
 			message := &goipmi.Message{}
 
@@ -140,8 +253,9 @@ func TestChassisStatusHandler(t *testing.T) {
 			assert.IsType(t, &goipmi.ChassisStatusResponse{}, response)
 			res, _ := response.(*goipmi.ChassisStatusResponse)
 			assert.Equal(t, tc.expectedCode, res.CompletionCode)
-			if tc.expectedStatus != 0 {
-				assert.Equal(t, tc.expectedStatus, res.PowerState)
+			if tc.expected != nil {
+				tc.expected.CompletionCode = tc.expectedCode
+				assert.Equal(t, tc.expected, res)
 			}
 		})
 	}
@@ -152,46 +266,135 @@ func TestSetSystemBootOptionsHandler(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRM := resourcemanager.NewMockResourceManager(ctrl)
-	handler := NewHandler(mockRM)
+	handler := NewHandler(mockRM, "v0.5.1")
 
 	testCases := []struct {
 		name         string
+		flags        uint8
 		bootDevice   goipmi.BootDevice
 		expectedCall func()
 		expectedCode goipmi.CompletionCode
 	}{
 		{
 			name:       "SetSystemBootOptions with PXE success",
+			flags:      bootFlagValid,
 			bootDevice: goipmi.BootDevicePxe,
 			expectedCall: func() {
-				mockRM.EXPECT().SetBootDevice(gomock.Any()).Return(nil)
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe, false, false).Return(nil)
 			},
 			expectedCode: goipmi.CommandCompleted,
 		},
 		{
 			name:       "SetSystemBootOptions with PXE failed",
+			flags:      bootFlagValid,
 			bootDevice: goipmi.BootDevicePxe,
 			expectedCall: func() {
-				mockRM.EXPECT().SetBootDevice(gomock.Any()).Return(fmt.Errorf("error"))
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe, false, false).Return(fmt.Errorf("error"))
 			},
 			expectedCode: goipmi.ErrUnspecified,
 		},
 		{
 			name:       "SetSystemBootOptions with disk success",
+			flags:      bootFlagValid,
 			bootDevice: goipmi.BootDeviceDisk,
 			expectedCall: func() {
-				mockRM.EXPECT().SetBootDevice(gomock.Any()).Return(nil)
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd, false, false).Return(nil)
 			},
 			expectedCode: goipmi.CommandCompleted,
 		},
 		{
 			name:       "SetSystemBootOptions with disk failed",
+			flags:      bootFlagValid,
 			bootDevice: goipmi.BootDeviceDisk,
 			expectedCall: func() {
-				mockRM.EXPECT().SetBootDevice(gomock.Any()).Return(fmt.Errorf("error"))
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd, false, false).Return(fmt.Errorf("error"))
 			},
 			expectedCode: goipmi.ErrUnspecified,
 		},
+		{
+			name:       "SetSystemBootOptions with persistent PXE",
+			flags:      bootFlagValid | bootFlagPersistent,
+			bootDevice: goipmi.BootDevicePxe,
+			expectedCall: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe, true, false).Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:       "SetSystemBootOptions with EFI disk",
+			flags:      bootFlagValid | bootFlagEFI,
+			bootDevice: goipmi.BootDeviceDisk,
+			expectedCall: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd, false, true).Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:       "SetSystemBootOptions with CD-ROM success",
+			flags:      bootFlagValid,
+			bootDevice: goipmi.BootDeviceCdrom,
+			expectedCall: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceCd, false, false).Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:       "SetSystemBootOptions with CD-ROM missing",
+			flags:      bootFlagValid,
+			bootDevice: goipmi.BootDeviceCdrom,
+			expectedCall: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceCd, false, false).
+					Return(fmt.Errorf("%w: no cdrom", resourcemanager.ErrBootDeviceNotFound))
+			},
+			expectedCode: goipmi.ErrNoObj,
+		},
+		{
+			name:       "SetSystemBootOptions with removable media",
+			flags:      bootFlagValid | bootFlagPersistent,
+			bootDevice: goipmi.BootDeviceFloppy,
+			expectedCall: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceUsb, true, false).Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:       "SetSystemBootOptions with no override",
+			flags:      bootFlagValid,
+			bootDevice: goipmi.BootDeviceNone,
+			expectedCall: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceNone, false, false).Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:       "SetSystemBootOptions with CMOS clear and PXE",
+			flags:      bootFlagValid,
+			bootDevice: goipmi.BootDevicePxe | 0x80,
+			expectedCall: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe, false, false).Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:         "SetSystemBootOptions with BIOS setup",
+			flags:        bootFlagValid,
+			bootDevice:   goipmi.BootDeviceBios,
+			expectedCall: func() {},
+			expectedCode: goipmi.ErrInvalidState,
+		},
+		{
+			name:         "SetSystemBootOptions with remote CD-ROM",
+			flags:        bootFlagValid,
+			bootDevice:   goipmi.BootDeviceRemoteCdrom,
+			expectedCall: func() {},
+			expectedCode: goipmi.ErrInvalidPacket,
+		},
+		{
+			name:         "SetSystemBootOptions with invalid boot flags",
+			bootDevice:   goipmi.BootDevicePxe,
+			expectedCall: func() {},
+			expectedCode: goipmi.CommandCompleted,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -199,7 +402,7 @@ func TestSetSystemBootOptionsHandler(t *testing.T) {
 			tc.expectedCall()
 
 			message := &goipmi.Message{
-				Data: []byte{5, uint8(tc.bootDevice), 0, 0, 0, 0},
+				Data: []byte{5, tc.flags, uint8(tc.bootDevice), 0, 0, 0},
 			}
 
 			response := handler.setSystemBootOptionsHandler(message)
@@ -210,3 +413,388 @@ func TestSetSystemBootOptionsHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestSetSystemBootOptionsRequestLength(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	handler := NewHandler(mockRM, "v0.5.1")
+
+	testCases := []struct {
+		name         string
+		data         []byte
+		expectedCall func()
+		expectedCode goipmi.CompletionCode
+	}{
+		{
+			name:         "Short boot flags",
+			data:         []byte{goipmi.BootParamBootFlags, bootFlagValid},
+			expectedCall: func() {},
+			expectedCode: goipmi.ErrShortPacket,
+		},
+		{
+			name:         "Short boot flags marked invalid",
+			data:         []byte{0x80 | goipmi.BootParamBootFlags, bootFlagValid},
+			expectedCall: func() {},
+			expectedCode: goipmi.ErrRequestData,
+		},
+		{
+			name:         "Short boot info acknowledge marked invalid",
+			data:         []byte{0x80 | goipmi.BootParamInfoAck, 0x01},
+			expectedCall: func() {},
+			expectedCode: goipmi.ErrRequestData,
+		},
+		{
+			name: "Boot flags marked invalid",
+			data: []byte{0x80 | goipmi.BootParamBootFlags, bootFlagValid, uint8(goipmi.BootDevicePxe), 0, 0, 0},
+			expectedCall: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe, false, false).Return(nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.expectedCall()
+
+			response := handler.setSystemBootOptionsHandler(&goipmi.Message{Data: tc.data})
+
+			assert.Equal(t, uint8(tc.expectedCode), response.Code())
+		})
+	}
+}
+
+func TestDeviceIDHandler(t *testing.T) {
+	testCases := []struct {
+		name                     string
+		version                  string
+		expectedFirmwareRevision [2]uint8
+		expectedAuxiliary        uint8
+	}{
+		{
+			name:                     "Release version",
+			version:                  "v0.5.1",
+			expectedFirmwareRevision: [2]uint8{0x00, 0x05},
+			expectedAuxiliary:        0x01,
+		},
+		{
+			name:                     "Release candidate version",
+			version:                  "v1.12.0-rc.1",
+			expectedFirmwareRevision: [2]uint8{0x01, 0x12},
+			expectedAuxiliary:        0x00,
+		},
+		{
+			name:                     "Development version",
+			version:                  "main-head",
+			expectedFirmwareRevision: [2]uint8{0x00, 0x00},
+			expectedAuxiliary:        0x00,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewHandler(nil, tc.version)
+
+			response := handler.deviceIDHandler(&goipmi.Message{})
+
+			assert.IsType(t, &deviceIDResponse{}, response)
+			res, _ := response.(*deviceIDResponse)
+			assert.Equal(t, goipmi.CommandCompleted, res.CompletionCode)
+			assert.Equal(t, tc.expectedFirmwareRevision, [2]uint8{res.FirmwareRevision1, res.FirmwareRevision2})
+			assert.Equal(t, tc.expectedAuxiliary, res.AuxiliaryFirmwareRevision[0])
+			assert.Equal(t, uint8(0x02), res.IPMIVersion)
+			assert.Len(t, responseDataToBytes(response), 16)
+		})
+	}
+}
+
+func TestSystemGUIDHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	handler := NewHandler(mockRM, "v0.5.1")
+
+	testCases := []struct {
+		name         string
+		expectedCall func()
+		expectedCode goipmi.CompletionCode
+		expectedGUID [16]uint8
+	}{
+		{
+			name: "GetSystemGUID success",
+			expectedCall: func() {
+				mockRM.EXPECT().GetSystemUUID().Return("5e1a4c6f-31b2-4d8e-9a07-c2f3b4d5e6f7", nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+			expectedGUID: [16]uint8{
+				0xf7, 0xe6, 0xd5, 0xb4, 0xf3, 0xc2, 0x07, 0x9a, 0x8e, 0x4d, 0xb2, 0x31, 0x6f, 0x4c, 0x1a, 0x5e,
+			},
+		},
+		{
+			name: "GetSystemGUID failure",
+			expectedCall: func() {
+				mockRM.EXPECT().GetSystemUUID().Return("", fmt.Errorf("error"))
+			},
+			expectedCode: goipmi.ErrInvalidState,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.expectedCall()
+
+			response := handler.systemGUIDHandler(&goipmi.Message{})
+
+			assert.IsType(t, &systemGUIDResponse{}, response)
+			res, _ := response.(*systemGUIDResponse)
+			assert.Equal(t, tc.expectedCode, res.CompletionCode)
+			assert.Equal(t, tc.expectedGUID, res.GUID)
+		})
+	}
+}
+
+func TestSetACPIPowerStateHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	handler := NewHandler(mockRM, "v0.5.1")
+
+	testCases := []struct {
+		name         string
+		data         []byte
+		expectedCall func()
+		expectedCode goipmi.CompletionCode
+	}{
+		{
+			name:         "Sleeping state pauses",
+			data:         []byte{acpiSetSystemPowerState | acpiPowerStateS1, 0x7f},
+			expectedCall: func() { mockRM.EXPECT().Pause().Return(nil) },
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:         "Working state resumes",
+			data:         []byte{acpiSetSystemPowerState | acpiPowerStateS0, 0x7f},
+			expectedCall: func() { mockRM.EXPECT().Unpause().Return(nil) },
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:         "Resume failure",
+			data:         []byte{acpiSetSystemPowerState | acpiPowerStateLegacyOn, 0x7f},
+			expectedCall: func() { mockRM.EXPECT().Unpause().Return(fmt.Errorf("not paused")) },
+			expectedCode: goipmi.ErrInvalidState,
+		},
+		{
+			name:         "System power state left unchanged",
+			data:         []byte{acpiPowerStateS1, acpiDevicePowerStateD0},
+			expectedCall: func() {},
+			expectedCode: goipmi.CommandCompleted,
+		},
+		{
+			name:         "Soft off state not supported",
+			data:         []byte{acpiSetSystemPowerState | acpiPowerStateS5, 0x7f},
+			expectedCall: func() {},
+			expectedCode: goipmi.ErrInvalidPacket,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.expectedCall()
+
+			response := handler.setACPIPowerStateHandler(&goipmi.Message{Data: tc.data})
+
+			assert.Equal(t, uint8(tc.expectedCode), response.Code())
+		})
+	}
+}
+
+func TestGetACPIPowerStateHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	handler := NewHandler(mockRM, "v0.5.1")
+
+	testCases := []struct {
+		powerState resourcemanager.PowerState
+		expected   *getACPIPowerStateResponse
+	}{
+		{
+			powerState: resourcemanager.PowerStateOn,
+			expected:   &getACPIPowerStateResponse{SystemPowerState: acpiPowerStateS0},
+		},
+		{
+			powerState: resourcemanager.PowerStatePaused,
+			expected:   &getACPIPowerStateResponse{SystemPowerState: acpiPowerStateS1},
+		},
+		{
+			powerState: resourcemanager.PowerStateOff,
+			expected: &getACPIPowerStateResponse{
+				SystemPowerState: acpiPowerStateS5,
+				DevicePowerState: acpiDevicePowerStateD3,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.powerState), func(t *testing.T) {
+			mockRM.EXPECT().GetChassisStatus().Return(&resourcemanager.ChassisStatus{PowerState: tc.powerState}, nil)
+
+			response := handler.getACPIPowerStateHandler(&goipmi.Message{})
+
+			assert.Equal(t, tc.expected, response)
+		})
+	}
+}
+
+func TestGetSystemBootOptionsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	handler := NewHandler(mockRM, "v0.5.1")
+
+	testCases := []struct {
+		name         string
+		param        uint8
+		expectedCall func()
+		expectedCode goipmi.CompletionCode
+		expectedData []uint8
+	}{
+		{
+			name:         "Set in progress",
+			param:        goipmi.BootParamSetInProgress,
+			expectedCall: func() {},
+			expectedCode: goipmi.CommandCompleted,
+			expectedData: []uint8{bootParamSetComplete},
+		},
+		{
+			name:         "Boot info acknowledge",
+			param:        goipmi.BootParamInfoAck,
+			expectedCall: func() {},
+			expectedCode: goipmi.CommandCompleted,
+			expectedData: []uint8{0x00, 0x00},
+		},
+		{
+			name:  "Boot flags with PXE",
+			param: goipmi.BootParamBootFlags,
+			expectedCall: func() {
+				mockRM.EXPECT().GetBootOptions().Return(&resourcemanager.BootOptions{
+					Device:     resourcemanager.BootDevicePxe,
+					Persistent: true,
+				}, nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+			expectedData: []uint8{0xc0, uint8(goipmi.BootDevicePxe), 0x00, 0x00, 0x00},
+		},
+		{
+			name:  "Boot flags with disk and EFI",
+			param: goipmi.BootParamBootFlags,
+			expectedCall: func() {
+				mockRM.EXPECT().GetBootOptions().Return(&resourcemanager.BootOptions{
+					Device:     resourcemanager.BootDeviceHdd,
+					Persistent: true,
+					EFI:        true,
+				}, nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+			expectedData: []uint8{0xe0, uint8(goipmi.BootDeviceDisk), 0x00, 0x00, 0x00},
+		},
+		{
+			name:  "Boot flags with CD-ROM",
+			param: goipmi.BootParamBootFlags,
+			expectedCall: func() {
+				mockRM.EXPECT().GetBootOptions().Return(&resourcemanager.BootOptions{
+					Device:     resourcemanager.BootDeviceCd,
+					Persistent: true,
+				}, nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+			expectedData: []uint8{0xc0, uint8(goipmi.BootDeviceCdrom), 0x00, 0x00, 0x00},
+		},
+		{
+			name:  "Boot flags without boot device",
+			param: goipmi.BootParamBootFlags,
+			expectedCall: func() {
+				mockRM.EXPECT().GetBootOptions().Return(&resourcemanager.BootOptions{
+					Persistent: true,
+				}, nil)
+			},
+			expectedCode: goipmi.CommandCompleted,
+			expectedData: []uint8{0x40, uint8(goipmi.BootDeviceNone), 0x00, 0x00, 0x00},
+		},
+		{
+			name:  "Boot flags failure",
+			param: goipmi.BootParamBootFlags,
+			expectedCall: func() {
+				mockRM.EXPECT().GetBootOptions().Return(nil, fmt.Errorf("error"))
+			},
+			expectedCode: goipmi.ErrUnspecified,
+		},
+		{
+			name:         "Unsupported parameter",
+			param:        goipmi.BootParamInitMbox,
+			expectedCall: func() {},
+			expectedCode: errBootParamNotSupported,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.expectedCall()
+
+			message := &goipmi.Message{
+				Data: []byte{tc.param, 0, 0},
+			}
+
+			response := handler.getSystemBootOptionsHandler(message)
+
+			assert.Equal(t, tc.expectedCode, goipmi.CompletionCode(response.Code()))
+			if tc.expectedCode != goipmi.CommandCompleted {
+				return
+			}
+			assert.IsType(t, &goipmi.SystemBootOptionsResponse{}, response)
+			res, _ := response.(*goipmi.SystemBootOptionsResponse)
+			assert.Equal(t, tc.param, res.Param)
+			assert.Equal(t, tc.expectedData, res.Data)
+		})
+	}
+}
+
+func TestBootOptionsParameters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	handler := NewHandler(mockRM, "v0.5.1")
+
+	set := func(data ...uint8) goipmi.CompletionCode {
+		return goipmi.CompletionCode(handler.setSystemBootOptionsHandler(&goipmi.Message{Data: data}).Code())
+	}
+	get := func(param uint8) []uint8 {
+		response := handler.getSystemBootOptionsHandler(&goipmi.Message{Data: []byte{param, 0, 0}})
+		require.IsType(t, &goipmi.SystemBootOptionsResponse{}, response)
+		return response.(*goipmi.SystemBootOptionsResponse).Data
+	}
+
+	// The sequence followed by ipmitool to set the boot device
+	assert.Equal(t, goipmi.CommandCompleted, set(goipmi.BootParamSetInProgress, bootParamSetInProgress))
+	assert.Equal(t, []uint8{bootParamSetInProgress}, get(goipmi.BootParamSetInProgress))
+	assert.Equal(t, errBootParamSetInProgress, set(goipmi.BootParamSetInProgress, bootParamSetInProgress))
+
+	assert.Equal(t, goipmi.CommandCompleted, set(goipmi.BootParamInfoAck, 0x01, 0x01))
+	assert.Equal(t, []uint8{0x00, 0x01}, get(goipmi.BootParamInfoAck))
+
+	assert.Equal(t, goipmi.CommandCompleted, set(goipmi.BootParamSetInProgress, bootParamCommitWrite))
+	assert.Equal(t, goipmi.CommandCompleted, set(goipmi.BootParamSetInProgress, bootParamSetComplete))
+	assert.Equal(t, []uint8{bootParamSetComplete}, get(goipmi.BootParamSetInProgress))
+
+	assert.Equal(t, goipmi.CommandCompleted, set(goipmi.BootParamInfoAck, 0x01, 0x00))
+	assert.Equal(t, []uint8{0x00, 0x00}, get(goipmi.BootParamInfoAck))
+
+	assert.Equal(t, errBootParamNotSupported, set(goipmi.BootParamInitMbox, 0x00))
+}
@@ -0,0 +1,99 @@
+package ipmi
+
+import (
+	"encoding/binary"
+	"errors"
+
+	goipmi "github.com/vmware/goipmi"
+)
+
+var errInvalidAuthCode = errors.New("invalid session AuthCode")
+
+// lanPacket is an IPMI v1.5 packet per section 13.6
+type lanPacket struct {
+	authType  uint8
+	sequence  uint32
+	sessionID uint32
+	authCode  [16]byte
+	// message is the IPMI message, over which the AuthCode is computed
+	message []byte
+}
+
+func lanPacketFromBytes(packet []byte) (*lanPacket, error) {
+	b := packet[rmcpHeaderSize:]
+	if len(b) < 9 {
+		return nil, goipmi.ErrShortPacket
+	}
+
+	p := &lanPacket{
+		authType:  b[0],
+		sequence:  binary.LittleEndian.Uint32(b[1:5]),
+		sessionID: binary.LittleEndian.Uint32(b[5:9]),
+	}
+	b = b[9:]
+	if p.authType != goipmi.AuthTypeNone {
+		if len(b) < len(p.authCode) {
+			return nil, goipmi.ErrShortPacket
+		}
+		copy(p.authCode[:], b)
+		b = b[len(p.authCode):]
+	}
+	if len(b) < 1 || int(b[0]) > len(b)-1 {
+		return nil, goipmi.ErrShortPacket
+	}
+	p.message = b[1 : 1+int(b[0])]
+
+	return p, nil
+}
+
+func (p *lanPacket) toBytes() []byte {
+	b := []byte{rmcpVersion1, 0x00, 0xff, rmcpClassIPMI, p.authType}
+	b = binary.LittleEndian.AppendUint32(b, p.sequence)
+	b = binary.LittleEndian.AppendUint32(b, p.sessionID)
+	if p.authType != goipmi.AuthTypeNone {
+		b = append(b, p.authCode[:]...)
+	}
+	b = append(b, uint8(len(p.message)))
+	return append(b, p.message...)
+}
+
+// handleLanPacket answers an IPMI v1.5 packet
+func (s *server) handleLanPacket(packet []byte) ([]byte, error) {
+	p, err := lanPacketFromBytes(packet)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ipmiMessageFromBytes(p.message)
+	if err != nil {
+		return nil, err
+	}
+
+	// The packets of the pending sessions go through as sessionless ones, which only get to activate the session
+	sess := s.sessions.get(p.sessionID)
+	if sess != nil {
+		if err := s.sessions.authenticate(sess, p); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &request{
+		ipmiMessage: m,
+		session:     sess,
+		lan:         p,
+	}
+
+	response := &lanPacket{
+		authType:  p.authType,
+		sequence:  p.sequence,
+		sessionID: p.sessionID,
+		message:   m.response(s.dispatch(r)),
+	}
+	if response.authType != goipmi.AuthTypeNone {
+		response.authCode, err = s.sessions.lanAuthCode(response)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response.toBytes(), nil
+}
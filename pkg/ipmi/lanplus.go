@@ -0,0 +1,388 @@
+package ipmi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/sirupsen/logrus"
+	goipmi "github.com/vmware/goipmi"
+)
+
+// Payload types per section 13.27.3
+const (
+	payloadTypeIPMI                = 0x00
+	payloadTypeSOL                 = 0x01
+	payloadTypeOpenSessionRequest  = 0x10
+	payloadTypeOpenSessionResponse = 0x11
+	payloadTypeRAKP1               = 0x12
+	payloadTypeRAKP2               = 0x13
+	payloadTypeRAKP3               = 0x14
+	payloadTypeRAKP4               = 0x15
+
+	payloadTypeMask      = 0x3f
+	payloadEncrypted     = 0x80
+	payloadAuthenticated = 0x40
+)
+
+// RMCP+ and RAKP message status codes per section 13.24
+const (
+	rmcpStatusNoErrors              = 0x00
+	rmcpStatusInsufficientResources = 0x01
+	rmcpStatusInvalidSessionID      = 0x02
+	rmcpStatusInvalidRole           = 0x09
+	rmcpStatusUnauthorizedRole      = 0x0a
+	rmcpStatusInvalidNameLength     = 0x0c
+	rmcpStatusUnauthorizedName      = 0x0d
+	rmcpStatusInvalidIntegrityCheck = 0x0f
+	rmcpStatusNoCipherSuiteMatch    = 0x11
+	rmcpStatusIllegalParameter      = 0x12
+)
+
+const (
+	lanplusHeaderSize = 12
+	// lanplusTrailerSize is the size of the pad length and next header fields of the session trailer
+	lanplusTrailerSize = 2
+	lanplusNextHeader  = 0x07
+
+	openSessionRequestSize = 32
+	algorithmPayloadSize   = 8
+	rakp1MinSize           = 28
+	rakp3MinSize           = 8
+	maxUsernameLength      = 16
+)
+
+var (
+	errUnsupportedPayload = errors.New("unsupported payload")
+	errUnprotectedPayload = errors.New("payload lacks integrity or confidentiality")
+	errIntegrityCheck     = errors.New("integrity check failed")
+	errReplayedSequence   = errors.New("sequence number replayed or out of window")
+)
+
+// lanplusPacket is an IPMI v2.0 packet per section 13.6
+type lanplusPacket struct {
+	payloadType uint8
+	sessionID   uint32
+	sequence    uint32
+	payload     []byte
+}
+
+func lanplusPacketFromBytes(packet []byte) (*lanplusPacket, error) {
+	b := packet[rmcpHeaderSize:]
+	if len(b) < lanplusHeaderSize {
+		return nil, goipmi.ErrShortPacket
+	}
+
+	p := &lanplusPacket{
+		payloadType: b[1],
+		sessionID:   binary.LittleEndian.Uint32(b[2:6]),
+		sequence:    binary.LittleEndian.Uint32(b[6:10]),
+	}
+	// OEM explicit payloads carry additional header fields, none of them is supported
+	if p.payloadType&payloadTypeMask == 0x02 {
+		return nil, errUnsupportedPayload
+	}
+	length := int(binary.LittleEndian.Uint16(b[10:12]))
+	if length > len(b)-lanplusHeaderSize {
+		return nil, goipmi.ErrShortPacket
+	}
+	p.payload = b[lanplusHeaderSize : lanplusHeaderSize+length]
+
+	return p, nil
+}
+
+// sessionlessPacket returns an IPMI v2.0 packet sent outside of a session
+func sessionlessPacket(payloadType uint8, payload []byte) []byte {
+	b := []byte{rmcpVersion1, 0x00, 0xff, rmcpClassIPMI, authTypeRMCPPlus, payloadType}
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(payload)))
+	return append(b, payload...)
+}
+
+// open checks the integrity and the sequence number of a packet received in the session and returns its decrypted
+// payload
+func (s *session) open(packet []byte, p *lanplusPacket) ([]byte, error) {
+	if p.payloadType&payloadAuthenticated == 0 || p.payloadType&payloadEncrypted == 0 {
+		return nil, errUnprotectedPayload
+	}
+
+	// The session trailer is made of the integrity pad, the pad length, the next header and the AuthCode
+	authCodeStart := len(packet) - s.cipherSuite.authCodeLength()
+	trailerStart := rmcpHeaderSize + lanplusHeaderSize + len(p.payload)
+	if authCodeStart < trailerStart+lanplusTrailerSize ||
+		packet[authCodeStart-1] != lanplusNextHeader ||
+		trailerStart+int(packet[authCodeStart-2])+lanplusTrailerSize != authCodeStart {
+		return nil, goipmi.ErrInvalidPacket
+	}
+	if !hmac.Equal(s.cipherSuite.authCode(s.k1, packet[rmcpHeaderSize:authCodeStart]), packet[authCodeStart:]) {
+		return nil, errIntegrityCheck
+	}
+	if !s.acceptSequence(p.sequence) {
+		return nil, errReplayedSequence
+	}
+
+	return decryptAESCBC(s.k2, p.payload)
+}
+
+// seal returns the packet carrying a payload in the session, encrypted and followed by the session trailer
+func (s *session) seal(payloadType uint8, payload []byte) ([]byte, error) {
+	encrypted, err := encryptAESCBC(s.k2, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	b := []byte{rmcpVersion1, 0x00, 0xff, rmcpClassIPMI, authTypeRMCPPlus, payloadType | payloadEncrypted | payloadAuthenticated}
+	b = binary.LittleEndian.AppendUint32(b, s.remoteID)
+	b = binary.LittleEndian.AppendUint32(b, s.nextOutSequence())
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(encrypted)))
+	b = append(b, encrypted...)
+
+	// Pad so that the data covered by the AuthCode is a multiple of 4 bytes
+	padLength := (4 - (len(b)-rmcpHeaderSize+lanplusTrailerSize)%4) % 4
+	for i := 0; i < padLength; i++ {
+		b = append(b, 0xff)
+	}
+	b = append(b, uint8(padLength), lanplusNextHeader)
+
+	return append(b, s.cipherSuite.authCode(s.k1, b[rmcpHeaderSize:])...), nil
+}
+
+// handleLanplusPacket answers an IPMI v2.0 packet received from the given address
+func (s *server) handleLanplusPacket(packet []byte, addr net.Addr) ([]byte, error) {
+	p, err := lanplusPacketFromBytes(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.sessionID == 0 {
+		if p.payloadType&(payloadEncrypted|payloadAuthenticated) != 0 {
+			return nil, errUnsupportedPayload
+		}
+		switch p.payloadType {
+		case payloadTypeOpenSessionRequest:
+			return sessionlessPacket(payloadTypeOpenSessionResponse, s.sessions.openSession(p.payload)), nil
+		case payloadTypeRAKP1:
+			return sessionlessPacket(payloadTypeRAKP2, s.sessions.rakp1(p.payload)), nil
+		case payloadTypeRAKP3:
+			response := s.sessions.rakp3(p.payload)
+			if response == nil {
+				return nil, nil
+			}
+			return sessionlessPacket(payloadTypeRAKP4, response), nil
+		case payloadTypeIPMI:
+			m, err := ipmiMessageFromBytes(p.payload)
+			if err != nil {
+				return nil, err
+			}
+			return sessionlessPacket(payloadTypeIPMI, m.response(s.dispatch(&request{ipmiMessage: m}))), nil
+		default:
+			return nil, errUnsupportedPayload
+		}
+	}
+
+	sess := s.sessions.get(p.sessionID)
+	if sess == nil || sess.cipherSuite == nil {
+		return nil, fmt.Errorf("unknown session 0x%08x", p.sessionID)
+	}
+	payload, err := sess.open(packet, p)
+	if err != nil {
+		return nil, err
+	}
+	// The payloads sent outside of the requests go where the remote console talks from
+	sess.setRemoteAddr(addr)
+
+	payloadType := p.payloadType & payloadTypeMask
+	if payloadType == payloadTypeIPMI {
+		m, err := ipmiMessageFromBytes(payload)
+		if err != nil {
+			return nil, err
+		}
+		return sess.seal(payloadTypeIPMI, m.response(s.dispatch(&request{ipmiMessage: m, session: sess})))
+	}
+
+	handler, ok := s.payloads[payloadType]
+	if !ok {
+		return nil, errUnsupportedPayload
+	}
+	response := handler(sess, payload)
+	if response == nil {
+		return nil, nil
+	}
+	return sess.seal(payloadType, response)
+}
+
+// openSession answers an RMCP+ Open Session Request per section 13.17
+func (h *sessionHandler) openSession(data []byte) []byte {
+	if len(data) < 8 {
+		return nil
+	}
+	tag := data[0]
+	role := data[1] & 0x0f
+	remoteID := binary.LittleEndian.Uint32(data[4:8])
+
+	fail := func(status uint8) []byte {
+		return binary.LittleEndian.AppendUint32([]byte{tag, status, 0x00, 0x00}, remoteID)
+	}
+
+	if len(data) < openSessionRequestSize {
+		return fail(rmcpStatusIllegalParameter)
+	}
+	var algorithms [3]uint8
+	for i := range algorithms {
+		record := data[8+i*algorithmPayloadSize : 8+(i+1)*algorithmPayloadSize]
+		if record[0] != uint8(i) || record[3] != algorithmPayloadSize {
+			return fail(rmcpStatusIllegalParameter)
+		}
+		algorithms[i] = record[4] & 0x3f
+	}
+	cipherSuite := findCipherSuite(algorithms[0], algorithms[1], algorithms[2])
+	if cipherSuite == nil {
+		logrus.Warnf("open session rejected: no cipher suite matches algorithms %v", algorithms)
+		return fail(rmcpStatusNoCipherSuiteMatch)
+	}
+	if role > goipmi.PrivLevelAdmin {
+		return fail(rmcpStatusInvalidRole)
+	}
+	if role == goipmi.PrivLevelNone {
+		role = goipmi.PrivLevelAdmin
+	}
+
+	s := h.newSession()
+	if s == nil {
+		return fail(rmcpStatusInsufficientResources)
+	}
+	s.remoteID = remoteID
+	s.cipherSuite = cipherSuite
+	s.maxPrivilege = role
+
+	res := []byte{tag, rmcpStatusNoErrors, role, 0x00}
+	res = binary.LittleEndian.AppendUint32(res, remoteID)
+	res = binary.LittleEndian.AppendUint32(res, s.id)
+	for i, alg := range []uint8{cipherSuite.auth, cipherSuite.integrity, cipherSuite.confidentiality} {
+		res = append(res, uint8(i), 0x00, 0x00, algorithmPayloadSize, alg, 0x00, 0x00, 0x00)
+	}
+	return res
+}
+
+// rakp1 answers RAKP Message 1 with RAKP Message 2 per section 13.20 and 13.21
+func (h *sessionHandler) rakp1(data []byte) []byte {
+	if len(data) < 8 {
+		return nil
+	}
+	tag := data[0]
+	s := h.lookup(binary.LittleEndian.Uint32(data[4:8]))
+	if s == nil || s.active || s.cipherSuite == nil {
+		return []byte{tag, rmcpStatusInvalidSessionID, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	}
+
+	fail := func(status uint8) []byte {
+		h.remove(s.id)
+		return binary.LittleEndian.AppendUint32([]byte{tag, status, 0x00, 0x00}, s.remoteID)
+	}
+
+	if len(data) < rakp1MinSize {
+		return fail(rmcpStatusIllegalParameter)
+	}
+	role := data[24]
+	usernameLength := int(data[27])
+	if usernameLength > maxUsernameLength || len(data) < rakp1MinSize+usernameLength {
+		return fail(rmcpStatusInvalidNameLength)
+	}
+	username := string(data[28 : 28+usernameLength])
+	if privilege := role & 0x0f; privilege < goipmi.PrivLevelUser || privilege > goipmi.PrivLevelAdmin {
+		return fail(rmcpStatusInvalidRole)
+	} else if privilege > s.maxPrivilege {
+		return fail(rmcpStatusUnauthorizedRole)
+	}
+
+	c, err := h.credentials.Credential()
+	if err != nil {
+		logrus.Errorf("unable to load credentials: %v", err)
+		return fail(rmcpStatusInsufficientResources)
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Username), []byte(username)) != 1 {
+		logrus.Warnf("RAKP rejected for user %q", username)
+		return fail(rmcpStatusUnauthorizedName)
+	}
+	if _, err := rand.Read(s.randomNumber[:]); err != nil {
+		return fail(rmcpStatusInsufficientResources)
+	}
+	s.username = username
+	s.role = role
+	copy(s.remoteRandom[:], data[8:24])
+
+	authCode := s.cipherSuite.authHMAC(
+		passwordKey(c.Password),
+		binary.LittleEndian.AppendUint32(nil, s.remoteID),
+		binary.LittleEndian.AppendUint32(nil, s.id),
+		s.remoteRandom[:],
+		s.randomNumber[:],
+		h.guid[:],
+		[]byte{s.role, uint8(len(s.username))},
+		[]byte(s.username),
+	)
+
+	res := binary.LittleEndian.AppendUint32([]byte{tag, rmcpStatusNoErrors, 0x00, 0x00}, s.remoteID)
+	res = append(res, s.randomNumber[:]...)
+	res = append(res, h.guid[:]...)
+	return append(res, authCode...)
+}
+
+// rakp3 answers RAKP Message 3 with RAKP Message 4 per section 13.22 and 13.23, activating the session on success
+func (h *sessionHandler) rakp3(data []byte) []byte {
+	if len(data) < rakp3MinSize {
+		return nil
+	}
+	tag := data[0]
+	s := h.lookup(binary.LittleEndian.Uint32(data[4:8]))
+	if s == nil || s.active || s.cipherSuite == nil || s.username == "" {
+		return []byte{tag, rmcpStatusInvalidSessionID, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	}
+
+	fail := func(status uint8) []byte {
+		h.remove(s.id)
+		return binary.LittleEndian.AppendUint32([]byte{tag, status, 0x00, 0x00}, s.remoteID)
+	}
+
+	// The remote console gives up, e.g., because it could not authenticate the BMC
+	if data[1] != rmcpStatusNoErrors {
+		h.remove(s.id)
+		return nil
+	}
+
+	c, err := h.credentials.Credential()
+	if err != nil {
+		logrus.Errorf("unable to load credentials: %v", err)
+		return fail(rmcpStatusInsufficientResources)
+	}
+	key := passwordKey(c.Password)
+	expected := s.cipherSuite.authHMAC(
+		key,
+		s.randomNumber[:],
+		binary.LittleEndian.AppendUint32(nil, s.remoteID),
+		[]byte{s.role, uint8(len(s.username))},
+		[]byte(s.username),
+	)
+	if !hmac.Equal(expected, data[8:]) {
+		logrus.Warnf("RAKP rejected: invalid password for user %q", s.username)
+		return fail(rmcpStatusInvalidIntegrityCheck)
+	}
+
+	// Derive the session keys per section 13.31 and 13.32, the BMC key (Kg) being the user key
+	sik := s.cipherSuite.authHMAC(key, s.remoteRandom[:], s.randomNumber[:], []byte{s.role, uint8(len(s.username))}, []byte(s.username))
+	s.k1 = s.cipherSuite.authHMAC(sik, constant1)
+	s.k2 = s.cipherSuite.authHMAC(sik, constant2)
+	s.privilege = s.role & 0x0f
+	s.maxPrivilege = s.privilege
+	s.active = true
+
+	integrityCheck := s.cipherSuite.authHMAC(sik, s.remoteRandom[:], binary.LittleEndian.AppendUint32(nil, s.id), h.guid[:])
+
+	res := binary.LittleEndian.AppendUint32([]byte{tag, rmcpStatusNoErrors, 0x00, 0x00}, s.remoteID)
+	return append(res, integrityCheck[:s.cipherSuite.integrityCheckLength()]...)
+}
@@ -0,0 +1,397 @@
+package ipmi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	goipmi "github.com/vmware/goipmi"
+	"go.uber.org/mock/gomock"
+
+	"kubevirt.io/kubevirtbmc/pkg/credential"
+	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
+)
+
+// lanplusConsole is a minimal RMCP+ remote console laid out after ipmitool's lanplus interface
+type lanplusConsole struct {
+	t    *testing.T
+	conn net.Conn
+
+	auth, integrity, confidentiality uint8
+	username, password               string
+	role                             uint8
+
+	consoleID, bmcID uint32
+	rm, rc, guid     [16]byte
+	sik, k1, k2      []byte
+	sequence         uint32
+	rqSeq            uint8
+}
+
+func newLanplusConsole(t *testing.T, s *Simulator, cipherSuiteID int, username, password string) *lanplusConsole {
+	addr := s.server.localAddr()
+	conn, err := net.Dial("udp4", net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port)))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	c := &lanplusConsole{
+		t:         t,
+		conn:      conn,
+		username:  username,
+		password:  password,
+		role:      0x10 | goipmi.PrivLevelAdmin, // name-only lookup
+		consoleID: 0xa0a2a3a4,
+	}
+	switch cipherSuiteID {
+	case 3:
+		c.auth, c.integrity, c.confidentiality = 0x01, 0x01, 0x01
+	case 17:
+		c.auth, c.integrity, c.confidentiality = 0x03, 0x04, 0x01
+	default:
+		c.auth, c.integrity, c.confidentiality = 0x00, 0x00, 0x00
+	}
+	_, _ = rand.Read(c.rm[:])
+	return c
+}
+
+func (c *lanplusConsole) hash(alg uint8) func() hash.Hash {
+	if alg == 0x03 || alg == 0x04 {
+		return sha256.New
+	}
+	return sha1.New
+}
+
+func (c *lanplusConsole) hmac(alg uint8, key []byte, data ...[]byte) []byte {
+	mac := hmac.New(c.hash(alg), key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func (c *lanplusConsole) authCodeLength() int {
+	if c.integrity == 0x04 {
+		return 16
+	}
+	return 12
+}
+
+// exchange sends a packet and returns the response, or nil if none arrives in time
+func (c *lanplusConsole) exchange(packet []byte) []byte {
+	_, err := c.conn.Write(packet)
+	require.NoError(c.t, err)
+	return c.read(200 * time.Millisecond)
+}
+
+// read returns the next packet sent by the BMC, or nil if none arrives in time
+func (c *lanplusConsole) read(timeout time.Duration) []byte {
+	buf := make([]byte, 1024)
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(timeout)))
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		return nil
+	}
+	return buf[:n]
+}
+
+func (c *lanplusConsole) sessionless(payloadType, responsePayloadType uint8, payload []byte) []byte {
+	b := []byte{0x06, 0x00, 0xff, 0x07, 0x06, payloadType, 0, 0, 0, 0, 0, 0, 0, 0}
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(payload)))
+	response := c.exchange(append(b, payload...))
+	require.NotNil(c.t, response)
+	require.Equal(c.t, responsePayloadType, response[5])
+	return response[16 : 16+binary.LittleEndian.Uint16(response[14:16])]
+}
+
+func (c *lanplusConsole) openSession() uint8 {
+	payload := []byte{0x01, 0x00, 0x00, 0x00}
+	payload = binary.LittleEndian.AppendUint32(payload, c.consoleID)
+	payload = append(payload, 0x00, 0, 0, 0x08, c.auth, 0, 0, 0)
+	payload = append(payload, 0x01, 0, 0, 0x08, c.integrity, 0, 0, 0)
+	payload = append(payload, 0x02, 0, 0, 0x08, c.confidentiality, 0, 0, 0)
+
+	res := c.sessionless(0x10, 0x11, payload)
+	require.Equal(c.t, c.consoleID, binary.LittleEndian.Uint32(res[4:8]))
+	if res[1] != 0 {
+		return res[1]
+	}
+	c.bmcID = binary.LittleEndian.Uint32(res[8:12])
+	assert.Equal(c.t, []uint8{c.auth, c.integrity, c.confidentiality}, []uint8{res[16], res[24], res[32]})
+	return 0
+}
+
+// rakp runs the RAKP exchange, returning the status of RAKP message 2 or 4 and whether the BMC proved to know the
+// password
+func (c *lanplusConsole) rakp() (uint8, bool) {
+	payload := []byte{0x02, 0, 0, 0}
+	payload = binary.LittleEndian.AppendUint32(payload, c.bmcID)
+	payload = append(payload, c.rm[:]...)
+	payload = append(payload, c.role, 0, 0, uint8(len(c.username)))
+	payload = append(payload, c.username...)
+
+	rakp2 := c.sessionless(0x12, 0x13, payload)
+	if rakp2[1] != 0 {
+		return rakp2[1], false
+	}
+	copy(c.rc[:], rakp2[8:24])
+	copy(c.guid[:], rakp2[24:40])
+
+	key := make([]byte, 20)
+	copy(key, c.password)
+	ids := binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, c.consoleID), c.bmcID)
+	name := append([]byte{c.role, uint8(len(c.username))}, c.username...)
+	bmcAuthenticated := hmac.Equal(rakp2[40:], c.hmac(c.auth, key, ids, c.rm[:], c.rc[:], c.guid[:], name))
+
+	payload = []byte{0x03, 0, 0, 0}
+	payload = binary.LittleEndian.AppendUint32(payload, c.bmcID)
+	payload = append(payload, c.hmac(c.auth, key, c.rc[:], binary.LittleEndian.AppendUint32(nil, c.consoleID), name)...)
+
+	rakp4 := c.sessionless(0x14, 0x15, payload)
+	if rakp4[1] != 0 {
+		return rakp4[1], bmcAuthenticated
+	}
+
+	c.sik = c.hmac(c.auth, key, c.rm[:], c.rc[:], name)
+	c.k1 = c.hmac(c.auth, c.sik, bytes.Repeat([]byte{0x01}, 20))
+	c.k2 = c.hmac(c.auth, c.sik, bytes.Repeat([]byte{0x02}, 20))
+	icvLength := 12
+	if c.auth == 0x03 {
+		icvLength = 16
+	}
+	icv := c.hmac(c.auth, c.sik, c.rm[:], binary.LittleEndian.AppendUint32(nil, c.bmcID), c.guid[:])
+	assert.Equal(c.t, icv[:icvLength], rakp4[8:])
+
+	return 0, bmcAuthenticated
+}
+
+// packet returns an encrypted and authenticated IPMI request
+func (c *lanplusConsole) packet(netfn goipmi.NetworkFunction, command goipmi.Command, data []byte) []byte {
+	c.rqSeq++
+	msg := []byte{0x20, uint8(netfn) << 2}
+	msg = append(msg, checksum(msg...), 0x81, c.rqSeq<<2, uint8(command))
+	msg = append(msg, data...)
+	msg = append(msg, checksum(msg[3:]...))
+	return c.seal(payloadTypeIPMI, msg)
+}
+
+// seal returns the packet carrying an encrypted and authenticated payload
+func (c *lanplusConsole) seal(payloadType uint8, payload []byte) []byte {
+	padLength := (16 - (len(payload)+1)%16) % 16
+	for i := 1; i <= padLength; i++ {
+		payload = append(payload, byte(i))
+	}
+	payload = append(payload, byte(padLength))
+	encrypted := make([]byte, 16+len(payload))
+	_, _ = rand.Read(encrypted[:16])
+	block, err := aes.NewCipher(c.k2[:16])
+	require.NoError(c.t, err)
+	cipher.NewCBCEncrypter(block, encrypted[:16]).CryptBlocks(encrypted[16:], payload)
+
+	c.sequence++
+	b := []byte{0x06, 0x00, 0xff, 0x07, 0x06, 0xc0 | payloadType}
+	b = binary.LittleEndian.AppendUint32(b, c.bmcID)
+	b = binary.LittleEndian.AppendUint32(b, c.sequence)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(encrypted)))
+	b = append(b, encrypted...)
+	for (len(b)-4+2)%4 != 0 {
+		b = append(b, 0xff)
+	}
+	b = append(b, uint8(len(b)-16-len(encrypted)), 0x07)
+	return append(b, c.hmac(c.integrity, c.k1, b[4:])[:c.authCodeLength()]...)
+}
+
+// open checks and decrypts a packet, returning its payload type and payload
+func (c *lanplusConsole) open(packet []byte) (uint8, []byte) {
+	require.NotNil(c.t, packet)
+	require.Equal(c.t, uint8(0xc0), packet[5]&0xc0)
+	require.Equal(c.t, c.consoleID, binary.LittleEndian.Uint32(packet[6:10]))
+
+	authCodeStart := len(packet) - c.authCodeLength()
+	require.Equal(c.t, c.hmac(c.integrity, c.k1, packet[4:authCodeStart])[:c.authCodeLength()], packet[authCodeStart:])
+	require.Zero(c.t, (authCodeStart-4)%4)
+
+	payload := packet[16 : 16+binary.LittleEndian.Uint16(packet[14:16])]
+	block, err := aes.NewCipher(c.k2[:16])
+	require.NoError(c.t, err)
+	msg := make([]byte, len(payload)-16)
+	cipher.NewCBCDecrypter(block, payload[:16]).CryptBlocks(msg, payload[16:])
+	return packet[5] & payloadTypeMask, msg[:len(msg)-int(msg[len(msg)-1])-1]
+}
+
+// response checks and decrypts a response packet, returning the completion code followed by the response data
+func (c *lanplusConsole) response(packet []byte) []byte {
+	payloadType, msg := c.open(packet)
+	require.Equal(c.t, uint8(payloadTypeIPMI), payloadType)
+
+	require.Equal(c.t, c.rqSeq<<2, msg[4])
+	require.Equal(c.t, checksum(msg[3:len(msg)-1]...), msg[len(msg)-1])
+	return msg[6 : len(msg)-1]
+}
+
+func (c *lanplusConsole) send(netfn goipmi.NetworkFunction, command goipmi.Command, data []byte) []byte {
+	return c.response(c.exchange(c.packet(netfn, command, data)))
+}
+
+func newTestSimulator(t *testing.T, mockRM resourcemanager.ResourceManager) *Simulator {
+	s := NewSimulator("127.0.0.1", 0, nil, mockRM, credential.NewStaticProvider("admin", "s3cr3t"), "v0.5.1")
+	require.NoError(t, s.Run())
+	t.Cleanup(s.Stop)
+	return s
+}
+
+func TestLanplusSession(t *testing.T) {
+	for _, cipherSuiteID := range []int{3, 17} {
+		t.Run("cipher suite "+strconv.Itoa(cipherSuiteID), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockRM := resourcemanager.NewMockResourceManager(ctrl)
+			mockRM.EXPECT().GetChassisStatus().
+				Return(&resourcemanager.ChassisStatus{PowerState: resourcemanager.PowerStateOn}, nil)
+			s := newTestSimulator(t, mockRM)
+
+			c := newLanplusConsole(t, s, cipherSuiteID, "admin", "s3cr3t")
+			require.Zero(t, c.openSession())
+			status, bmcAuthenticated := c.rakp()
+			require.Zero(t, status)
+			assert.True(t, bmcAuthenticated)
+
+			res := c.send(goipmi.NetworkFunctionApp, goipmi.CommandSetSessionPrivilegeLevel, []byte{goipmi.PrivLevelAdmin})
+			assert.Equal(t, []byte{0x00, goipmi.PrivLevelAdmin}, res)
+
+			res = c.send(goipmi.NetworkFunctionChassis, goipmi.CommandChassisStatus, nil)
+			assert.Equal(t, uint8(goipmi.CommandCompleted), res[0])
+			assert.Equal(t, uint8(goipmi.SystemPower), res[1])
+
+			res = c.send(goipmi.NetworkFunctionApp, goipmi.CommandCloseSession, binary.LittleEndian.AppendUint32(nil, c.bmcID))
+			assert.Equal(t, []byte{0x00}, res)
+
+			// The closed session doesn't answer anymore
+			assert.Nil(t, c.exchange(c.packet(goipmi.NetworkFunctionChassis, goipmi.CommandChassisStatus, nil)))
+		})
+	}
+}
+
+func TestLanplusAuthentication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	s := newTestSimulator(t, mockRM)
+
+	testCases := []struct {
+		name                     string
+		cipherSuiteID            int
+		username                 string
+		password                 string
+		expectedOpenStatus       uint8
+		expectedRAKPStatus       uint8
+		expectedBMCAuthenticated bool
+	}{
+		{
+			name:               "unsupported cipher suite",
+			cipherSuiteID:      0,
+			username:           "admin",
+			password:           "s3cr3t",
+			expectedOpenStatus: rmcpStatusNoCipherSuiteMatch,
+		},
+		{
+			name:               "invalid username",
+			cipherSuiteID:      17,
+			username:           "root",
+			password:           "s3cr3t",
+			expectedRAKPStatus: rmcpStatusUnauthorizedName,
+		},
+		{
+			name:               "invalid password",
+			cipherSuiteID:      3,
+			username:           "admin",
+			password:           "password",
+			expectedRAKPStatus: rmcpStatusInvalidIntegrityCheck,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newLanplusConsole(t, s, tc.cipherSuiteID, tc.username, tc.password)
+			status := c.openSession()
+			assert.Equal(t, tc.expectedOpenStatus, status)
+			if status != 0 {
+				return
+			}
+
+			status, bmcAuthenticated := c.rakp()
+			assert.Equal(t, tc.expectedRAKPStatus, status)
+			assert.Equal(t, tc.expectedBMCAuthenticated, bmcAuthenticated)
+		})
+	}
+}
+
+func TestLanplusIntegrity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	mockRM.EXPECT().GetChassisStatus().
+		Return(&resourcemanager.ChassisStatus{PowerState: resourcemanager.PowerStateOff}, nil).Times(1)
+	s := newTestSimulator(t, mockRM)
+
+	c := newLanplusConsole(t, s, 17, "admin", "s3cr3t")
+	require.Zero(t, c.openSession())
+	status, _ := c.rakp()
+	require.Zero(t, status)
+
+	t.Run("tampered packet", func(t *testing.T) {
+		packet := c.packet(goipmi.NetworkFunctionChassis, goipmi.CommandChassisStatus, nil)
+		packet[20] ^= 0x01
+		assert.Nil(t, c.exchange(packet))
+	})
+
+	t.Run("replayed packet", func(t *testing.T) {
+		packet := c.packet(goipmi.NetworkFunctionChassis, goipmi.CommandChassisStatus, nil)
+		assert.Equal(t, uint8(goipmi.CommandCompleted), c.response(c.exchange(packet))[0])
+		assert.Nil(t, c.exchange(packet))
+	})
+
+	t.Run("unencrypted packet", func(t *testing.T) {
+		packet := c.packet(goipmi.NetworkFunctionChassis, goipmi.CommandChassisStatus, nil)
+		packet[5] = payloadTypeIPMI
+		assert.Nil(t, c.exchange(packet))
+	})
+}
+
+func TestLanplusSessionlessCommands(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	s := newTestSimulator(t, mockRM)
+	c := newLanplusConsole(t, s, 17, "admin", "s3cr3t")
+
+	request := func(command goipmi.Command, data []byte) []byte {
+		return ipmiRequest(goipmi.NetworkFunctionApp, command, data)
+	}
+
+	t.Run("Get Channel Authentication Capabilities over IPMI v1.5", func(t *testing.T) {
+		msg := request(goipmi.CommandGetAuthCapabilities, []byte{0x8e, goipmi.PrivLevelAdmin})
+		packet := append([]byte{0x06, 0x00, 0xff, 0x07, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, uint8(len(msg))}, msg...)
+		res := c.exchange(packet)
+		require.NotNil(t, res)
+		data := res[14+6 : len(res)-1]
+		assert.Equal(t, uint8(goipmi.CommandCompleted), data[0])
+		assert.NotZero(t, data[2]&0x80, "IPMI v2.0 extended capabilities")
+		assert.NotZero(t, data[4]&0x02, "IPMI v2.0 connections")
+	})
+
+	t.Run("Get Channel Cipher Suites", func(t *testing.T) {
+		res := c.sessionless(payloadTypeIPMI, payloadTypeIPMI, request(commandGetChannelCipherSuites, []byte{0x0e, 0x00, 0x80}))
+		assert.Equal(t, []byte{0x00, 0x01, 0xc0, 17, 0x03, 0x44, 0x81, 0xc0, 3, 0x01, 0x41, 0x81}, res[6:len(res)-1])
+
+		res = c.sessionless(payloadTypeIPMI, payloadTypeIPMI, request(commandGetChannelCipherSuites, []byte{0x0e, 0x00, 0x81}))
+		assert.Equal(t, []byte{uint8(goipmi.ErrParamRange)}, res[6:len(res)-1])
+	})
+}
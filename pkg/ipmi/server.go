@@ -0,0 +1,334 @@
+package ipmi
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	goipmi "github.com/vmware/goipmi"
+)
+
+// RMCP constants per section 13.1.3
+const (
+	rmcpVersion1  = 0x06
+	rmcpClassASF  = 0x06
+	rmcpClassIPMI = 0x07
+
+	rmcpHeaderSize = 4
+	rmcpBufSize    = 1024
+)
+
+// ASF constants per section 13.2.3
+const (
+	asfIANA            = 0x000011be
+	asfMessageTypePing = 0x80
+	asfMessageTypePong = 0x40
+)
+
+// authTypeRMCPPlus in the session header tells apart the IPMI v2.0 packets from the IPMI v1.5 ones
+const authTypeRMCPPlus = 0x06
+
+// ipmiMessage is the IPMI request carried by the IPMI v1.5 and v2.0 session wrappers per section 13.8
+type ipmiMessage struct {
+	rsAddr     uint8
+	netFnRsLUN uint8
+	rqAddr     uint8
+	rqSeq      uint8
+	command    goipmi.Command
+	data       []byte
+}
+
+func ipmiMessageFromBytes(b []byte) (*ipmiMessage, error) {
+	if len(b) < 7 {
+		return nil, goipmi.ErrShortPacket
+	}
+	if checksum(b[0], b[1]) != b[2] || checksum(b[3:len(b)-1]...) != b[len(b)-1] {
+		return nil, goipmi.ErrInvalidPacket
+	}
+	return &ipmiMessage{
+		rsAddr:     b[0],
+		netFnRsLUN: b[1],
+		rqAddr:     b[3],
+		rqSeq:      b[4],
+		command:    goipmi.Command(b[5]),
+		data:       b[6 : len(b)-1],
+	}, nil
+}
+
+func (m *ipmiMessage) netFn() goipmi.NetworkFunction {
+	return goipmi.NetworkFunction(m.netFnRsLUN >> 2)
+}
+
+// response returns the response message to the request, with the addresses swapped and the response NetFn
+func (m *ipmiMessage) response(data []byte) []byte {
+	netFnRqLUN := (uint8(m.netFn())|1)<<2 | m.rqSeq&0x03
+	b := []byte{m.rqAddr, netFnRqLUN, checksum(m.rqAddr, netFnRqLUN), m.rsAddr, m.rqSeq&^0x03 | m.netFnRsLUN&0x03, uint8(m.command)}
+	b = append(b, data...)
+	return append(b, checksum(b[3:]...))
+}
+
+// request is an IPMI request along with the session it has been received in
+type request struct {
+	*ipmiMessage
+	// session is nil for the requests received outside of a session
+	session *session
+	// lan is set for the requests received in IPMI v1.5 packets
+	lan *lanPacket
+}
+
+// message returns the request in the form expected by the command handlers
+func (r *request) message() *goipmi.Message {
+	m := &goipmi.Message{Data: r.data}
+	if r.session != nil {
+		m.RequestID = r.session.username
+	}
+	return m
+}
+
+type handlerFunc func(*request) goipmi.Response
+
+// payloadHandler returns the response to a payload other than an IPMI message received in an RMCP+ session, or nil if
+// there is none
+type payloadHandler func(*session, []byte) []byte
+
+// command is the handler of an IPMI command along with the session privilege level it requires per appendix G.
+// The commands requiring goipmi.PrivLevelNone are the only ones accepted outside of a session.
+type command struct {
+	privilege uint8
+	handler   handlerFunc
+}
+
+// rawResponse is the encoded data of a response, starting with the completion code, for the responses of variable
+// length
+type rawResponse []byte
+
+func (r rawResponse) Code() uint8 {
+	return r[0]
+}
+
+func (r rawResponse) MarshalBinary() ([]byte, error) {
+	return r, nil
+}
+
+// server answers the RMCP packets received on a UDP socket. Both IPMI v1.5 and IPMI v2.0 (RMCP+) sessions are
+// supported; the IPMI requests they carry are dispatched to the same handlers.
+type server struct {
+	addr     net.UDPAddr
+	conn     *net.UDPConn
+	wg       sync.WaitGroup
+	sessions *sessionHandler
+	handlers map[goipmi.NetworkFunction]map[goipmi.Command]command
+	payloads map[uint8]payloadHandler
+}
+
+func newServer(addr net.UDPAddr, sessions *sessionHandler) *server {
+	s := &server{
+		addr:     addr,
+		sessions: sessions,
+		handlers: map[goipmi.NetworkFunction]map[goipmi.Command]command{},
+		payloads: map[uint8]payloadHandler{},
+	}
+
+	// Session management is part of the transport
+	s.handle(goipmi.NetworkFunctionApp, goipmi.CommandGetAuthCapabilities, goipmi.PrivLevelNone, sessions.authCapabilitiesHandler)
+	s.handle(goipmi.NetworkFunctionApp, goipmi.CommandGetSessionChallenge, goipmi.PrivLevelNone, sessions.sessionChallengeHandler)
+	s.handle(goipmi.NetworkFunctionApp, goipmi.CommandActivateSession, goipmi.PrivLevelNone, sessions.activateSessionHandler)
+	s.handle(goipmi.NetworkFunctionApp, goipmi.CommandSetSessionPrivilegeLevel, goipmi.PrivLevelUser, sessions.sessionPrivilegeHandler)
+	s.handle(goipmi.NetworkFunctionApp, goipmi.CommandCloseSession, goipmi.PrivLevelCallback, sessions.closeSessionHandler)
+	s.handle(goipmi.NetworkFunctionApp, commandGetChannelCipherSuites, goipmi.PrivLevelNone, sessions.channelCipherSuitesHandler)
+
+	return s
+}
+
+func (s *server) handle(netfn goipmi.NetworkFunction, cmd goipmi.Command, privilege uint8, handler handlerFunc) {
+	if s.handlers[netfn] == nil {
+		s.handlers[netfn] = map[goipmi.Command]command{}
+	}
+	s.handlers[netfn][cmd] = command{
+		privilege: privilege,
+		handler:   handler,
+	}
+}
+
+// setHandler sets the handler of an IPMI command, which is only accepted in the sessions running at the given
+// privilege level or above
+func (s *server) setHandler(netfn goipmi.NetworkFunction, cmd goipmi.Command, privilege uint8, handler goipmi.Handler) {
+	s.handle(netfn, cmd, privilege, func(r *request) goipmi.Response {
+		return handler(r.message())
+	})
+}
+
+// setPayloadHandler sets the handler of a payload type carried by the RMCP+ sessions
+func (s *server) setPayloadHandler(payloadType uint8, handler payloadHandler) {
+	s.payloads[payloadType] = handler
+}
+
+// sendPayload sends a payload to the remote console of an RMCP+ session outside of any request, e.g., the SOL data
+// coming from the serial console
+func (s *server) sendPayload(sess *session, payloadType uint8, payload []byte) error {
+	addr := sess.remoteAddr()
+	if s.conn == nil || addr == nil {
+		return net.ErrClosed
+	}
+	packet, err := sess.seal(payloadType, payload)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.WriteTo(packet, addr)
+	return err
+}
+
+func (s *server) localAddr() *net.UDPAddr {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.LocalAddr().(*net.UDPAddr)
+}
+
+func (s *server) run() error {
+	conn, err := net.ListenUDP("udp4", &s.addr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serve()
+	}()
+
+	return nil
+}
+
+func (s *server) stop() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+	s.wg.Wait()
+}
+
+func (s *server) serve() {
+	buf := make([]byte, rmcpBufSize)
+
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return // conn closed
+		}
+
+		response := s.handlePacket(buf[:n], addr)
+		if response == nil {
+			continue
+		}
+		if _, err := s.conn.WriteTo(response, addr); err != nil {
+			return // conn closed
+		}
+	}
+}
+
+// handlePacket returns the response to an RMCP packet received from the given address, or nil if there is none
+func (s *server) handlePacket(packet []byte, addr net.Addr) []byte {
+	if len(packet) < rmcpHeaderSize+1 || packet[0] != rmcpVersion1 {
+		return nil
+	}
+
+	switch packet[3] {
+	case rmcpClassASF:
+		return asfPong(packet)
+	case rmcpClassIPMI:
+		var (
+			response []byte
+			err      error
+		)
+		if packet[rmcpHeaderSize] == authTypeRMCPPlus {
+			response, err = s.handleLanplusPacket(packet, addr)
+		} else {
+			response, err = s.handleLanPacket(packet)
+		}
+		if err != nil {
+			logrus.Debugf("discarding IPMI packet: %v", err)
+			return nil
+		}
+		return response
+	default:
+		return nil
+	}
+}
+
+// dispatch returns the response data to an IPMI request, starting with the completion code. A handler panicking on
+// an unexpected request fails that request only.
+func (s *server) dispatch(r *request) (data []byte) {
+	defer func() {
+		if err := recover(); err != nil {
+			logrus.Errorf("IPMI command 0x%02x (NetFn 0x%02x) failed: %v", uint8(r.command), uint8(r.netFn()), err)
+			data = responseDataToBytes(goipmi.ErrUnspecified)
+		}
+	}()
+
+	c, ok := s.handlers[r.netFn()][r.command]
+	if !ok {
+		return responseDataToBytes(goipmi.ErrInvalidCommand)
+	}
+	if c.privilege != goipmi.PrivLevelNone && (r.session == nil || r.session.privilege < c.privilege) {
+		logrus.Warnf("IPMI command 0x%02x (NetFn 0x%02x) rejected: insufficient privilege level", uint8(r.command), uint8(r.netFn()))
+		return responseDataToBytes(goipmi.ErrPrivLevel)
+	}
+
+	response := c.handler(r)
+	if response == nil {
+		response = goipmi.CommandCompleted
+	}
+	return responseDataToBytes(response)
+}
+
+func responseDataToBytes(response goipmi.Response) []byte {
+	if encoder, ok := response.(encoding.BinaryMarshaler); ok {
+		b, err := encoder.MarshalBinary()
+		if err != nil {
+			return []byte{uint8(goipmi.ErrUnspecified)}
+		}
+		return b
+	}
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.LittleEndian, response); err != nil {
+		return []byte{uint8(goipmi.ErrUnspecified)}
+	}
+	return buf.Bytes()
+}
+
+// requestDataFromBytes decodes the data of an IPMI request, returning the completion code to answer with on failure
+func requestDataFromBytes(data []byte, v interface{}) goipmi.Response {
+	return (&goipmi.Message{Data: data}).Request(v)
+}
+
+// asfPong answers an ASF presence ping per section 13.2.4
+func asfPong(packet []byte) []byte {
+	const asfHeaderSize = 8
+	if len(packet) < rmcpHeaderSize+asfHeaderSize || packet[rmcpHeaderSize+4] != asfMessageTypePing {
+		return nil
+	}
+
+	pong := make([]byte, rmcpHeaderSize+asfHeaderSize+16)
+	copy(pong, packet[:rmcpHeaderSize])
+	binary.BigEndian.PutUint32(pong[4:], asfIANA)
+	pong[8] = asfMessageTypePong
+	pong[9] = packet[9] // message tag
+	pong[11] = 16       // data length
+	binary.BigEndian.PutUint32(pong[12:], asfIANA)
+	pong[20] = 0x81 // supported entities: IPMI
+	pong[21] = 0x00 // supported interactions
+
+	return pong
+}
+
+func checksum(b ...uint8) uint8 {
+	var c uint8
+	for _, x := range b {
+		c += x
+	}
+	return -c
+}
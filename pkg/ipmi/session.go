@@ -0,0 +1,526 @@
+package ipmi
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	goipmi "github.com/vmware/goipmi"
+
+	"kubevirt.io/kubevirtbmc/pkg/credential"
+)
+
+// Completion codes specific to the session commands per section 22.16 to 22.19
+const (
+	errInvalidUserName         = goipmi.CompletionCode(0x81)
+	errPrivilegeNotAvailable   = goipmi.CompletionCode(0x80)
+	errPrivilegeExceedsLimit   = goipmi.CompletionCode(0x81)
+	errInvalidSessionID        = goipmi.CompletionCode(0x85)
+	errMaxPrivilegeExceeded    = goipmi.CompletionCode(0x86)
+	errInvalidSessionIDToClose = goipmi.CompletionCode(0x87)
+)
+
+// commandGetChannelCipherSuites is missing from the goipmi command numbers
+const commandGetChannelCipherSuites = goipmi.Command(0x54)
+
+// authTypeSupport advertises the authentication types accepted by the BMC.
+// AuthTypeNone is deliberately left out so that every session is bound to the
+// configured credential, and so is AuthTypePassword, which would put the
+// password in clear in every packet.
+const authTypeSupport = 1 << goipmi.AuthTypeMD5
+
+const (
+	// maxSessions bounds the number of sessions, pending or active, so that unauthenticated clients can't exhaust
+	// the memory of the BMC. The oldest pending session is evicted to make room for a new one, so that they can't lock
+	// the legitimate clients out either.
+	maxSessions = 32
+	// sessionTimeout is the inactivity period after which a session is closed per section 6.12.15
+	sessionTimeout = time.Minute
+	// pendingSessionTimeout is the inactivity period after which a session which hasn't been activated is dropped
+	pendingSessionTimeout = 5 * time.Second
+	// sequenceWindow is the number of sequence numbers accepted below the highest received one per section 6.12.13
+	sequenceWindow = 16
+)
+
+// session is an IPMI session, established either with the IPMI v1.5 challenge and activation or with the RMCP+
+// Authenticated Key-Exchange Protocol (RAKP)
+type session struct {
+	// id is the session ID assigned by the BMC
+	id           uint32
+	username     string
+	active       bool
+	maxPrivilege uint8
+	privilege    uint8
+	lastActivity time.Time
+
+	// authType and challenge are set for the IPMI v1.5 sessions
+	authType  uint8
+	challenge [16]byte
+
+	// The remaining fields are set for the RMCP+ sessions
+	remoteID     uint32
+	cipherSuite  *cipherSuite
+	role         uint8
+	remoteRandom [16]byte
+	randomNumber [16]byte
+	k1           []byte
+	k2           []byte
+
+	mu          sync.Mutex
+	inSequence  uint32
+	inReceived  uint32
+	outSequence uint32
+	// addr is the address the remote console last talked from, for the RMCP+ sessions
+	addr net.Addr
+}
+
+// acceptSequence tells whether an inbound session sequence number is neither out of the window nor replayed
+func (s *session) acceptSequence(sequence uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sequence == 0 {
+		return false
+	}
+	if sequence > s.inSequence {
+		// Moving the window forward forgets about the sequence numbers falling out of it
+		if shift := sequence - s.inSequence; shift < sequenceWindow {
+			s.inReceived = s.inReceived<<shift | 1
+		} else {
+			s.inReceived = 1
+		}
+		s.inSequence = sequence
+		return true
+	}
+	offset := s.inSequence - sequence
+	if offset >= sequenceWindow || s.inReceived&(1<<offset) != 0 {
+		return false
+	}
+	s.inReceived |= 1 << offset
+	return true
+}
+
+// expired tells whether the session has been inactive for longer than its timeout, which is much shorter for the
+// pending sessions
+func (s *session) expired(now time.Time) bool {
+	timeout := sessionTimeout
+	if !s.active {
+		timeout = pendingSessionTimeout
+	}
+	return now.Sub(s.lastActivity) > timeout
+}
+
+func (s *session) nextOutSequence() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outSequence++
+	if s.outSequence == 0 {
+		s.outSequence++
+	}
+	return s.outSequence
+}
+
+func (s *session) setRemoteAddr(addr net.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addr = addr
+}
+
+func (s *session) remoteAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addr
+}
+
+// sessionHandler authenticates IPMI sessions against the BMC credential
+type sessionHandler struct {
+	credentials credential.Provider
+	// guid identifies the BMC in the RAKP messages
+	guid [16]byte
+
+	mu       sync.Mutex
+	sessions map[uint32]*session
+}
+
+func newSessionHandler(credentials credential.Provider) *sessionHandler {
+	h := &sessionHandler{
+		credentials: credentials,
+		sessions:    map[uint32]*session{},
+	}
+	if _, err := rand.Read(h.guid[:]); err != nil {
+		logrus.Errorf("unable to generate the BMC GUID: %v", err)
+	}
+	return h
+}
+
+// newSession registers a pending session under a new random session ID, evicting the oldest pending session if there
+// are too many sessions already. It returns nil if all of them are active.
+func (h *sessionHandler) newSession() *session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	var oldest *session
+	for id, s := range h.sessions {
+		if s.expired(now) {
+			delete(h.sessions, id)
+			continue
+		}
+		if !s.active && (oldest == nil || s.lastActivity.Before(oldest.lastActivity)) {
+			oldest = s
+		}
+	}
+	if len(h.sessions) >= maxSessions {
+		if oldest == nil {
+			return nil
+		}
+		logrus.Debugf("evicting pending session 0x%08x", oldest.id)
+		delete(h.sessions, oldest.id)
+	}
+
+	for {
+		var id uint32
+		if err := binary.Read(rand.Reader, binary.LittleEndian, &id); err != nil {
+			return nil
+		}
+		if _, ok := h.sessions[id]; id == 0 || ok {
+			continue
+		}
+		s := &session{
+			id:           id,
+			lastActivity: now,
+		}
+		h.sessions[id] = s
+		return s
+	}
+}
+
+// get returns the active session with the given ID, if any
+func (h *sessionHandler) get(id uint32) *session {
+	s := h.lookup(id)
+	if s == nil || !s.active {
+		return nil
+	}
+	return s
+}
+
+// lookup returns the session with the given ID, pending or active, if it hasn't timed out
+func (h *sessionHandler) lookup(id uint32) *session {
+	if id == 0 {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.sessions[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if s.expired(now) {
+		delete(h.sessions, id)
+		return nil
+	}
+	s.lastActivity = now
+	return s
+}
+
+// alive tells whether a session is still registered and hasn't timed out, without counting as activity
+func (h *sessionHandler) alive(s *session) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.sessions[s.id] == s && !s.expired(time.Now())
+}
+
+func (h *sessionHandler) remove(id uint32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.sessions, id)
+}
+
+// authCapabilitiesResponse per section 22.13. goipmi.AuthCapabilitiesResponse can't be used as its OEM ID is one
+// byte short.
+type authCapabilitiesResponse struct {
+	goipmi.CompletionCode
+	ChannelNumber   uint8
+	AuthTypeSupport uint8
+	Status          uint8
+	Reserved        uint8
+	OEMID           [3]uint8
+	OEMAux          uint8
+}
+
+// authCapabilitiesHandler answers Get Channel Authentication Capabilities per section 22.13
+func (h *sessionHandler) authCapabilitiesHandler(r *request) goipmi.Response {
+	req := &goipmi.AuthCapabilitiesRequest{}
+	if err := requestDataFromBytes(r.data, req); err != nil {
+		return err
+	}
+	// The LAN channel is the only one, also known as the present channel (0x0e)
+	if channel := req.ChannelNumber & 0x0f; channel != 0x01 && channel != 0x0e {
+		return goipmi.ErrInvalidPacket
+	}
+	if level := req.PrivLevel & 0x0f; level < goipmi.PrivLevelCallback || level > goipmi.PrivLevelOEM {
+		return goipmi.ErrInvalidPacket
+	}
+
+	res := &authCapabilitiesResponse{
+		CompletionCode:  goipmi.CommandCompleted,
+		ChannelNumber:   0x01,
+		AuthTypeSupport: authTypeSupport,
+		// Non-null usernames only, with per-message and user level authentication enabled
+		Status: 0x04,
+	}
+	// Advertise RMCP+ to the clients asking for the IPMI v2.0 extended capabilities
+	if req.ChannelNumber&0x80 != 0 {
+		res.AuthTypeSupport |= 0x80
+		res.Reserved = 0x03 // IPMI v1.5 and v2.0 connections
+	}
+	return res
+}
+
+func (h *sessionHandler) sessionChallengeHandler(r *request) goipmi.Response {
+	req := &goipmi.SessionChallengeRequest{}
+	if err := requestDataFromBytes(r.data, req); err != nil {
+		return err
+	}
+
+	if req.AuthType != goipmi.AuthTypeMD5 {
+		logrus.Warnf("session challenge rejected: unsupported authentication type %d", req.AuthType)
+		return goipmi.ErrInvalidPacket
+	}
+
+	username := string(bytes.TrimRight(req.Username[:], "\000"))
+	c, err := h.credentials.Credential()
+	if err != nil {
+		logrus.Errorf("unable to load credentials: %v", err)
+		return goipmi.ErrUnspecified
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Username), []byte(username)) != 1 {
+		logrus.Warnf("session challenge rejected for user %q", username)
+		return errInvalidUserName
+	}
+
+	s := h.newSession()
+	if s == nil {
+		return goipmi.ErrNodeBusy
+	}
+	s.username = username
+	if _, err := rand.Read(s.challenge[:]); err != nil {
+		h.remove(s.id)
+		return goipmi.ErrUnspecified
+	}
+
+	return &goipmi.SessionChallengeResponse{
+		CompletionCode:     goipmi.CommandCompleted,
+		TemporarySessionID: s.id,
+		Challenge:          s.challenge,
+	}
+}
+
+func (h *sessionHandler) activateSessionHandler(r *request) goipmi.Response {
+	if r.lan == nil {
+		return goipmi.ErrInvalidCommand
+	}
+	req := &goipmi.ActivateSessionRequest{}
+	if err := requestDataFromBytes(r.data, req); err != nil {
+		return err
+	}
+
+	s := h.lookup(r.lan.sessionID)
+	if s == nil || s.active || s.cipherSuite != nil ||
+		subtle.ConstantTimeCompare(s.challenge[:], req.AuthCode[:]) != 1 {
+		logrus.Warnf("activate session rejected: unknown session 0x%08x", r.lan.sessionID)
+		return errInvalidSessionID
+	}
+
+	c, err := h.credentials.Credential()
+	if err != nil {
+		logrus.Errorf("unable to load credentials: %v", err)
+		return goipmi.ErrUnspecified
+	}
+	if c.Username != s.username || req.AuthType != r.lan.authType || !validAuthCode(r.lan, c.Password) {
+		h.remove(s.id)
+		logrus.Warnf("activate session rejected: invalid password for user %q", s.username)
+		return errInvalidSessionID
+	}
+
+	// The credential grants the administrator privilege level, the highest one a session can run at
+	maxPrivilege := req.PrivLevel & 0x0f
+	if maxPrivilege < goipmi.PrivLevelCallback || maxPrivilege > goipmi.PrivLevelAdmin {
+		h.remove(s.id)
+		logrus.Warnf("activate session rejected: privilege level 0x%02x not available for user %q", maxPrivilege, s.username)
+		return errMaxPrivilegeExceeded
+	}
+
+	// The remote console numbers the packets of the session from a random starting point per section 6.12.12
+	var inboundSequence uint32
+	if err := binary.Read(rand.Reader, binary.LittleEndian, &inboundSequence); err != nil {
+		h.remove(s.id)
+		return goipmi.ErrUnspecified
+	}
+	inboundSequence = inboundSequence&0x7fffffff | 1
+
+	s.authType = r.lan.authType
+	s.maxPrivilege = maxPrivilege
+	s.privilege = min(maxPrivilege, goipmi.PrivLevelUser)
+	s.inSequence = inboundSequence - 1
+	s.active = true
+
+	return &goipmi.ActivateSessionResponse{
+		CompletionCode: goipmi.CommandCompleted,
+		AuthType:       r.lan.authType,
+		SessionID:      s.id,
+		InboundSeq:     inboundSequence,
+		MaxPriv:        s.maxPrivilege,
+	}
+}
+
+func (h *sessionHandler) sessionPrivilegeHandler(r *request) goipmi.Response {
+	req := &goipmi.SessionPrivilegeLevelRequest{}
+	if err := requestDataFromBytes(r.data, req); err != nil {
+		return err
+	}
+	if r.session == nil {
+		return goipmi.ErrInvalidCommand
+	}
+
+	switch level := req.PrivLevel & 0x0f; {
+	case level == goipmi.PrivLevelNone:
+		// Return the current privilege level
+	case level < goipmi.PrivLevelUser:
+		return errPrivilegeNotAvailable
+	case level > r.session.maxPrivilege:
+		return errPrivilegeExceedsLimit
+	default:
+		r.session.privilege = level
+	}
+
+	return &goipmi.SessionPrivilegeLevelResponse{
+		CompletionCode:    goipmi.CommandCompleted,
+		NewPrivilegeLevel: r.session.privilege,
+	}
+}
+
+func (h *sessionHandler) closeSessionHandler(r *request) goipmi.Response {
+	req := &goipmi.CloseSessionRequest{}
+	if err := requestDataFromBytes(r.data, req); err != nil {
+		return err
+	}
+	if r.session == nil || req.SessionID != r.session.id {
+		return errInvalidSessionIDToClose
+	}
+
+	h.remove(r.session.id)
+
+	return &goipmi.CloseSessionResponse{
+		CompletionCode: goipmi.CommandCompleted,
+	}
+}
+
+// channelCipherSuitesHandler answers Get Channel Cipher Suites per section 22.15
+func (h *sessionHandler) channelCipherSuitesHandler(r *request) goipmi.Response {
+	if len(r.data) < 3 {
+		return goipmi.ErrRequestData
+	}
+
+	var records []byte
+	if r.data[2]&0x80 != 0 {
+		// List the algorithms by cipher suite
+		for _, c := range cipherSuites {
+			records = append(records, 0xc0, c.id, c.auth, 0x40|c.integrity, 0x80|c.confidentiality)
+		}
+	} else {
+		// List the supported algorithms
+		seen := map[uint8]bool{}
+		for _, c := range cipherSuites {
+			for _, alg := range []uint8{c.auth, 0x40 | c.integrity, 0x80 | c.confidentiality} {
+				if !seen[alg] {
+					seen[alg] = true
+					records = append(records, alg)
+				}
+			}
+		}
+	}
+
+	// The records are returned 16 bytes at a time
+	start := int(r.data[2]&0x3f) * 16
+	if start > len(records) {
+		return goipmi.ErrParamRange
+	}
+	end := min(start+16, len(records))
+
+	return rawResponse(append([]byte{uint8(goipmi.CommandCompleted), 0x01}, records[start:end]...))
+}
+
+// authenticate checks the session header of an IPMI v1.5 packet received in an active session, so that the
+// requests are only accepted from the holder of the credential the session has been activated with
+func (h *sessionHandler) authenticate(s *session, p *lanPacket) error {
+	if s.cipherSuite != nil || p.authType != s.authType {
+		return errInvalidAuthCode
+	}
+	c, err := h.credentials.Credential()
+	if err != nil {
+		return err
+	}
+	if c.Username != s.username || !validAuthCode(p, c.Password) {
+		return errInvalidAuthCode
+	}
+	if !s.acceptSequence(p.sequence) {
+		return errReplayedSequence
+	}
+	return nil
+}
+
+// lanAuthCode computes the AuthCode field of the session header of an IPMI v1.5 packet
+func (h *sessionHandler) lanAuthCode(p *lanPacket) ([16]byte, error) {
+	var authCode [16]byte
+
+	c, err := h.credentials.Credential()
+	if err != nil {
+		return authCode, err
+	}
+
+	var key [16]byte
+	copy(key[:], c.Password)
+
+	if p.authType == goipmi.AuthTypeMD5 {
+		copy(authCode[:], md5AuthCode(key, p))
+	}
+	return authCode, nil
+}
+
+// validAuthCode checks the AuthCode field of the session header per section 22.17.1
+func validAuthCode(p *lanPacket, password string) bool {
+	var key [16]byte
+	copy(key[:], password)
+
+	if p.authType != goipmi.AuthTypeMD5 {
+		return false
+	}
+	expected := md5AuthCode(key, p)
+	return subtle.ConstantTimeCompare(expected, p.authCode[:]) == 1
+}
+
+func md5AuthCode(key [16]byte, p *lanPacket) []byte {
+	h := md5.New()
+	_, _ = h.Write(key[:])
+	_ = binary.Write(h, binary.LittleEndian, p.sessionID)
+	_, _ = h.Write(p.message)
+	_ = binary.Write(h, binary.LittleEndian, p.sequence)
+	_, _ = h.Write(key[:])
+
+	return h.Sum(nil)
+}
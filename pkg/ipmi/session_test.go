@@ -0,0 +1,365 @@
+package ipmi
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	goipmi "github.com/vmware/goipmi"
+	"go.uber.org/mock/gomock"
+
+	"kubevirt.io/kubevirtbmc/pkg/credential"
+	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
+)
+
+func TestSessionAuthentication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	s := NewSimulator("127.0.0.1", 0, nil, mockRM, credential.NewStaticProvider("admin", "s3cr3t"), "v0.5.1")
+	require.NoError(t, s.Run())
+	defer s.Stop()
+
+	testCases := []struct {
+		name        string
+		username    string
+		password    string
+		expectError bool
+	}{
+		{name: "valid credential", username: "admin", password: "s3cr3t", expectError: false},
+		{name: "invalid username", username: "root", password: "s3cr3t", expectError: true},
+		{name: "invalid password", username: "admin", password: "password", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := newConnection(s)
+			conn.Username = tc.username
+			conn.Password = tc.password
+
+			client, err := goipmi.NewClient(conn)
+			require.NoError(t, err)
+
+			err = client.Open()
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, client.Close())
+		})
+	}
+}
+
+func newConnection(s *Simulator) *goipmi.Connection {
+	addr := s.server.localAddr()
+	return &goipmi.Connection{
+		Hostname:  addr.IP.String(),
+		Port:      addr.Port,
+		Interface: "lan",
+	}
+}
+
+func TestAuthCapabilities(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	s := newTestSimulator(t, mockRM)
+	c := newLanplusConsole(t, s, 17, "admin", "s3cr3t")
+
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected []byte
+	}{
+		{
+			name:     "IPMI v1.5 capabilities",
+			data:     []byte{0x0e, goipmi.PrivLevelAdmin},
+			expected: []byte{0x00, 0x01, 0x04, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			name:     "IPMI v2.0 extended capabilities",
+			data:     []byte{0x81, goipmi.PrivLevelUser},
+			expected: []byte{0x00, 0x01, 0x84, 0x04, 0x03, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			name:     "invalid channel",
+			data:     []byte{0x05, goipmi.PrivLevelAdmin},
+			expected: []byte{uint8(goipmi.ErrInvalidPacket)},
+		},
+		{
+			name:     "invalid privilege level",
+			data:     []byte{0x0e, 0x06},
+			expected: []byte{uint8(goipmi.ErrInvalidPacket)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &lanPacket{
+				authType: goipmi.AuthTypeNone,
+				message:  ipmiRequest(goipmi.NetworkFunctionApp, goipmi.CommandGetAuthCapabilities, tc.data),
+			}
+			res := c.exchange(p.toBytes())
+			require.NotNil(t, res)
+			assert.Equal(t, tc.expected, res[14+6:len(res)-1])
+		})
+	}
+}
+
+func TestCommandPrivilegeLevel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	mockRM.EXPECT().GetChassisStatus().
+		Return(&resourcemanager.ChassisStatus{PowerState: resourcemanager.PowerStateOff}, nil).Times(1)
+	mockRM.EXPECT().PowerOn().Return(nil).Times(1)
+	s := newTestSimulator(t, mockRM)
+	powerOn := []byte{uint8(goipmi.ControlPowerUp)}
+
+	t.Run("user session", func(t *testing.T) {
+		c := newLanplusConsole(t, s, 17, "admin", "s3cr3t")
+		c.role = 0x10 | goipmi.PrivLevelUser
+		require.Zero(t, c.openSession())
+		status, _ := c.rakp()
+		require.Zero(t, status)
+
+		res := c.send(goipmi.NetworkFunctionChassis, goipmi.CommandChassisStatus, nil)
+		assert.Equal(t, uint8(goipmi.CommandCompleted), res[0])
+
+		res = c.send(goipmi.NetworkFunctionChassis, goipmi.CommandChassisControl, powerOn)
+		assert.Equal(t, []byte{uint8(goipmi.ErrPrivLevel)}, res)
+
+		res = c.send(goipmi.NetworkFunctionApp, goipmi.CommandSetSessionPrivilegeLevel, []byte{goipmi.PrivLevelOperator})
+		assert.Equal(t, []byte{uint8(errPrivilegeExceedsLimit)}, res)
+	})
+
+	t.Run("administrator session", func(t *testing.T) {
+		c := newLanplusConsole(t, s, 3, "admin", "s3cr3t")
+		require.Zero(t, c.openSession())
+		status, _ := c.rakp()
+		require.Zero(t, status)
+
+		res := c.send(goipmi.NetworkFunctionApp, goipmi.CommandSetSessionPrivilegeLevel, []byte{goipmi.PrivLevelUser})
+		assert.Equal(t, []byte{0x00, goipmi.PrivLevelUser}, res)
+		res = c.send(goipmi.NetworkFunctionChassis, goipmi.CommandChassisControl, powerOn)
+		assert.Equal(t, []byte{uint8(goipmi.ErrPrivLevel)}, res)
+
+		res = c.send(goipmi.NetworkFunctionApp, goipmi.CommandSetSessionPrivilegeLevel, []byte{goipmi.PrivLevelOperator})
+		assert.Equal(t, []byte{0x00, goipmi.PrivLevelOperator}, res)
+		res = c.send(goipmi.NetworkFunctionChassis, goipmi.CommandChassisControl, powerOn)
+		assert.Equal(t, []byte{0x00}, res)
+	})
+}
+
+func TestUnauthenticatedCommands(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	mockRM.EXPECT().GetChassisStatus().
+		Return(&resourcemanager.ChassisStatus{PowerState: resourcemanager.PowerStateOn}, nil).Times(1)
+	s := newTestSimulator(t, mockRM)
+	c := newLanplusConsole(t, s, 17, "admin", "s3cr3t")
+	powerOn := ipmiRequest(goipmi.NetworkFunctionChassis, goipmi.CommandChassisControl, []byte{uint8(goipmi.ControlPowerUp)})
+
+	t.Run("IPMI v1.5 request outside of a session", func(t *testing.T) {
+		p := &lanPacket{authType: goipmi.AuthTypeNone, message: powerOn}
+		res := c.exchange(p.toBytes())
+		require.NotNil(t, res)
+		assert.Equal(t, uint8(goipmi.ErrPrivLevel), res[14+6])
+	})
+
+	t.Run("IPMI v2.0 request outside of a session", func(t *testing.T) {
+		res := c.sessionless(payloadTypeIPMI, payloadTypeIPMI, powerOn)
+		assert.Equal(t, uint8(goipmi.ErrPrivLevel), res[6])
+	})
+
+	t.Run("IPMI v1.5 session challenge with straight password", func(t *testing.T) {
+		data := append([]byte{goipmi.AuthTypePassword}, make([]byte, 16)...)
+		copy(data[1:], "admin")
+		p := &lanPacket{
+			authType: goipmi.AuthTypeNone,
+			message:  ipmiRequest(goipmi.NetworkFunctionApp, goipmi.CommandGetSessionChallenge, data),
+		}
+		res := c.exchange(p.toBytes())
+		require.NotNil(t, res)
+		assert.Equal(t, uint8(goipmi.ErrInvalidPacket), res[14+6])
+	})
+
+	conn := newConnection(s)
+	conn.Username = "admin"
+	conn.Password = "s3cr3t"
+	client, err := goipmi.NewClient(conn)
+	require.NoError(t, err)
+	require.NoError(t, client.Open())
+	defer func() { assert.NoError(t, client.Close()) }()
+	sess := activeSession(t, s)
+
+	// Skip a few sequence numbers ahead of the client, which still gets to close the session afterwards
+	sequence := func() uint32 {
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
+		return sess.inSequence + 4
+	}
+
+	var key [16]byte
+	copy(key[:], "s3cr3t")
+	packet := func(message []byte, key [16]byte) []byte {
+		p := &lanPacket{
+			authType:  goipmi.AuthTypeMD5,
+			sequence:  sequence(),
+			sessionID: sess.id,
+			message:   message,
+		}
+		copy(p.authCode[:], md5AuthCode(key, p))
+		return p.toBytes()
+	}
+
+	t.Run("IPMI v1.5 request with a forged AuthCode", func(t *testing.T) {
+		var forged [16]byte
+		copy(forged[:], "password")
+		assert.Nil(t, c.exchange(packet(powerOn, forged)))
+	})
+
+	t.Run("IPMI v1.5 request with a straight password", func(t *testing.T) {
+		p := &lanPacket{authType: goipmi.AuthTypePassword, sequence: sequence(), sessionID: sess.id, message: powerOn}
+		p.authCode = key
+		assert.Nil(t, c.exchange(p.toBytes()))
+	})
+
+	t.Run("IPMI v1.5 request without AuthCode", func(t *testing.T) {
+		p := &lanPacket{authType: goipmi.AuthTypeNone, sequence: sequence(), sessionID: sess.id, message: powerOn}
+		assert.Nil(t, c.exchange(p.toBytes()))
+	})
+
+	t.Run("IPMI v1.5 replayed request", func(t *testing.T) {
+		request := packet(ipmiRequest(goipmi.NetworkFunctionChassis, goipmi.CommandChassisStatus, nil), key)
+		res := c.exchange(request)
+		require.NotNil(t, res)
+		assert.Equal(t, uint8(goipmi.CommandCompleted), res[14+16+6])
+		assert.Nil(t, c.exchange(request))
+	})
+}
+
+func TestActivateSessionPrivilegeLevel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	s := newTestSimulator(t, mockRM)
+	c := newLanplusConsole(t, s, 17, "admin", "s3cr3t")
+
+	var username [16]byte
+	copy(username[:], "admin")
+	challenge := &lanPacket{
+		authType: goipmi.AuthTypeNone,
+		message:  ipmiRequest(goipmi.NetworkFunctionApp, goipmi.CommandGetSessionChallenge, append([]byte{goipmi.AuthTypeMD5}, username[:]...)),
+	}
+	res := c.exchange(challenge.toBytes())
+	require.NotNil(t, res)
+	data := res[14+6:]
+	require.Equal(t, uint8(goipmi.CommandCompleted), data[0])
+
+	// Activate the session at the OEM proprietary level, which isn't available
+	p := &lanPacket{
+		authType:  goipmi.AuthTypeMD5,
+		sessionID: binary.LittleEndian.Uint32(data[1:5]),
+		message:   ipmiRequest(goipmi.NetworkFunctionApp, goipmi.CommandActivateSession, append([]byte{goipmi.AuthTypeMD5, goipmi.PrivLevelOEM}, append(data[5:21:21], 0, 0, 0, 1)...)),
+	}
+	var key [16]byte
+	copy(key[:], "s3cr3t")
+	copy(p.authCode[:], md5AuthCode(key, p))
+	res = c.exchange(p.toBytes())
+	require.NotNil(t, res)
+	assert.Equal(t, uint8(errMaxPrivilegeExceeded), res[14+16+6])
+	assert.Nil(t, s.server.sessions.lookup(p.sessionID))
+}
+
+// ipmiRequest returns an IPMI request message sent by a remote console
+func ipmiRequest(netfn goipmi.NetworkFunction, command goipmi.Command, data []byte) []byte {
+	msg := []byte{0x20, uint8(netfn) << 2}
+	msg = append(msg, checksum(msg...), 0x81, 0x04, uint8(command))
+	msg = append(msg, data...)
+	return append(msg, checksum(msg[3:]...))
+}
+
+func activeSession(t *testing.T, s *Simulator) *session {
+	h := s.server.sessions
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, sess := range h.sessions {
+		if sess.active {
+			return sess
+		}
+	}
+	require.FailNow(t, "no active session")
+	return nil
+}
+
+func TestDispatchRecovers(t *testing.T) {
+	s := newServer(net.UDPAddr{}, newSessionHandler(credential.NewStaticProvider("admin", "s3cr3t")))
+	s.handle(goipmi.NetworkFunctionChassis, goipmi.CommandChassisStatus, goipmi.PrivLevelNone, func(*request) goipmi.Response {
+		var data []byte
+		return goipmi.CompletionCode(data[1])
+	})
+
+	r := &request{ipmiMessage: &ipmiMessage{
+		netFnRsLUN: uint8(goipmi.NetworkFunctionChassis) << 2,
+		command:    goipmi.CommandChassisStatus,
+	}}
+	assert.Equal(t, []byte{uint8(goipmi.ErrUnspecified)}, s.dispatch(r))
+}
+
+func TestSessionTable(t *testing.T) {
+	newSessions := func(t *testing.T, h *sessionHandler, n int) []*session {
+		sessions := make([]*session, 0, n)
+		for range n {
+			s := h.newSession()
+			require.NotNil(t, s)
+			sessions = append(sessions, s)
+		}
+		return sessions
+	}
+
+	t.Run("oldest pending session is evicted when full", func(t *testing.T) {
+		h := newSessionHandler(credential.NewStaticProvider("admin", "s3cr3t"))
+		sessions := newSessions(t, h, maxSessions)
+		sessions[0].lastActivity = sessions[0].lastActivity.Add(-time.Second)
+		sessions[1].active = true
+		sessions[1].lastActivity = sessions[1].lastActivity.Add(-2 * time.Second)
+
+		require.NotNil(t, h.newSession())
+		assert.Nil(t, h.lookup(sessions[0].id))
+		assert.NotNil(t, h.lookup(sessions[1].id))
+		assert.Len(t, h.sessions, maxSessions)
+	})
+
+	t.Run("active sessions are never evicted", func(t *testing.T) {
+		h := newSessionHandler(credential.NewStaticProvider("admin", "s3cr3t"))
+		for _, s := range newSessions(t, h, maxSessions) {
+			s.active = true
+		}
+
+		assert.Nil(t, h.newSession())
+	})
+
+	t.Run("pending sessions time out sooner", func(t *testing.T) {
+		h := newSessionHandler(credential.NewStaticProvider("admin", "s3cr3t"))
+		sessions := newSessions(t, h, 2)
+		idle := time.Now().Add(-pendingSessionTimeout - time.Second)
+		sessions[0].lastActivity = idle
+		sessions[1].active = true
+		sessions[1].lastActivity = idle
+
+		assert.Nil(t, h.lookup(sessions[0].id))
+		assert.NotNil(t, h.lookup(sessions[1].id))
+	})
+}
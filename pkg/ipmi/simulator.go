@@ -5,6 +5,8 @@ import (
 
 	"github.com/sirupsen/logrus"
 	goipmi "github.com/vmware/goipmi"
+
+	"kubevirt.io/kubevirtbmc/pkg/credential"
 	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
 )
 
@@ -13,46 +15,100 @@ type Simulator struct {
 	port int
 
 	handler *handler
-	sim     *goipmi.Simulator
+	server  *server
+	sol     *solHandler
 }
 
-func NewSimulator(ip string, port int, resourceManager resourcemanager.ResourceManager) *Simulator {
+// NewSimulator returns an IPMI simulator listening on the given address. solPort returns the port the remote consoles
+// reach it at, e.g., through a Service, reported as the port carrying the SOL payload, or 0 if they reach the port
+// directly. It is called whenever the port is reported so that the port can change while the simulator runs.
+func NewSimulator(
+	ip string,
+	port int,
+	solPort func() int,
+	resourceManager resourcemanager.ResourceManager,
+	credentials credential.Provider,
+	version string,
+) *Simulator {
+	server := newServer(net.UDPAddr{
+		IP:   net.ParseIP(ip).To4(),
+		Port: port,
+	}, newSessionHandler(credentials))
 	return &Simulator{
 		ip:   ip,
 		port: port,
 
-		handler: NewHandler(resourceManager),
-		sim: goipmi.NewSimulator(net.UDPAddr{
-			IP:   net.ParseIP(ip).To4(),
-			Port: port,
-		}),
+		handler: NewHandler(resourceManager, version),
+		server:  server,
+		sol:     newSOLHandler(resourceManager, server, solPort),
 	}
 }
 
 func (s *Simulator) initialize() {
-	s.sim.SetHandler(
+	s.server.setHandler(
+		goipmi.NetworkFunctionApp,
+		goipmi.CommandGetDeviceID,
+		goipmi.PrivLevelUser,
+		s.handler.deviceIDHandler,
+	)
+	s.server.setHandler(
+		goipmi.NetworkFunctionApp,
+		commandGetSystemGUID,
+		goipmi.PrivLevelUser,
+		s.handler.systemGUIDHandler,
+	)
+	s.server.setHandler(
+		goipmi.NetworkFunctionApp,
+		commandSetACPIPowerState,
+		goipmi.PrivLevelAdmin,
+		s.handler.setACPIPowerStateHandler,
+	)
+	s.server.setHandler(
+		goipmi.NetworkFunctionApp,
+		commandGetACPIPowerState,
+		goipmi.PrivLevelUser,
+		s.handler.getACPIPowerStateHandler,
+	)
+	s.server.setHandler(
 		goipmi.NetworkFunctionChassis,
 		goipmi.CommandChassisStatus,
+		goipmi.PrivLevelUser,
 		s.handler.chassisStatusHandler,
 	)
-	s.sim.SetHandler(
+	s.server.setHandler(
 		goipmi.NetworkFunctionChassis,
 		goipmi.CommandChassisControl,
+		goipmi.PrivLevelOperator,
 		s.handler.chassisControlHandler,
 	)
-	s.sim.SetHandler(
+	s.server.setHandler(
 		goipmi.NetworkFunctionChassis,
 		goipmi.CommandSetSystemBootOptions,
+		goipmi.PrivLevelOperator,
 		s.handler.setSystemBootOptionsHandler,
 	)
+	s.server.setHandler(
+		goipmi.NetworkFunctionChassis,
+		goipmi.CommandGetSystemBootOptions,
+		goipmi.PrivLevelOperator,
+		s.handler.getSystemBootOptionsHandler,
+	)
+
+	// Serial Over LAN
+	s.server.handle(goipmi.NetworkFunctionApp, commandActivatePayload, goipmi.PrivLevelUser, s.sol.activatePayloadHandler)
+	s.server.handle(goipmi.NetworkFunctionApp, commandDeactivatePayload, goipmi.PrivLevelUser, s.sol.deactivatePayloadHandler)
+	s.server.handle(goipmi.NetworkFunctionApp, commandGetPayloadActivationStatus, goipmi.PrivLevelUser, s.sol.payloadActivationStatusHandler)
+	s.server.handle(networkFunctionTransport, commandGetSOLConfigParameters, goipmi.PrivLevelUser, s.sol.getSOLConfigHandler)
+	s.server.handle(networkFunctionTransport, commandSetSOLConfigParameters, goipmi.PrivLevelAdmin, s.sol.setSOLConfigHandler)
+	s.server.setPayloadHandler(payloadTypeSOL, s.sol.payloadHandler)
 }
 
 func (s *Simulator) Run() error {
 	s.initialize()
-	return s.sim.Run()
+	return s.server.run()
 }
 
 func (s *Simulator) Stop() {
-	s.sim.Stop()
-	logrus.Info("Redfish emulator gracefully stopped")
+	s.server.stop()
+	logrus.Info("IPMI simulator gracefully stopped")
 }
@@ -0,0 +1,672 @@
+package ipmi
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	goipmi "github.com/vmware/goipmi"
+
+	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
+)
+
+// networkFunctionTransport is missing from the goipmi network functions
+const networkFunctionTransport = goipmi.NetworkFunction(0x0c)
+
+// Payload commands per section 24 and SOL configuration commands per section 26, missing from the goipmi command
+// numbers
+const (
+	commandActivatePayload            = goipmi.Command(0x48)
+	commandDeactivatePayload          = goipmi.Command(0x49)
+	commandGetPayloadActivationStatus = goipmi.Command(0x4a)
+	commandSetSOLConfigParameters     = goipmi.Command(0x21)
+	commandGetSOLConfigParameters     = goipmi.Command(0x22)
+)
+
+// Completion codes specific to the payload commands per section 24.1 and 24.2, and to the SOL configuration commands
+// per section 26.2 and 26.3
+const (
+	errPayloadAlreadyActive      = goipmi.CompletionCode(0x80)
+	errPayloadTypeDisabled       = goipmi.CompletionCode(0x81)
+	errPayloadActivationLimit    = goipmi.CompletionCode(0x82)
+	errPayloadEncryptionRequired = goipmi.CompletionCode(0x84)
+	errPayloadAlreadyInactive    = goipmi.CompletionCode(0x80)
+	errSOLParamNotSupported      = goipmi.CompletionCode(0x80)
+	errSOLParamReadOnly          = goipmi.CompletionCode(0x82)
+)
+
+// SOL configuration parameters per section 26.3
+const (
+	solParamSetInProgress   = 0
+	solParamEnable          = 1
+	solParamAuthentication  = 2
+	solParamAccumulate      = 3
+	solParamRetry           = 4
+	solParamBitRate         = 5
+	solParamVolatileBitRate = 6
+	solParamChannel         = 7
+	solParamPort            = 8
+
+	solParamRevision = 0x11
+	// solForceEncryption and solForceAuthentication are always set in the SOL authentication parameter, as the
+	// payloads are always sealed like the IPMI messages of the session
+	solForceEncryption     = 0x80
+	solForceAuthentication = 0x40
+)
+
+// Bits of the operation and status field of the SOL packets per section 15.9
+const (
+	solNACK                         = 0x40
+	solCharacterTransferUnavailable = 0x20
+	solDeactivating                 = 0x10
+)
+
+const (
+	solHeaderSize = 4
+	// solMaxPayloadSize bounds the size of the SOL packets both ways, header included
+	solMaxPayloadSize = 255
+	// solInstance is the only payload instance, the virtual machine having a single serial console
+	solInstance = 1
+	// solReconnectInterval is the time to wait before connecting to the serial console again, e.g., while the virtual
+	// machine restarts
+	solReconnectInterval = time.Second
+	// solInputQueueSize is the number of packets from the remote console waiting to be written to the serial console,
+	// beyond which they are refused
+	solInputQueueSize = 16
+)
+
+// solConfig holds the SOL configuration parameters
+type solConfig struct {
+	setInProgress uint8
+	enabled       bool
+	privilege     uint8
+	// accumulateInterval is in 5 ms units
+	accumulateInterval uint8
+	sendThreshold      uint8
+	retryCount         uint8
+	// retryInterval is in 10 ms units
+	retryInterval   uint8
+	bitRate         uint8
+	volatileBitRate uint8
+}
+
+// solAck is the acknowledgement of a packet sent to the remote console
+type solAck struct {
+	sequence uint8
+	count    uint8
+	nack     bool
+}
+
+// solHandler bridges the Serial Over LAN payload of the RMCP+ sessions to the serial console of the virtual machine.
+// The serial console being a single stream, the payload is active in a single session at a time.
+type solHandler struct {
+	rm     resourcemanager.ResourceManager
+	server *server
+	// port returns the port the remote consoles reach the BMC at, e.g., through a Service, or 0 if they reach the port
+	// the BMC listens on. It is nil in the latter case as well.
+	port func() int
+
+	mu     sync.Mutex
+	config solConfig
+	active *solSession
+}
+
+func newSOLHandler(rm resourcemanager.ResourceManager, server *server, port func() int) *solHandler {
+	return &solHandler{
+		rm:     rm,
+		server: server,
+		port:   port,
+		config: solConfig{
+			enabled:            true,
+			privilege:          goipmi.PrivLevelUser,
+			accumulateInterval: 12, // 60 ms
+			sendThreshold:      96,
+			retryCount:         7,
+			retryInterval:      50,   // 500 ms
+			bitRate:            0x0a, // 115.2 kbps
+			volatileBitRate:    0x0a,
+		},
+	}
+}
+
+// activatePayloadHandler answers Activate Payload per section 24.1
+func (h *solHandler) activatePayloadHandler(r *request) goipmi.Response {
+	if len(r.data) < 6 {
+		return goipmi.ErrRequestData
+	}
+	if r.data[0]&payloadTypeMask != payloadTypeSOL || r.data[1]&0x0f != solInstance {
+		return goipmi.ErrInvalidPacket
+	}
+	// Payloads are only carried by the RMCP+ sessions
+	if r.session == nil || r.session.cipherSuite == nil {
+		return goipmi.ErrInvalidCommand
+	}
+	if r.data[2]&0x80 == 0 {
+		return errPayloadEncryptionRequired
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.config.enabled {
+		return errPayloadTypeDisabled
+	}
+	if r.session.privilege < h.config.privilege {
+		return goipmi.ErrPrivLevel
+	}
+	if h.active != nil {
+		if h.server.sessions.alive(h.active.session) {
+			logrus.Warnf("SOL already active in session 0x%08x", h.active.session.id)
+			return errPayloadAlreadyActive
+		}
+		h.active.close()
+		h.active = nil
+	}
+
+	// The serial console may be held by another client of the BMC, e.g., a WebSocket
+	release, err := h.rm.AcquireSerialConsole()
+	if err != nil {
+		logrus.Warnf("SOL not activated in session 0x%08x: %v", r.session.id, err)
+		return errPayloadActivationLimit
+	}
+
+	h.active = newSOLSession(h, r.session, h.config, release)
+	logrus.Infof("SOL activated in session 0x%08x", r.session.id)
+
+	res := []byte{uint8(goipmi.CommandCompleted), 0x00, 0x00, 0x00, 0x00}
+	res = binary.LittleEndian.AppendUint16(res, solMaxPayloadSize)
+	res = binary.LittleEndian.AppendUint16(res, solMaxPayloadSize)
+	res = binary.LittleEndian.AppendUint16(res, h.payloadPort())
+	res = binary.LittleEndian.AppendUint16(res, 0xffff) // no VLAN
+	return rawResponse(res)
+}
+
+// payloadPort returns the port carrying the SOL payload, which is the one the RMCP+ sessions are received on
+func (h *solHandler) payloadPort() uint16 {
+	if h.port != nil {
+		if port := h.port(); port != 0 {
+			return uint16(port)
+		}
+	}
+	return uint16(h.server.localAddr().Port)
+}
+
+// deactivatePayloadHandler answers Deactivate Payload per section 24.2. The payload can be deactivated from any
+// session, e.g., to take the serial console over from a remote console which is gone.
+func (h *solHandler) deactivatePayloadHandler(r *request) goipmi.Response {
+	if len(r.data) < 6 {
+		return goipmi.ErrRequestData
+	}
+	if r.data[0]&payloadTypeMask != payloadTypeSOL || r.data[1]&0x0f != solInstance {
+		return goipmi.ErrInvalidPacket
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.active == nil {
+		return errPayloadAlreadyInactive
+	}
+	logrus.Infof("SOL deactivated in session 0x%08x", h.active.session.id)
+	h.active.close()
+	h.active = nil
+
+	return goipmi.CommandCompleted
+}
+
+// payloadActivationStatusHandler answers Get Payload Activation Status per section 24.4
+func (h *solHandler) payloadActivationStatusHandler(r *request) goipmi.Response {
+	if len(r.data) < 1 {
+		return goipmi.ErrRequestData
+	}
+	if r.data[0]&payloadTypeMask != payloadTypeSOL {
+		return goipmi.ErrInvalidPacket
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var activated uint8
+	if h.active != nil {
+		activated = 1 << (solInstance - 1)
+	}
+	return rawResponse{uint8(goipmi.CommandCompleted), solInstance, activated, 0x00}
+}
+
+// getSOLConfigHandler answers Get SOL Configuration Parameters per section 26.3
+func (h *solHandler) getSOLConfigHandler(r *request) goipmi.Response {
+	if len(r.data) < 4 {
+		return goipmi.ErrRequestData
+	}
+	if channel := r.data[0] & 0x0f; channel != 0x01 && channel != 0x0e {
+		return goipmi.ErrInvalidPacket
+	}
+	// Only the revision is returned when asked so
+	if r.data[0]&0x80 != 0 {
+		return rawResponse{uint8(goipmi.CommandCompleted), solParamRevision}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var data []byte
+	switch r.data[1] {
+	case solParamSetInProgress:
+		data = []byte{h.config.setInProgress}
+	case solParamEnable:
+		data = []byte{0x00}
+		if h.config.enabled {
+			data[0] = 0x01
+		}
+	case solParamAuthentication:
+		data = []byte{solForceEncryption | solForceAuthentication | h.config.privilege}
+	case solParamAccumulate:
+		data = []byte{h.config.accumulateInterval, h.config.sendThreshold}
+	case solParamRetry:
+		data = []byte{h.config.retryCount, h.config.retryInterval}
+	case solParamBitRate:
+		data = []byte{h.config.bitRate}
+	case solParamVolatileBitRate:
+		data = []byte{h.config.volatileBitRate}
+	case solParamChannel:
+		data = []byte{0x01}
+	case solParamPort:
+		data = binary.LittleEndian.AppendUint16(nil, h.payloadPort())
+	default:
+		return errSOLParamNotSupported
+	}
+
+	return rawResponse(append([]byte{uint8(goipmi.CommandCompleted), solParamRevision}, data...))
+}
+
+// setSOLConfigHandler answers Set SOL Configuration Parameters per section 26.2
+func (h *solHandler) setSOLConfigHandler(r *request) goipmi.Response {
+	if len(r.data) < 3 {
+		return goipmi.ErrRequestData
+	}
+	if channel := r.data[0] & 0x0f; channel != 0x01 && channel != 0x0e {
+		return goipmi.ErrInvalidPacket
+	}
+	param, data := r.data[1], r.data[2:]
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch param {
+	case solParamSetInProgress:
+		h.config.setInProgress = data[0] & 0x03
+	case solParamEnable:
+		h.config.enabled = data[0]&0x01 != 0
+		if !h.config.enabled && h.active != nil {
+			logrus.Infof("SOL disabled, deactivating it in session 0x%08x", h.active.session.id)
+			h.active.deactivate()
+			h.active = nil
+		}
+	case solParamAuthentication:
+		// Encryption and authentication are always forced, only the privilege level can be changed
+		privilege := data[0] & 0x0f
+		if privilege < goipmi.PrivLevelUser || privilege > goipmi.PrivLevelOEM {
+			return goipmi.ErrInvalidPacket
+		}
+		h.config.privilege = privilege
+	case solParamAccumulate:
+		if len(data) < 2 {
+			return goipmi.ErrRequestData
+		}
+		if data[0] == 0 {
+			return goipmi.ErrInvalidPacket
+		}
+		h.config.accumulateInterval, h.config.sendThreshold = data[0], data[1]
+	case solParamRetry:
+		if len(data) < 2 {
+			return goipmi.ErrRequestData
+		}
+		h.config.retryCount, h.config.retryInterval = data[0]&0x07, data[1]
+	case solParamBitRate, solParamVolatileBitRate:
+		bitRate := data[0] & 0x0f
+		if bitRate != 0 && (bitRate < 0x06 || bitRate > 0x0a) {
+			return goipmi.ErrInvalidPacket
+		}
+		if param == solParamBitRate {
+			h.config.bitRate = bitRate
+		} else {
+			h.config.volatileBitRate = bitRate
+		}
+	case solParamChannel, solParamPort:
+		return errSOLParamReadOnly
+	default:
+		return errSOLParamNotSupported
+	}
+
+	return goipmi.CommandCompleted
+}
+
+// payloadHandler handles the SOL packets received from the remote consoles per section 15.9, returning the
+// acknowledgement of the packets carrying data
+func (h *solHandler) payloadHandler(s *session, payload []byte) []byte {
+	h.mu.Lock()
+	sol := h.active
+	h.mu.Unlock()
+
+	if sol == nil || sol.session != s || len(payload) < solHeaderSize {
+		return nil
+	}
+	return sol.receive(payload)
+}
+
+// solSession is the SOL payload activated in a session
+type solSession struct {
+	h       *solHandler
+	session *session
+	config  solConfig
+
+	acks   chan solAck
+	input  chan []byte
+	output chan []byte
+	done   chan struct{}
+	once   sync.Once
+
+	// inSequence is the sequence number of the last packet received from the remote console, only accessed by the
+	// server goroutine
+	inSequence uint8
+
+	mu      sync.Mutex
+	console io.ReadWriteCloser
+
+	// release gives the serial console back once the payload is deactivated
+	release func()
+}
+
+func newSOLSession(h *solHandler, s *session, config solConfig, release func()) *solSession {
+	sol := &solSession{
+		h:       h,
+		session: s,
+		config:  config,
+		acks:    make(chan solAck, 1),
+		input:   make(chan []byte, solInputQueueSize),
+		output:  make(chan []byte),
+		done:    make(chan struct{}),
+		release: release,
+	}
+	go sol.connect()
+	go sol.deliver()
+	go sol.transmit()
+	return sol
+}
+
+// receive queues the characters of a packet from the remote console for the serial console and returns the
+// acknowledgement of the packet, if it needs one. The packet is refused if the characters can't be queued, so that the
+// remote console sends them again.
+func (sol *solSession) receive(payload []byte) []byte {
+	sequence, ackSequence, count, operation := payload[0]&0x0f, payload[1]&0x0f, payload[2], payload[3]
+
+	if ackSequence != 0 {
+		select {
+		case sol.acks <- solAck{sequence: ackSequence, count: count, nack: operation&solNACK != 0}:
+		default:
+		}
+	}
+	if sequence == 0 {
+		return nil
+	}
+
+	data := payload[solHeaderSize:]
+	// A retransmitted packet has been queued already, only its acknowledgement has been lost
+	if sequence != sol.inSequence {
+		if !sol.queue(data) {
+			return []byte{0x00, sequence, 0x00, solNACK | solCharacterTransferUnavailable}
+		}
+		sol.inSequence = sequence
+	}
+	return []byte{0x00, sequence, uint8(len(data)), 0x00}
+}
+
+// queue hands characters over to the deliver goroutine, returning false if the serial console isn't connected or too
+// many characters are waiting already
+func (sol *solSession) queue(data []byte) bool {
+	sol.mu.Lock()
+	connected := sol.console != nil
+	sol.mu.Unlock()
+
+	if !connected {
+		return false
+	}
+	select {
+	case sol.input <- append([]byte(nil), data...):
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver writes the characters received from the remote console to the serial console until the payload is
+// deactivated, so that a slow serial console never holds the server goroutine up
+func (sol *solSession) deliver() {
+	for {
+		var data []byte
+		select {
+		case <-sol.done:
+			return
+		case data = <-sol.input:
+		}
+
+		sol.mu.Lock()
+		console := sol.console
+		sol.mu.Unlock()
+
+		if console == nil {
+			logrus.Debugf("serial console disconnected, dropping %d characters", len(data))
+			continue
+		}
+		if _, err := console.Write(data); err != nil {
+			logrus.Debugf("unable to write to the serial console: %v", err)
+		}
+	}
+}
+
+// connect connects to the serial console and forwards its output until the payload is deactivated, connecting again
+// whenever the connection is lost because the virtual machine restarts. The payload is deactivated if the connection is
+// lost while the virtual machine keeps running, i.e., another client such as virtctl took the serial console over, which
+// connecting again would take back.
+func (sol *solSession) connect() {
+	for {
+		console, err := sol.h.rm.SerialConsole()
+		if err == nil {
+			sol.mu.Lock()
+			select {
+			case <-sol.done:
+				sol.mu.Unlock()
+				_ = console.Close()
+				return
+			default:
+				sol.console = console
+			}
+			sol.mu.Unlock()
+
+			sol.forward(console)
+
+			sol.mu.Lock()
+			sol.console = nil
+			sol.mu.Unlock()
+			_ = console.Close()
+		} else {
+			logrus.Debugf("unable to connect to the serial console: %v", err)
+		}
+
+		// Leave the virtual machine status some time to catch up with the lost connection
+		select {
+		case <-sol.done:
+			return
+		case <-time.After(solReconnectInterval):
+		}
+
+		if err == nil && sol.takenOver() {
+			logrus.Infof("serial console taken over, deactivating SOL in session 0x%08x", sol.session.id)
+			sol.h.release(sol)
+			return
+		}
+	}
+}
+
+// takenOver tells whether the virtual machine is still running, the connection to its serial console being lost
+func (sol *solSession) takenOver() bool {
+	status, err := sol.h.rm.GetChassisStatus()
+	if err != nil {
+		logrus.Debugf("unable to get the chassis status: %v", err)
+		return false
+	}
+	return status.PowerState == resourcemanager.PowerStateOn || status.PowerState == resourcemanager.PowerStatePaused
+}
+
+// forward passes the output of the serial console to the transmit goroutine until the console is closed
+func (sol *solSession) forward(console io.Reader) {
+	buf := make([]byte, solMaxPayloadSize-solHeaderSize)
+	for {
+		n, err := console.Read(buf)
+		if n > 0 {
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			select {
+			case sol.output <- data:
+			case <-sol.done:
+				return
+			}
+		}
+		if err != nil {
+			logrus.Debugf("serial console closed: %v", err)
+			return
+		}
+	}
+}
+
+// transmit sends the output of the serial console to the remote console, retransmitting the packets until they are
+// acknowledged. The payload is deactivated once the remote console stops answering or its session is gone.
+func (sol *solSession) transmit() {
+	accumulateInterval := time.Duration(sol.config.accumulateInterval) * 5 * time.Millisecond
+	retryInterval := max(time.Duration(sol.config.retryInterval)*10*time.Millisecond, 10*time.Millisecond)
+	ticker := time.NewTicker(sessionTimeout / 4)
+	defer ticker.Stop()
+
+	var sequence uint8
+	for {
+		var data []byte
+		select {
+		case <-sol.done:
+			return
+		case <-ticker.C:
+			if !sol.h.server.sessions.alive(sol.session) {
+				sol.h.release(sol)
+				return
+			}
+			continue
+		case data = <-sol.output:
+		}
+
+		// Gather the characters coming shortly after so as not to send a packet per character
+		timer := time.NewTimer(accumulateInterval)
+	accumulate:
+		for len(data) < int(sol.config.sendThreshold) && len(data) < solMaxPayloadSize-solHeaderSize {
+			select {
+			case more := <-sol.output:
+				data = append(data, more...)
+			case <-timer.C:
+				break accumulate
+			case <-sol.done:
+				timer.Stop()
+				return
+			}
+		}
+		timer.Stop()
+
+		for len(data) > 0 {
+			sequence = sequence%15 + 1
+			chunk := data[:min(len(data), solMaxPayloadSize-solHeaderSize)]
+			count, ok := sol.send(sequence, chunk, 0, retryInterval)
+			if !ok {
+				logrus.Warnf("SOL packets not acknowledged in session 0x%08x, deactivating it", sol.session.id)
+				sol.h.release(sol)
+				return
+			}
+			data = data[count:]
+		}
+	}
+}
+
+// send sends a packet until it is acknowledged, returning the number of characters accepted by the remote console,
+// or false if it doesn't acknowledge the packet or the payload is deactivated. A packet NACKed by the remote console is
+// held and sent again after the retry interval without counting as a retry, the remote console being there but unable
+// to take the characters for now.
+func (sol *solSession) send(sequence uint8, data []byte, status uint8, retryInterval time.Duration) (int, bool) {
+	packet := append([]byte{sequence, 0x00, 0x00, status}, data...)
+
+	for attempt := 0; attempt <= int(sol.config.retryCount); {
+		if err := sol.h.server.sendPayload(sol.session, payloadTypeSOL, packet); err != nil {
+			logrus.Debugf("unable to send SOL packet: %v", err)
+		}
+
+		nacked := false
+		timer := time.NewTimer(retryInterval)
+	wait:
+		for {
+			select {
+			case ack := <-sol.acks:
+				if ack.sequence != sequence {
+					continue
+				}
+				if ack.nack {
+					nacked = true
+					continue
+				}
+				if ack.count == 0 {
+					// The remote console can't take the characters yet, try again later
+					continue
+				}
+				timer.Stop()
+				return min(int(ack.count), len(data)), true
+			case <-timer.C:
+				break wait
+			case <-sol.done:
+				timer.Stop()
+				return 0, false
+			}
+		}
+		if !nacked {
+			attempt++
+		}
+	}
+	return 0, false
+}
+
+// deactivate tells the remote console the BMC deactivates the payload, then closes it
+func (sol *solSession) deactivate() {
+	// Best effort, the remote console may be gone already
+	_ = sol.h.server.sendPayload(sol.session, payloadTypeSOL, []byte{0x00, 0x00, 0x00, solDeactivating})
+	sol.close()
+}
+
+// close stops forwarding the serial console and gives it back
+func (sol *solSession) close() {
+	sol.once.Do(func() {
+		close(sol.done)
+
+		sol.mu.Lock()
+		defer sol.mu.Unlock()
+		if sol.console != nil {
+			_ = sol.console.Close()
+		}
+		sol.release()
+	})
+}
+
+// release deactivates a payload which is still the active one
+func (h *solHandler) release(sol *solSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.active == sol {
+		h.active = nil
+	}
+	sol.deactivate()
+}
@@ -0,0 +1,340 @@
+package ipmi
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	goipmi "github.com/vmware/goipmi"
+	"go.uber.org/mock/gomock"
+
+	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
+)
+
+// solConsole opens an RMCP+ session at the Administrator privilege level for the SOL tests
+func solConsole(t *testing.T, s *Simulator) *lanplusConsole {
+	c := newLanplusConsole(t, s, 17, "admin", "s3cr3t")
+	require.Zero(t, c.openSession())
+	status, _ := c.rakp()
+	require.Zero(t, status)
+	require.Equal(t, []byte{0x00, goipmi.PrivLevelAdmin}, c.send(goipmi.NetworkFunctionApp, goipmi.CommandSetSessionPrivilegeLevel, []byte{goipmi.PrivLevelAdmin}))
+	return c
+}
+
+// solPacket returns the next SOL packet sent by the BMC
+func solPacket(t *testing.T, c *lanplusConsole) []byte {
+	packet := c.read(2 * time.Second)
+	require.NotNil(t, packet, "no SOL packet received")
+	payloadType, payload := c.open(packet)
+	require.Equal(t, uint8(payloadTypeSOL), payloadType)
+	return payload
+}
+
+// serialReader returns the chunks written to the serial console by the BMC, the channel being closed along with the
+// console
+func serialReader(console io.Reader) <-chan []byte {
+	written := make(chan []byte, 16)
+	go func() {
+		defer close(written)
+		buf := make([]byte, 256)
+		for {
+			n, err := console.Read(buf)
+			if err != nil {
+				return
+			}
+			written <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+	return written
+}
+
+func TestSOLPayload(t *testing.T) {
+	bmcEnd, vmEnd := net.Pipe()
+	t.Cleanup(func() { _ = vmEnd.Close() })
+
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	released := make(chan struct{})
+	mockRM.EXPECT().AcquireSerialConsole().Return(func() { close(released) }, nil)
+	mockRM.EXPECT().SerialConsole().Return(bmcEnd, nil)
+	s := newTestSimulator(t, mockRM)
+	c := solConsole(t, s)
+	written := serialReader(vmEnd)
+
+	// The SOL payload is only carried encrypted
+	res := c.send(goipmi.NetworkFunctionApp, commandActivatePayload, []byte{payloadTypeSOL, solInstance, 0x00, 0x00, 0x00, 0x00})
+	assert.Equal(t, []byte{uint8(errPayloadEncryptionRequired)}, res)
+
+	res = c.send(goipmi.NetworkFunctionApp, commandActivatePayload, []byte{payloadTypeSOL, solInstance, 0xc0, 0x00, 0x00, 0x00})
+	port := binary.LittleEndian.AppendUint16(nil, uint16(s.server.localAddr().Port))
+	assert.Equal(t, append(append([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x00, 0xff, 0x00}, port...), 0xff, 0xff), res)
+
+	res = c.send(goipmi.NetworkFunctionApp, commandGetPayloadActivationStatus, []byte{payloadTypeSOL})
+	assert.Equal(t, []byte{0x00, solInstance, 0x01, 0x00}, res)
+
+	res = c.send(goipmi.NetworkFunctionApp, commandActivatePayload, []byte{payloadTypeSOL, solInstance, 0xc0, 0x00, 0x00, 0x00})
+	assert.Equal(t, []byte{uint8(errPayloadAlreadyActive)}, res)
+
+	// The output of the serial console reaches the remote console
+	go func() { _, _ = vmEnd.Write([]byte("login: ")) }()
+	assert.Equal(t, append([]byte{0x01, 0x00, 0x00, 0x00}, "login: "...), solPacket(t, c))
+	_, err := c.conn.Write(c.seal(payloadTypeSOL, []byte{0x00, 0x01, 0x07, 0x00}))
+	require.NoError(t, err)
+
+	// The characters typed on the remote console reach the serial console
+	_, ack := c.open(c.exchange(c.seal(payloadTypeSOL, append([]byte{0x01, 0x00, 0x00, 0x00}, "root\r"...))))
+	assert.Equal(t, []byte{0x00, 0x01, 0x05, 0x00}, ack)
+	assert.Equal(t, []byte("root\r"), <-written)
+
+	// A retransmitted packet is acknowledged again but written once
+	_, ack = c.open(c.exchange(c.seal(payloadTypeSOL, append([]byte{0x01, 0x00, 0x00, 0x00}, "root\r"...))))
+	assert.Equal(t, []byte{0x00, 0x01, 0x05, 0x00}, ack)
+	_, ack = c.open(c.exchange(c.seal(payloadTypeSOL, append([]byte{0x02, 0x00, 0x00, 0x00}, "ls\r"...))))
+	assert.Equal(t, []byte{0x00, 0x02, 0x03, 0x00}, ack)
+	assert.Equal(t, []byte("ls\r"), <-written)
+
+	res = c.send(goipmi.NetworkFunctionApp, commandDeactivatePayload, []byte{payloadTypeSOL, solInstance, 0x00, 0x00, 0x00, 0x00})
+	assert.Equal(t, []byte{0x00}, res)
+	res = c.send(goipmi.NetworkFunctionApp, commandDeactivatePayload, []byte{payloadTypeSOL, solInstance, 0x00, 0x00, 0x00, 0x00})
+	assert.Equal(t, []byte{uint8(errPayloadAlreadyInactive)}, res)
+
+	// The serial console is closed and given back along with the payload
+	select {
+	case _, ok := <-written:
+		assert.False(t, ok)
+	case <-time.After(2 * time.Second):
+		assert.Fail(t, "serial console not closed")
+	}
+	select {
+	case <-released:
+	default:
+		assert.Fail(t, "serial console not released")
+	}
+}
+
+func TestSOLPayloadNotAcknowledged(t *testing.T) {
+	bmcEnd, vmEnd := net.Pipe()
+	t.Cleanup(func() { _ = vmEnd.Close() })
+
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	mockRM.EXPECT().AcquireSerialConsole().Return(func() {}, nil)
+	mockRM.EXPECT().SerialConsole().Return(bmcEnd, nil)
+	s := newTestSimulator(t, mockRM)
+	c := solConsole(t, s)
+
+	// A single retry, 10 ms after the first attempt
+	res := c.send(networkFunctionTransport, commandSetSOLConfigParameters, []byte{0x01, solParamRetry, 0x01, 0x01})
+	require.Equal(t, []byte{0x00}, res)
+	res = c.send(goipmi.NetworkFunctionApp, commandActivatePayload, []byte{payloadTypeSOL, solInstance, 0xc0, 0x00, 0x00, 0x00})
+	require.Equal(t, uint8(goipmi.CommandCompleted), res[0])
+
+	go func() { _, _ = vmEnd.Write([]byte("x")) }()
+	assert.Equal(t, []byte{0x01, 0x00, 0x00, 0x00, 'x'}, solPacket(t, c))
+	assert.Equal(t, []byte{0x01, 0x00, 0x00, 0x00, 'x'}, solPacket(t, c))
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, solDeactivating}, solPacket(t, c))
+
+	res = c.send(goipmi.NetworkFunctionApp, commandGetPayloadActivationStatus, []byte{payloadTypeSOL})
+	assert.Equal(t, []byte{0x00, solInstance, 0x00, 0x00}, res)
+}
+
+func TestSOLPayloadNACKed(t *testing.T) {
+	bmcEnd, vmEnd := net.Pipe()
+	t.Cleanup(func() { _ = vmEnd.Close() })
+
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	mockRM.EXPECT().AcquireSerialConsole().Return(func() {}, nil)
+	mockRM.EXPECT().SerialConsole().Return(bmcEnd, nil)
+	s := newTestSimulator(t, mockRM)
+	c := solConsole(t, s)
+
+	// A single retry, 10 ms after the first attempt
+	res := c.send(networkFunctionTransport, commandSetSOLConfigParameters, []byte{0x01, solParamRetry, 0x01, 0x01})
+	require.Equal(t, []byte{0x00}, res)
+	res = c.send(goipmi.NetworkFunctionApp, commandActivatePayload, []byte{payloadTypeSOL, solInstance, 0xc0, 0x00, 0x00, 0x00})
+	require.Equal(t, uint8(goipmi.CommandCompleted), res[0])
+
+	// The packet is held while the remote console NACKs it, however many retries that takes
+	go func() { _, _ = vmEnd.Write([]byte("x")) }()
+	for range 3 {
+		assert.Equal(t, []byte{0x01, 0x00, 0x00, 0x00, 'x'}, solPacket(t, c))
+		_, err := c.conn.Write(c.seal(payloadTypeSOL, []byte{0x00, 0x01, 0x00, solNACK}))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []byte{0x01, 0x00, 0x00, 0x00, 'x'}, solPacket(t, c))
+	_, err := c.conn.Write(c.seal(payloadTypeSOL, []byte{0x00, 0x01, 0x01, 0x00}))
+	require.NoError(t, err)
+
+	// The payload stays active and carries the next characters
+	go func() { _, _ = vmEnd.Write([]byte("y")) }()
+	assert.Equal(t, []byte{0x02, 0x00, 0x00, 0x00, 'y'}, solPacket(t, c))
+	_, err = c.conn.Write(c.seal(payloadTypeSOL, []byte{0x00, 0x02, 0x01, 0x00}))
+	require.NoError(t, err)
+
+	res = c.send(goipmi.NetworkFunctionApp, commandGetPayloadActivationStatus, []byte{payloadTypeSOL})
+	assert.Equal(t, []byte{0x00, solInstance, 0x01, 0x00}, res)
+	res = c.send(goipmi.NetworkFunctionApp, commandDeactivatePayload, []byte{payloadTypeSOL, solInstance, 0x00, 0x00, 0x00, 0x00})
+	assert.Equal(t, []byte{0x00}, res)
+}
+
+func TestSOLSerialConsoleDisconnected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	mockRM.EXPECT().AcquireSerialConsole().Return(func() {}, nil)
+	mockRM.EXPECT().SerialConsole().Return(nil, errors.New("vmi not running")).AnyTimes()
+	s := newTestSimulator(t, mockRM)
+	c := solConsole(t, s)
+
+	res := c.send(goipmi.NetworkFunctionApp, commandActivatePayload, []byte{payloadTypeSOL, solInstance, 0xc0, 0x00, 0x00, 0x00})
+	require.Equal(t, uint8(goipmi.CommandCompleted), res[0])
+
+	// The characters can't be written, none is accepted so that the remote console sends them again
+	_, ack := c.open(c.exchange(c.seal(payloadTypeSOL, append([]byte{0x01, 0x00, 0x00, 0x00}, "root\r"...))))
+	assert.Equal(t, []byte{0x00, 0x01, 0x00, solNACK | solCharacterTransferUnavailable}, ack)
+	_, ack = c.open(c.exchange(c.seal(payloadTypeSOL, append([]byte{0x01, 0x00, 0x00, 0x00}, "root\r"...))))
+	assert.Equal(t, []byte{0x00, 0x01, 0x00, solNACK | solCharacterTransferUnavailable}, ack)
+}
+
+func TestSOLSerialConsoleInUse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	mockRM.EXPECT().AcquireSerialConsole().Return(nil, resourcemanager.ErrSerialConsoleInUse)
+	s := newTestSimulator(t, mockRM)
+	c := solConsole(t, s)
+
+	// The serial console is held by another client of the BMC, e.g., a WebSocket
+	res := c.send(goipmi.NetworkFunctionApp, commandActivatePayload, []byte{payloadTypeSOL, solInstance, 0xc0, 0x00, 0x00, 0x00})
+	assert.Equal(t, []byte{uint8(errPayloadActivationLimit)}, res)
+
+	res = c.send(goipmi.NetworkFunctionApp, commandGetPayloadActivationStatus, []byte{payloadTypeSOL})
+	assert.Equal(t, []byte{0x00, solInstance, 0x00, 0x00}, res)
+}
+
+func TestSOLConsoleTakenOver(t *testing.T) {
+	bmcEnd, vmEnd := net.Pipe()
+
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	mockRM.EXPECT().AcquireSerialConsole().Return(func() {}, nil)
+	mockRM.EXPECT().SerialConsole().Return(bmcEnd, nil)
+	mockRM.EXPECT().GetChassisStatus().Return(&resourcemanager.ChassisStatus{PowerState: resourcemanager.PowerStateOn}, nil)
+	s := newTestSimulator(t, mockRM)
+	c := solConsole(t, s)
+
+	res := c.send(goipmi.NetworkFunctionApp, commandActivatePayload, []byte{payloadTypeSOL, solInstance, 0xc0, 0x00, 0x00, 0x00})
+	require.Equal(t, uint8(goipmi.CommandCompleted), res[0])
+
+	// The connection is lost while the virtual machine keeps running, the payload is deactivated rather than the serial
+	// console taken back
+	require.NoError(t, vmEnd.Close())
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, solDeactivating}, solPacket(t, c))
+
+	res = c.send(goipmi.NetworkFunctionApp, commandGetPayloadActivationStatus, []byte{payloadTypeSOL})
+	assert.Equal(t, []byte{0x00, solInstance, 0x00, 0x00}, res)
+}
+
+func TestSOLConfigParameters(t *testing.T) {
+	h := newSOLHandler(nil, nil, func() int { return 623 })
+
+	testCases := []struct {
+		name     string
+		set      []byte
+		get      []byte
+		expected []byte
+	}{
+		{
+			name:     "revision only",
+			get:      []byte{0x81, solParamEnable, 0x00, 0x00},
+			expected: []byte{0x00, solParamRevision},
+		},
+		{
+			name:     "enabled by default",
+			get:      []byte{0x01, solParamEnable, 0x00, 0x00},
+			expected: []byte{0x00, solParamRevision, 0x01},
+		},
+		{
+			name:     "encryption and authentication forced",
+			get:      []byte{0x0e, solParamAuthentication, 0x00, 0x00},
+			expected: []byte{0x00, solParamRevision, 0xc2},
+		},
+		{
+			name:     "port the remote consoles reach",
+			get:      []byte{0x01, solParamPort, 0x00, 0x00},
+			expected: []byte{0x00, solParamRevision, 0x6f, 0x02},
+		},
+		{
+			name:     "unsupported parameter",
+			get:      []byte{0x01, 0x09, 0x00, 0x00},
+			expected: []byte{uint8(errSOLParamNotSupported)},
+		},
+		{
+			name:     "invalid channel",
+			get:      []byte{0x02, solParamEnable, 0x00, 0x00},
+			expected: []byte{uint8(goipmi.ErrInvalidPacket)},
+		},
+		{
+			name:     "set retry",
+			set:      []byte{0x01, solParamRetry, 0x03, 0x14},
+			get:      []byte{0x01, solParamRetry, 0x00, 0x00},
+			expected: []byte{0x00, solParamRevision, 0x03, 0x14},
+		},
+		{
+			name:     "set privilege level",
+			set:      []byte{0x01, solParamAuthentication, goipmi.PrivLevelOperator},
+			get:      []byte{0x01, solParamAuthentication, 0x00, 0x00},
+			expected: []byte{0x00, solParamRevision, 0xc3},
+		},
+		{
+			name:     "disable",
+			set:      []byte{0x01, solParamEnable, 0x00},
+			get:      []byte{0x01, solParamEnable, 0x00, 0x00},
+			expected: []byte{0x00, solParamRevision, 0x00},
+		},
+		{
+			name:     "read-only port",
+			set:      []byte{0x01, solParamPort, 0x6f, 0x02},
+			expected: []byte{uint8(errSOLParamReadOnly)},
+		},
+		{
+			name:     "invalid privilege level",
+			set:      []byte{0x01, solParamAuthentication, goipmi.PrivLevelCallback},
+			expected: []byte{uint8(goipmi.ErrInvalidPacket)},
+		},
+		{
+			name:     "invalid bit rate",
+			set:      []byte{0x01, solParamBitRate, 0x0b},
+			expected: []byte{uint8(goipmi.ErrInvalidPacket)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.set != nil {
+				res := responseDataToBytes(h.setSOLConfigHandler(&request{ipmiMessage: &ipmiMessage{data: tc.set}}))
+				if tc.get == nil {
+					assert.Equal(t, tc.expected, res)
+					return
+				}
+				require.Equal(t, []byte{0x00}, res)
+			}
+			res := responseDataToBytes(h.getSOLConfigHandler(&request{ipmiMessage: &ipmiMessage{data: tc.get}}))
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestSOLPayloadPort(t *testing.T) {
+	port := 623
+	h := newSOLHandler(nil, nil, func() int { return port })
+	assert.Equal(t, uint16(623), h.payloadPort())
+
+	// A port changing while the BMC runs, e.g., a node port allocated afterwards, is reported right away
+	port = 30623
+	assert.Equal(t, uint16(30623), h.payloadPort())
+}
@@ -0,0 +1,107 @@
+package redfish
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+
+	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
+	"kubevirt.io/kubevirtbmc/pkg/session"
+)
+
+// consolePath is the OEM endpoint of the serial console, upgraded to a WebSocket carrying the raw characters of the
+// console both ways
+const consolePath = "/redfish/v1/Managers/BMC/SerialInterfaces/1/Oem/KubeVirtBMC/Console"
+
+// consoleTokenParameter is the query parameter carrying the session token for the clients unable to set the
+// X-Auth-Token header, e.g., the WebSocket API of the browsers
+const consoleTokenParameter = "token"
+
+// consoleHandler proxies the WebSocket connections to the serial console of the virtual machine
+type consoleHandler struct {
+	rm resourcemanager.ResourceManager
+}
+
+func newConsoleHandler(resourceManager resourcemanager.ResourceManager) *consoleHandler {
+	return &consoleHandler{
+		rm: resourceManager,
+	}
+}
+
+func (h *consoleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("X-Auth-Token")
+	if token == "" {
+		token = r.URL.Query().Get(consoleTokenParameter)
+	}
+	if _, exists := session.GetToken(token); token == "" || !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return
+	}
+
+	// The serial console is held by a single client at a time, e.g., an IPMI Serial Over LAN session
+	release, err := h.rm.AcquireSerialConsole()
+	if err != nil {
+		if errors.Is(err, resourcemanager.ErrSerialConsoleInUse) {
+			http.Error(w, "Serial console in use", http.StatusConflict)
+			return
+		}
+		logrus.Errorf("unable to acquire the serial console: %v", err)
+		http.Error(w, "Serial console unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	console, err := h.rm.SerialConsole()
+	if err != nil {
+		logrus.Errorf("unable to connect to the serial console: %v", err)
+		http.Error(w, "Serial console unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	proxied := false
+	ws := websocket.Server{
+		// The clients are authenticated by their session token rather than by cookies, so any origin is accepted
+		Handshake: func(*websocket.Config, *http.Request) error {
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			proxied = true
+			conn.PayloadType = websocket.BinaryFrame
+			logrus.Infof("serial console connected from %s", r.RemoteAddr)
+			proxy(conn, console)
+			logrus.Infof("serial console disconnected from %s", r.RemoteAddr)
+		},
+	}
+	ws.ServeHTTP(w, r)
+
+	// The handshake failed, e.g., the WebSocket version isn't supported
+	if !proxied {
+		_ = console.Close()
+	}
+}
+
+// proxy copies the characters between the WebSocket and the serial console until either side closes
+func proxy(conn *websocket.Conn, console io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(console, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, console)
+		done <- struct{}{}
+	}()
+	<-done
+
+	_ = console.Close()
+	_ = conn.Close()
+	<-done
+}
@@ -0,0 +1,154 @@
+package redfish
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/net/websocket"
+
+	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
+	"kubevirt.io/kubevirtbmc/pkg/session"
+)
+
+// dialConsole opens a WebSocket to the console endpoint of a test server, passing the token in the X-Auth-Token header
+// or, if query is set, in the query string
+func dialConsole(t *testing.T, ts *httptest.Server, token string, query bool) (*websocket.Conn, error) {
+	location := "ws" + strings.TrimPrefix(ts.URL, "http") + consolePath
+	if query {
+		location += "?" + consoleTokenParameter + "=" + url.QueryEscape(token)
+	}
+	config, err := websocket.NewConfig(location, ts.URL)
+	require.NoError(t, err)
+	if !query {
+		config.Header.Set("X-Auth-Token", token)
+	}
+	return websocket.DialConfig(config)
+}
+
+func TestConsole(t *testing.T) {
+	token := session.AddToken(session.NewTokenInfo("console-session-id", "admin"))
+	defer session.RemoveToken(token)
+
+	testCases := []struct {
+		name  string
+		query bool
+	}{
+		{name: "token in the X-Auth-Token header"},
+		{name: "token in the query string", query: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bmcEnd, vmEnd := net.Pipe()
+			defer vmEnd.Close()
+
+			ctrl := gomock.NewController(t)
+			mockRM := resourcemanager.NewMockResourceManager(ctrl)
+			mockRM.EXPECT().AcquireSerialConsole().Return(func() {}, nil)
+			mockRM.EXPECT().SerialConsole().Return(bmcEnd, nil)
+			ts := httptest.NewServer(newConsoleHandler(mockRM))
+			defer ts.Close()
+
+			conn, err := dialConsole(t, ts, token, tc.query)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			// The characters typed on the WebSocket reach the serial console
+			go func() { _, _ = conn.Write([]byte("root\r")) }()
+			buf := make([]byte, 64)
+			n, err := vmEnd.Read(buf)
+			require.NoError(t, err)
+			assert.Equal(t, "root\r", string(buf[:n]))
+
+			// The output of the serial console reaches the WebSocket
+			go func() { _, _ = vmEnd.Write([]byte("Password: ")) }()
+			n, err = conn.Read(buf)
+			require.NoError(t, err)
+			assert.Equal(t, "Password: ", string(buf[:n]))
+
+			// The serial console is closed along with the WebSocket
+			require.NoError(t, conn.Close())
+			_, err = vmEnd.Read(buf)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestConsoleErrors(t *testing.T) {
+	token := session.AddToken(session.NewTokenInfo("console-errors-session-id", "admin"))
+	defer session.RemoveToken(token)
+
+	testCases := []struct {
+		name           string
+		token          string
+		upgrade        bool
+		mockSetup      func(*resourcemanager.MockResourceManager)
+		expectedStatus int
+	}{
+		{
+			name:           "missing token",
+			upgrade:        true,
+			mockSetup:      func(*resourcemanager.MockResourceManager) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "invalid token",
+			token:          "invalid-token",
+			upgrade:        true,
+			mockSetup:      func(*resourcemanager.MockResourceManager) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:    "serial console unavailable",
+			token:   token,
+			upgrade: true,
+			mockSetup: func(mockRM *resourcemanager.MockResourceManager) {
+				mockRM.EXPECT().AcquireSerialConsole().Return(func() {}, nil)
+				mockRM.EXPECT().SerialConsole().Return(nil, errors.New("vmi not running"))
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:    "serial console in use",
+			token:   token,
+			upgrade: true,
+			mockSetup: func(mockRM *resourcemanager.MockResourceManager) {
+				mockRM.EXPECT().AcquireSerialConsole().Return(nil, resourcemanager.ErrSerialConsoleInUse)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "not a WebSocket upgrade",
+			token:          token,
+			mockSetup:      func(*resourcemanager.MockResourceManager) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockRM := resourcemanager.NewMockResourceManager(ctrl)
+			tc.mockSetup(mockRM)
+
+			req := httptest.NewRequest(http.MethodGet, consolePath, nil)
+			if tc.token != "" {
+				req.Header.Set("X-Auth-Token", tc.token)
+			}
+			if tc.upgrade {
+				req.Header.Set("Upgrade", "websocket")
+			}
+			rec := httptest.NewRecorder()
+			newConsoleHandler(mockRM).ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+		})
+	}
+}
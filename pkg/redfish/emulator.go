@@ -7,16 +7,12 @@ import (
 	"sync"
 
 	"github.com/sirupsen/logrus"
+	"kubevirt.io/kubevirtbmc/pkg/credential"
 	"kubevirt.io/kubevirtbmc/pkg/generated/redfish/server"
 	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
 	"kubevirt.io/kubevirtbmc/pkg/session"
 )
 
-const (
-	defaultUserName = "admin"
-	defaultPassword = "password"
-)
-
 type Emulator struct {
 	ctx    context.Context
 	port   int
@@ -24,10 +20,22 @@ type Emulator struct {
 	server *http.Server
 }
 
-func NewEmulator(ctx context.Context, port int, resourceManager resourcemanager.ResourceManager) *Emulator {
-	apiService := NewAPIService(resourceManager)
-	apiController := server.NewDefaultAPIController(apiService)
+func NewEmulator(
+	ctx context.Context,
+	port int,
+	resourceManager resourcemanager.ResourceManager,
+	credentials credential.Provider,
+) *Emulator {
+	apiService := NewAPIService(resourceManager, credentials)
+	apiController := server.NewDefaultAPIController(apiService, server.WithDefaultAPIErrorHandler(errorHandler))
 	router := server.NewRouter(session.AuthMiddleware, apiController)
+	// The console endpoint authenticates the clients itself, as the browsers can't set the X-Auth-Token header of the
+	// WebSocket requests. It isn't wrapped by the request logger, which would log the token of the query string.
+	router.
+		Methods(http.MethodGet).
+		Path(consolePath).
+		Name("Console").
+		Handler(newConsoleHandler(resourceManager))
 
 	return &Emulator{
 		ctx:  ctx,
@@ -1,22 +1,28 @@
 package redfish
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/google/uuid"
 
+	"kubevirt.io/kubevirtbmc/pkg/credential"
 	"kubevirt.io/kubevirtbmc/pkg/generated/redfish/server"
 	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
 	"kubevirt.io/kubevirtbmc/pkg/session"
+	"kubevirt.io/kubevirtbmc/pkg/util"
 )
 
 type handler struct {
-	rm resourcemanager.ResourceManager
+	rm          resourcemanager.ResourceManager
+	credentials credential.Provider
 }
 
-func NewHandler(resourceManager resourcemanager.ResourceManager) *handler {
+func NewHandler(resourceManager resourcemanager.ResourceManager, credentials credential.Provider) *handler {
 	return &handler{
-		rm: resourceManager,
+		rm:          resourceManager,
+		credentials: credentials,
 	}
 }
 
@@ -26,7 +32,11 @@ func (h *handler) Authenticate(username, password *string) (string, string, erro
 		return id, token, fmt.Errorf("username and password must be provided")
 	}
 
-	if *username != defaultUserName || *password != defaultPassword {
+	ok, err := credential.Verify(h.credentials, *username, *password)
+	if err != nil {
+		return id, token, fmt.Errorf("unable to load credentials: %w", err)
+	}
+	if !ok {
 		return id, token, fmt.Errorf("invalid username or password")
 	}
 
@@ -170,6 +180,47 @@ func (h *handler) GetVirtualMedia() *server.VirtualMediaV163VirtualMedia {
 	}
 }
 
+func (h *handler) GetSerialInterfaceCollection() *server.SerialInterfaceCollectionSerialInterfaceCollection {
+	return &server.SerialInterfaceCollectionSerialInterfaceCollection{
+		OdataContext: "/redfish/v1/$metadata#SerialInterfaceCollection.SerialInterfaceCollection",
+		OdataId:      "/redfish/v1/Managers/BMC/SerialInterfaces",
+		OdataType:    "#SerialInterfaceCollection.SerialInterfaceCollection",
+		Description:  "Serial Interface Collection",
+		Name:         "Serial Interface Collection",
+		Members: []server.OdataV4IdRef{
+			{
+				OdataId: "/redfish/v1/Managers/BMC/SerialInterfaces/1",
+			},
+		},
+		MembersodataCount: 1,
+	}
+}
+
+// GetSerialInterface describes the serial console of the VM, which is reached through IPMI Serial Over LAN or the OEM
+// WebSocket endpoint.
+func (h *handler) GetSerialInterface() *server.SerialInterfaceV120SerialInterface {
+	return &server.SerialInterfaceV120SerialInterface{
+		OdataContext:     "/redfish/v1/$metadata#SerialInterface.SerialInterface",
+		OdataId:          "/redfish/v1/Managers/BMC/SerialInterfaces/1",
+		OdataType:        "#SerialInterface.v1_2_0.SerialInterface",
+		Description:      "Serial console of the virtual machine",
+		Name:             "Serial Console",
+		Id:               "1",
+		InterfaceEnabled: Ptr(true),
+		SignalType:       server.SERIALINTERFACEV120SIGNALTYPE_RS232,
+		BitRate:          server.SERIALINTERFACEV120BITRATE__115200,
+		DataBits:         server.SERIALINTERFACEV120DATABITS__8,
+		Parity:           server.SERIALINTERFACEV120PARITY_NONE,
+		StopBits:         server.SERIALINTERFACEV120STOPBITS__1,
+		FlowControl:      server.SERIALINTERFACEV120FLOWCONTROL_NONE,
+		Oem: map[string]interface{}{
+			"KubeVirtBMC": map[string]interface{}{
+				"ConsoleURI": consolePath,
+			},
+		},
+	}
+}
+
 func (h *handler) GetComputerSystemCollection() *server.ComputerSystemCollectionComputerSystemCollection {
 	return &server.ComputerSystemCollectionComputerSystemCollection{
 		OdataContext: "/redfish/v1/$metadata#ComputerSystemCollection.ComputerSystemCollection",
@@ -197,52 +248,116 @@ func (h *handler) GetComputerSystem() (*server.ComputerSystemV1220ComputerSystem
 	return adapter.GetComputerSystem(), nil
 }
 
+// PatchComputerSystem applies the boot source override of the patch. Disabled drops a pending one-time override, and
+// an override whose BootSourceOverrideEnabled is omitted applies to the next boot only.
 func (h *handler) PatchComputerSystem(computerSystemPatch *server.ComputerSystemV1220ComputerSystem) error {
 	boot := computerSystemPatch.Boot
-	if boot.BootSourceOverrideEnabled != server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_DISABLED {
-		var bootDevice resourcemanager.BootDevice
-
-		switch boot.BootSourceOverrideTarget {
-		case server.COMPUTERSYSTEMBOOTSOURCE_PXE:
-			bootDevice = resourcemanager.BootDevicePxe
-		case server.COMPUTERSYSTEMBOOTSOURCE_HDD:
-			bootDevice = resourcemanager.BootDeviceHdd
-		default:
-			return nil
-		}
+	if boot.BootSourceOverrideEnabled == server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_DISABLED {
+		return h.rm.SetBootDevice(resourcemanager.BootDeviceNone, false, false)
+	}
 
-		if err := h.rm.SetBootDevice(bootDevice); err != nil {
-			return err
-		}
+	var bootDevice resourcemanager.BootDevice
+	switch boot.BootSourceOverrideTarget {
+	case server.COMPUTERSYSTEMBOOTSOURCE_PXE:
+		bootDevice = resourcemanager.BootDevicePxe
+	case server.COMPUTERSYSTEMBOOTSOURCE_HDD:
+		bootDevice = resourcemanager.BootDeviceHdd
+	case server.COMPUTERSYSTEMBOOTSOURCE_CD:
+		bootDevice = resourcemanager.BootDeviceCd
+	case server.COMPUTERSYSTEMBOOTSOURCE_USB, server.COMPUTERSYSTEMBOOTSOURCE_FLOPPY:
+		bootDevice = resourcemanager.BootDeviceUsb
+	case server.COMPUTERSYSTEMBOOTSOURCE_NONE:
+		bootDevice = resourcemanager.BootDeviceNone
+	default:
+		return nil
 	}
-	return nil
+
+	persistent := boot.BootSourceOverrideEnabled == server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_CONTINUOUS
+	efi := boot.BootSourceOverrideMode == server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEMODE_UEFI
+	return h.rm.SetBootDevice(bootDevice, persistent, efi)
 }
 
 func (h *handler) ComputerSystemReset(resetType server.ResourceResetType) error {
 	powerActionMap := map[server.ResourceResetType]func() error{
 		server.RESOURCERESETTYPE_ON:                h.rm.PowerOn,
-		server.RESOURCERESETTYPE_GRACEFUL_SHUTDOWN: h.rm.PowerOff,
-		server.RESOURCERESETTYPE_FORCE_OFF:         h.rm.PowerOff,
-		server.RESOURCERESETTYPE_GRACEFUL_RESTART:  h.rm.PowerCycle,
-		server.RESOURCERESETTYPE_FORCE_RESTART:     h.rm.PowerCycle,
+		server.RESOURCERESETTYPE_GRACEFUL_SHUTDOWN: func() error { return h.rm.PowerOff(false) },
+		server.RESOURCERESETTYPE_FORCE_OFF:         func() error { return h.rm.PowerOff(true) },
+		server.RESOURCERESETTYPE_GRACEFUL_RESTART:  func() error { return h.rm.PowerCycle(false) },
+		server.RESOURCERESETTYPE_FORCE_RESTART:     func() error { return h.rm.PowerCycle(true) },
+		server.RESOURCERESETTYPE_POWER_CYCLE:       func() error { return h.rm.PowerCycle(true) },
+		server.RESOURCERESETTYPE_NMI:               h.rm.NMI,
+		server.RESOURCERESETTYPE_PAUSE:             h.rm.Pause,
+		server.RESOURCERESETTYPE_RESUME:            h.rm.Unpause,
 	}
 
 	powerAction, ok := powerActionMap[resetType]
 	if !ok {
-		return fmt.Errorf("unsupported reset type: %s", resetType)
+		return &requestError{
+			messageID: "Base.1.16.0.ActionParameterValueNotInList",
+			message: fmt.Sprintf("The value '%s' for the parameter ResetType in the action ComputerSystem.Reset is not "+
+				"in the list of acceptable values.", resetType),
+		}
+	}
+	err := powerAction()
+	if errors.Is(err, resourcemanager.ErrNMINotSupported) {
+		return &requestError{
+			messageID: "Base.1.16.0.ActionNotSupported",
+			message:   "The action ComputerSystem.Reset with ResetType Nmi is not supported by the resource.",
+			err:       err,
+		}
+	}
+	return err
+}
+
+// requestError is returned for the requests the client has to change, e.g., asking for an action the virtual machine
+// can't carry out, as opposed to the failures of the BMC
+type requestError struct {
+	messageID string
+	message   string
+	err       error
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// errorHandler answers the requestErrors with 400 Bad Request and the Redfish error they carry, and leaves the other
+// errors to the default handler
+func errorHandler(w http.ResponseWriter, r *http.Request, err error, result *server.ImplResponse) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		_ = server.EncodeJSONResponse(redfishError(reqErr.messageID, reqErr.message), util.Ptr(http.StatusBadRequest), w)
+		return
+	}
+	server.DefaultErrorHandler(w, r, err, result)
+}
+
+func redfishError(messageID, message string) server.RedfishError {
+	return server.RedfishError{
+		Error: server.RedfishErrorError{
+			Code:    messageID,
+			Message: message,
+			MessageExtendedInfo: []server.MessageV120Message{{
+				MessageId: messageID,
+				Message:   message,
+			}},
+		},
 	}
-	return powerAction()
 }
 
 // ComputerSystemSetDefaultBootOrder sets the boot order for the computer system back to default.
 // TODO: Implement real default boot order setting. Right now we intentionally misuse the handler to set the first boot
 // device.
 func (h *handler) ComputerSystemSetDefaultBootOrder(bootDevices []string) error {
-	var bootDevice resourcemanager.BootDevice
+	bootDevice := resourcemanager.BootDeviceNone
 	if len(bootDevices) > 0 {
 		bootDevice = resourcemanager.BootDevice(bootDevices[0])
 	}
-	return h.rm.SetBootDevice(bootDevice)
+	return h.rm.SetBootDevice(bootDevice, true, false)
 }
 
 func Ptr[T any](value T) *T {
@@ -1,11 +1,17 @@
 package redfish
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 
+	"kubevirt.io/kubevirtbmc/pkg/credential"
 	"kubevirt.io/kubevirtbmc/pkg/generated/redfish/server"
 	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
 	"kubevirt.io/kubevirtbmc/pkg/session"
@@ -16,7 +22,7 @@ func TestAuthenticate(t *testing.T) {
 	defer ctl.Finish()
 
 	mockRM := resourcemanager.NewMockResourceManager(ctl)
-	h := NewHandler(mockRM)
+	h := NewHandler(mockRM, credential.NewStaticProvider("admin", "password"))
 
 	testCases := []struct {
 		username    string
@@ -25,7 +31,6 @@ func TestAuthenticate(t *testing.T) {
 	}{
 		{username: "", password: "", expectError: true},
 		{username: "invalid", password: "credentials", expectError: true},
-		// Assuming defaultUserName and defaultPassword are "admin" and "password" respectively
 		{username: "admin", password: "password", expectError: false},
 	}
 
@@ -39,11 +44,38 @@ func TestAuthenticate(t *testing.T) {
 	}
 }
 
+func TestAuthenticateWithCredentialProvider(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	mockRM := resourcemanager.NewMockResourceManager(ctl)
+	h := NewHandler(mockRM, credential.NewStaticProvider("operator", "s3cr3t"))
+
+	testCases := []struct {
+		username    string
+		password    string
+		expectError bool
+	}{
+		{username: "admin", password: "password", expectError: true},
+		{username: "operator", password: "password", expectError: true},
+		{username: "operator", password: "s3cr3t", expectError: false},
+	}
+
+	for _, tc := range testCases {
+		_, _, err := h.Authenticate(&tc.username, &tc.password)
+		if tc.expectError {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
 func TestGetSession(t *testing.T) {
 	ctl := gomock.NewController(t)
 	defer ctl.Finish()
 
-	h := NewHandler(nil)
+	h := NewHandler(nil, nil)
 
 	testCases := []struct {
 		name          string
@@ -93,7 +125,7 @@ func TestDeleteSession(t *testing.T) {
 	ctl := gomock.NewController(t)
 	defer ctl.Finish()
 
-	h := NewHandler(nil)
+	h := NewHandler(nil, nil)
 
 	testCases := []struct {
 		name      string
@@ -133,7 +165,7 @@ func TestPatchComputerSystem(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRM := resourcemanager.NewMockResourceManager(ctrl)
-	handler := NewHandler(mockRM)
+	handler := NewHandler(mockRM, nil)
 
 	testCases := []struct {
 		name        string
@@ -146,6 +178,24 @@ func TestPatchComputerSystem(t *testing.T) {
 			boot: server.ComputerSystemV1220Boot{
 				BootSourceOverrideEnabled: server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_DISABLED,
 			},
+			mockSetup: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceNone, false, false).Return(nil)
+			},
+			expectError: false,
+		},
+		{
+			name: "boot source override target to PXE without override enabled",
+			boot: server.ComputerSystemV1220Boot{
+				BootSourceOverrideTarget: server.COMPUTERSYSTEMBOOTSOURCE_PXE,
+			},
+			mockSetup: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe, false, false).Return(nil)
+			},
+			expectError: false,
+		},
+		{
+			name:        "no boot source override",
+			boot:        server.ComputerSystemV1220Boot{},
 			mockSetup:   func() {},
 			expectError: false,
 		},
@@ -156,7 +206,7 @@ func TestPatchComputerSystem(t *testing.T) {
 				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_PXE,
 			},
 			mockSetup: func() {
-				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe).Return(nil)
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe, false, false).Return(nil)
 			},
 			expectError: false,
 		},
@@ -167,7 +217,7 @@ func TestPatchComputerSystem(t *testing.T) {
 				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_PXE,
 			},
 			mockSetup: func() {
-				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe).Return(nil)
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe, true, false).Return(nil)
 			},
 			expectError: false,
 		},
@@ -178,7 +228,7 @@ func TestPatchComputerSystem(t *testing.T) {
 				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_HDD,
 			},
 			mockSetup: func() {
-				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd).Return(nil)
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd, false, false).Return(nil)
 			},
 			expectError: false,
 		},
@@ -189,7 +239,52 @@ func TestPatchComputerSystem(t *testing.T) {
 				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_HDD,
 			},
 			mockSetup: func() {
-				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd).Return(nil)
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd, true, false).Return(nil)
+			},
+			expectError: false,
+		},
+		{
+			name: "valid boot source override target to HDD in UEFI mode",
+			boot: server.ComputerSystemV1220Boot{
+				BootSourceOverrideEnabled: server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_CONTINUOUS,
+				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_HDD,
+				BootSourceOverrideMode:    server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEMODE_UEFI,
+			},
+			mockSetup: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd, true, true).Return(nil)
+			},
+			expectError: false,
+		},
+		{
+			name: "valid boot source override target to CD (once)",
+			boot: server.ComputerSystemV1220Boot{
+				BootSourceOverrideEnabled: server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_ONCE,
+				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_CD,
+			},
+			mockSetup: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceCd, false, false).Return(nil)
+			},
+			expectError: false,
+		},
+		{
+			name: "valid boot source override target to USB (continuous)",
+			boot: server.ComputerSystemV1220Boot{
+				BootSourceOverrideEnabled: server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_CONTINUOUS,
+				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_USB,
+			},
+			mockSetup: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceUsb, true, false).Return(nil)
+			},
+			expectError: false,
+		},
+		{
+			name: "valid boot source override target to none",
+			boot: server.ComputerSystemV1220Boot{
+				BootSourceOverrideEnabled: server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_CONTINUOUS,
+				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_NONE,
+			},
+			mockSetup: func() {
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceNone, true, false).Return(nil)
 			},
 			expectError: false,
 		},
@@ -218,7 +313,7 @@ func TestPatchComputerSystem(t *testing.T) {
 				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_PXE,
 			},
 			mockSetup: func() {
-				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe).Return(assert.AnError)
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDevicePxe, false, false).Return(assert.AnError)
 			},
 			expectError: true,
 		},
@@ -229,7 +324,7 @@ func TestPatchComputerSystem(t *testing.T) {
 				BootSourceOverrideTarget:  server.COMPUTERSYSTEMBOOTSOURCE_HDD,
 			},
 			mockSetup: func() {
-				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd).Return(assert.AnError)
+				mockRM.EXPECT().SetBootDevice(resourcemanager.BootDeviceHdd, false, false).Return(assert.AnError)
 			},
 			expectError: true,
 		},
@@ -257,13 +352,15 @@ func TestComputerSystemReset(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRM := resourcemanager.NewMockResourceManager(ctrl)
-	handler := NewHandler(mockRM)
+	handler := NewHandler(mockRM, nil)
 
 	testCases := []struct {
 		name          string
 		resetType     server.ResourceResetType
 		mockSetup     func()
 		expectedError bool
+		// expectedMessageID is the Redfish message of the requestError, if the client is to blame
+		expectedMessageID string
 	}{
 		{
 			name:      "power on reset",
@@ -277,7 +374,15 @@ func TestComputerSystemReset(t *testing.T) {
 			name:      "graceful shutdown reset",
 			resetType: server.RESOURCERESETTYPE_GRACEFUL_SHUTDOWN,
 			mockSetup: func() {
-				mockRM.EXPECT().PowerOff().Return(nil)
+				mockRM.EXPECT().PowerOff(false).Return(nil)
+			},
+			expectedError: false,
+		},
+		{
+			name:      "force off reset",
+			resetType: server.RESOURCERESETTYPE_FORCE_OFF,
+			mockSetup: func() {
+				mockRM.EXPECT().PowerOff(true).Return(nil)
 			},
 			expectedError: false,
 		},
@@ -285,7 +390,7 @@ func TestComputerSystemReset(t *testing.T) {
 			name:      "graceful restart reset",
 			resetType: server.RESOURCERESETTYPE_GRACEFUL_RESTART,
 			mockSetup: func() {
-				mockRM.EXPECT().PowerCycle().Return(nil)
+				mockRM.EXPECT().PowerCycle(false).Return(nil)
 			},
 			expectedError: false,
 		},
@@ -293,15 +398,49 @@ func TestComputerSystemReset(t *testing.T) {
 			name:      "force restart reset",
 			resetType: server.RESOURCERESETTYPE_FORCE_RESTART,
 			mockSetup: func() {
-				mockRM.EXPECT().PowerCycle().Return(nil)
+				mockRM.EXPECT().PowerCycle(true).Return(nil)
 			},
 			expectedError: false,
 		},
 		{
-			name:          "unsupported reset type",
-			resetType:     server.ResourceResetType("Unsupported"),
-			mockSetup:     func() {}, // No expectations for unsupported reset types
-			expectedError: true,
+			name:      "power cycle reset",
+			resetType: server.RESOURCERESETTYPE_POWER_CYCLE,
+			mockSetup: func() {
+				mockRM.EXPECT().PowerCycle(true).Return(nil)
+			},
+			expectedError: false,
+		},
+		{
+			name:      "nmi reset",
+			resetType: server.RESOURCERESETTYPE_NMI,
+			mockSetup: func() {
+				mockRM.EXPECT().NMI().Return(resourcemanager.ErrNMINotSupported)
+			},
+			expectedError:     true,
+			expectedMessageID: "Base.1.16.0.ActionNotSupported",
+		},
+		{
+			name:      "pause reset",
+			resetType: server.RESOURCERESETTYPE_PAUSE,
+			mockSetup: func() {
+				mockRM.EXPECT().Pause().Return(nil)
+			},
+			expectedError: false,
+		},
+		{
+			name:      "resume reset",
+			resetType: server.RESOURCERESETTYPE_RESUME,
+			mockSetup: func() {
+				mockRM.EXPECT().Unpause().Return(nil)
+			},
+			expectedError: false,
+		},
+		{
+			name:              "unsupported reset type",
+			resetType:         server.ResourceResetType("Unsupported"),
+			mockSetup:         func() {}, // No expectations for unsupported reset types
+			expectedError:     true,
+			expectedMessageID: "Base.1.16.0.ActionParameterValueNotInList",
 		},
 	}
 
@@ -314,6 +453,46 @@ func TestComputerSystemReset(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 			}
+			var reqErr *requestError
+			if tc.expectedMessageID != "" && assert.ErrorAs(t, err, &reqErr) {
+				assert.Equal(t, tc.expectedMessageID, reqErr.messageID)
+			}
 		})
 	}
 }
+
+func TestErrorHandler(t *testing.T) {
+	t.Run("request error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		err := &requestError{messageID: "Base.1.16.0.ActionNotSupported", message: "not supported"}
+		errorHandler(w, nil, fmt.Errorf("wrapped: %w", err), &server.ImplResponse{Code: http.StatusInternalServerError})
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var body server.RedfishError
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, "Base.1.16.0.ActionNotSupported", body.Error.Code)
+		assert.Equal(t, "not supported", body.Error.MessageExtendedInfo[0].Message)
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		errorHandler(w, nil, errors.New("failed"), &server.ImplResponse{Code: http.StatusInternalServerError})
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestGetSerialInterface(t *testing.T) {
+	h := NewHandler(nil, nil)
+
+	collection := h.GetSerialInterfaceCollection()
+	assert.Equal(t, []server.OdataV4IdRef{{OdataId: "/redfish/v1/Managers/BMC/SerialInterfaces/1"}}, collection.Members)
+	assert.Equal(t, int64(1), collection.MembersodataCount)
+
+	serialInterface := h.GetSerialInterface()
+	assert.Equal(t, collection.Members[0].OdataId, serialInterface.OdataId)
+	assert.Equal(t, "1", serialInterface.Id)
+	assert.True(t, *serialInterface.InterfaceEnabled)
+	assert.Equal(t, server.SERIALINTERFACEV120BITRATE__115200, serialInterface.BitRate)
+	assert.Equal(t, map[string]interface{}{"ConsoleURI": consolePath}, serialInterface.Oem["KubeVirtBMC"])
+}
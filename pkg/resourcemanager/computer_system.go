@@ -13,7 +13,7 @@ type ComputerSystemInterface interface {
 	GetComputerSystem() *server.ComputerSystemV1220ComputerSystem
 	GetPowerState() server.ResourcePowerState
 	SetPowerState(powerState server.ResourcePowerState)
-	SetBootOverride(server.ComputerSystemBootSource)
+	SetBootOptions(*BootOptions)
 }
 
 type ComputerSystemAdapter struct {
@@ -52,9 +52,23 @@ func (a *ComputerSystemAdapter) SetPowerState(powerState server.ResourcePowerSta
 	a.computerSystem.PowerState = powerState
 }
 
-func (a *ComputerSystemAdapter) SetBootOverride(target server.ComputerSystemBootSource) {
-	a.computerSystem.Boot.BootSourceOverrideEnabled = server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_CONTINUOUS
-	a.computerSystem.Boot.BootSourceOverrideTarget = target
+func (a *ComputerSystemAdapter) SetBootOptions(options *BootOptions) {
+	boot := &a.computerSystem.Boot
+	switch {
+	case options.Device == "":
+		boot.BootSourceOverrideEnabled = server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_DISABLED
+	case options.Persistent:
+		boot.BootSourceOverrideEnabled = server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_CONTINUOUS
+	default:
+		boot.BootSourceOverrideEnabled = server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEENABLED_ONCE
+	}
+	if target, ok := bootSourceMap[options.Device]; ok {
+		boot.BootSourceOverrideTarget = target
+	}
+	boot.BootSourceOverrideMode = server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEMODE_LEGACY
+	if options.EFI {
+		boot.BootSourceOverrideMode = server.COMPUTERSYSTEMV1220BOOTSOURCEOVERRIDEMODE_UEFI
+	}
 }
 
 func NewComputerSystem(id, name string, powerState server.ResourcePowerState) *ComputerSystemAdapter {
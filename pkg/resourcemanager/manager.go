@@ -36,6 +36,17 @@ func (a *ManagerAdapter) Manage(resource ODataInterface) error {
 	return nil
 }
 
+// EnableGraphicalConsole advertises the VNC console of the VM, which the agent serves on a port of its own
+func (a *ManagerAdapter) EnableGraphicalConsole() {
+	a.manager.GraphicalConsole = server.ManagerV1190GraphicalConsole{
+		ServiceEnabled:        true,
+		MaxConcurrentSessions: 1,
+		ConnectTypesSupported: []server.ManagerV1190GraphicalConnectTypesSupported{
+			server.MANAGERV1190GRAPHICALCONNECTTYPESSUPPORTED_KVMIP,
+		},
+	}
+}
+
 func (a *ManagerAdapter) ManagedBy(resource ODataInterface) error {
 	panic("implement me")
 }
@@ -64,6 +75,16 @@ func NewManager(id, name string) *ManagerAdapter {
 		SerialInterfaces: server.OdataV4IdRef{
 			OdataId: "/redfish/v1/Managers/BMC/SerialInterfaces",
 		},
+		// The serial console of the VM is reached through IPMI Serial Over LAN and the OEM WebSocket endpoint of the
+		// serial interface, one session at a time
+		SerialConsole: server.ManagerV1190SerialConsole{
+			ServiceEnabled:        true,
+			MaxConcurrentSessions: 1,
+			ConnectTypesSupported: []server.ManagerV1190SerialConnectTypesSupported{
+				server.MANAGERV1190SERIALCONNECTTYPESSUPPORTED_IPMI,
+				server.MANAGERV1190SERIALCONNECTTYPESSUPPORTED_OEM,
+			},
+		},
 		VirtualMedia: server.OdataV4IdRef{
 			OdataId: "/redfish/v1/Managers/BMC/VirtualMedia",
 		},
@@ -10,6 +10,7 @@
 package resourcemanager
 
 import (
+	io "io"
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
@@ -39,6 +40,51 @@ func (m *MockResourceManager) EXPECT() *MockResourceManagerMockRecorder {
 	return m.recorder
 }
 
+// AcquireSerialConsole mocks base method.
+func (m *MockResourceManager) AcquireSerialConsole() (func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcquireSerialConsole")
+	ret0, _ := ret[0].(func())
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireSerialConsole indicates an expected call of AcquireSerialConsole.
+func (mr *MockResourceManagerMockRecorder) AcquireSerialConsole() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcquireSerialConsole", reflect.TypeOf((*MockResourceManager)(nil).AcquireSerialConsole))
+}
+
+// GetBootOptions mocks base method.
+func (m *MockResourceManager) GetBootOptions() (*BootOptions, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBootOptions")
+	ret0, _ := ret[0].(*BootOptions)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBootOptions indicates an expected call of GetBootOptions.
+func (mr *MockResourceManagerMockRecorder) GetBootOptions() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBootOptions", reflect.TypeOf((*MockResourceManager)(nil).GetBootOptions))
+}
+
+// GetChassisStatus mocks base method.
+func (m *MockResourceManager) GetChassisStatus() (*ChassisStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChassisStatus")
+	ret0, _ := ret[0].(*ChassisStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChassisStatus indicates an expected call of GetChassisStatus.
+func (mr *MockResourceManagerMockRecorder) GetChassisStatus() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChassisStatus", reflect.TypeOf((*MockResourceManager)(nil).GetChassisStatus))
+}
+
 // GetComputerSystem mocks base method.
 func (m *MockResourceManager) GetComputerSystem() (ComputerSystemInterface, error) {
 	m.ctrl.T.Helper()
@@ -84,32 +130,75 @@ func (mr *MockResourceManagerMockRecorder) GetPowerStatus() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPowerStatus", reflect.TypeOf((*MockResourceManager)(nil).GetPowerStatus))
 }
 
+// GetSystemUUID mocks base method.
+func (m *MockResourceManager) GetSystemUUID() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSystemUUID")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSystemUUID indicates an expected call of GetSystemUUID.
+func (mr *MockResourceManagerMockRecorder) GetSystemUUID() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSystemUUID", reflect.TypeOf((*MockResourceManager)(nil).GetSystemUUID))
+}
+
+// NMI mocks base method.
+func (m *MockResourceManager) NMI() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NMI")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NMI indicates an expected call of NMI.
+func (mr *MockResourceManagerMockRecorder) NMI() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NMI", reflect.TypeOf((*MockResourceManager)(nil).NMI))
+}
+
+// Pause mocks base method.
+func (m *MockResourceManager) Pause() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pause")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockResourceManagerMockRecorder) Pause() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockResourceManager)(nil).Pause))
+}
+
 // PowerCycle mocks base method.
-func (m *MockResourceManager) PowerCycle() error {
+func (m *MockResourceManager) PowerCycle(force bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PowerCycle")
+	ret := m.ctrl.Call(m, "PowerCycle", force)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // PowerCycle indicates an expected call of PowerCycle.
-func (mr *MockResourceManagerMockRecorder) PowerCycle() *gomock.Call {
+func (mr *MockResourceManagerMockRecorder) PowerCycle(force any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PowerCycle", reflect.TypeOf((*MockResourceManager)(nil).PowerCycle))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PowerCycle", reflect.TypeOf((*MockResourceManager)(nil).PowerCycle), force)
 }
 
 // PowerOff mocks base method.
-func (m *MockResourceManager) PowerOff() error {
+func (m *MockResourceManager) PowerOff(force bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PowerOff")
+	ret := m.ctrl.Call(m, "PowerOff", force)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // PowerOff indicates an expected call of PowerOff.
-func (mr *MockResourceManagerMockRecorder) PowerOff() *gomock.Call {
+func (mr *MockResourceManagerMockRecorder) PowerOff(force any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PowerOff", reflect.TypeOf((*MockResourceManager)(nil).PowerOff))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PowerOff", reflect.TypeOf((*MockResourceManager)(nil).PowerOff), force)
 }
 
 // PowerOn mocks base method.
@@ -126,16 +215,60 @@ func (mr *MockResourceManagerMockRecorder) PowerOn() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PowerOn", reflect.TypeOf((*MockResourceManager)(nil).PowerOn))
 }
 
+// SerialConsole mocks base method.
+func (m *MockResourceManager) SerialConsole() (io.ReadWriteCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SerialConsole")
+	ret0, _ := ret[0].(io.ReadWriteCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SerialConsole indicates an expected call of SerialConsole.
+func (mr *MockResourceManagerMockRecorder) SerialConsole() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SerialConsole", reflect.TypeOf((*MockResourceManager)(nil).SerialConsole))
+}
+
 // SetBootDevice mocks base method.
-func (m *MockResourceManager) SetBootDevice(arg0 BootDevice) error {
+func (m *MockResourceManager) SetBootDevice(device BootDevice, persistent, efi bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetBootDevice", arg0)
+	ret := m.ctrl.Call(m, "SetBootDevice", device, persistent, efi)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SetBootDevice indicates an expected call of SetBootDevice.
-func (mr *MockResourceManagerMockRecorder) SetBootDevice(arg0 any) *gomock.Call {
+func (mr *MockResourceManagerMockRecorder) SetBootDevice(device, persistent, efi any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBootDevice", reflect.TypeOf((*MockResourceManager)(nil).SetBootDevice), device, persistent, efi)
+}
+
+// Unpause mocks base method.
+func (m *MockResourceManager) Unpause() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unpause")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unpause indicates an expected call of Unpause.
+func (mr *MockResourceManagerMockRecorder) Unpause() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unpause", reflect.TypeOf((*MockResourceManager)(nil).Unpause))
+}
+
+// VNC mocks base method.
+func (m *MockResourceManager) VNC() (io.ReadWriteCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VNC")
+	ret0, _ := ret[0].(io.ReadWriteCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VNC indicates an expected call of VNC.
+func (mr *MockResourceManagerMockRecorder) VNC() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBootDevice", reflect.TypeOf((*MockResourceManager)(nil).SetBootDevice), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VNC", reflect.TypeOf((*MockResourceManager)(nil).VNC))
 }
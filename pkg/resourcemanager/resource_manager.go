@@ -1,19 +1,114 @@
 package resourcemanager
 
+import (
+	"errors"
+	"io"
+	"time"
+)
+
 type BootDevice string
 
 const (
-	BootDevicePxe BootDevice = "Pxe"
-	BootDeviceHdd BootDevice = "Hdd"
+	// BootDeviceNone asks for no boot override, i.e., for the boot order of the virtual machine
+	BootDeviceNone BootDevice = "None"
+	BootDevicePxe  BootDevice = "Pxe"
+	BootDeviceHdd  BootDevice = "Hdd"
+	BootDeviceCd   BootDevice = "Cd"
+	// BootDeviceUsb is a removable disk, i.e., a disk on the USB bus
+	BootDeviceUsb BootDevice = "Usb"
+)
+
+var (
+	// ErrUnsupportedBootDevice is returned when asked to boot from a kind of device virtual machines don't have
+	ErrUnsupportedBootDevice = errors.New("unsupported boot device")
+	// ErrBootDeviceNotFound is returned when asked to boot from a kind of device the virtual machine lacks
+	ErrBootDeviceNotFound = errors.New("boot device not found")
+	// ErrNMINotSupported is returned when asked for a non-maskable interrupt the virtual machine can't be sent
+	ErrNMINotSupported = errors.New("NMI not supported")
+	// ErrSerialConsoleInUse is returned when asked for the serial console while another client of the BMC holds it
+	ErrSerialConsoleInUse = errors.New("serial console in use")
+)
+
+// BootOptions describes how the virtual machine boots
+type BootOptions struct {
+	// Device is the kind of the device with the lowest boot order, or empty if no device has a boot order
+	Device BootDevice
+	// Persistent tells whether the device applies to every boot rather than to the next one only
+	Persistent bool
+	// EFI tells whether the virtual machine boots with UEFI rather than the legacy BIOS
+	EFI bool
+}
+
+// PowerState is the power state of the virtual machine, including the transitions between on and off
+type PowerState string
+
+const (
+	PowerStateOn          PowerState = "On"
+	PowerStateOff         PowerState = "Off"
+	PowerStatePoweringOn  PowerState = "PoweringOn"
+	PowerStatePoweringOff PowerState = "PoweringOff"
+	// PowerStatePaused is a running virtual machine whose guest is frozen
+	PowerStatePaused PowerState = "Paused"
+)
+
+// PowerRestorePolicy tells whether the virtual machine is started again once it stopped on its own, e.g., crashed
+type PowerRestorePolicy string
+
+const (
+	PowerRestorePolicyAlwaysOn  PowerRestorePolicy = "AlwaysOn"
+	PowerRestorePolicyAlwaysOff PowerRestorePolicy = "AlwaysOff"
+	// PowerRestorePolicyLastState restarts the virtual machine unless it was stopped on purpose
+	PowerRestorePolicyLastState PowerRestorePolicy = "LastState"
+	PowerRestorePolicyUnknown   PowerRestorePolicy = "Unknown"
 )
 
+// PowerAction is a power action requested through the BMC
+type PowerAction string
+
+const (
+	PowerActionOn     PowerAction = "On"
+	PowerActionOff    PowerAction = "Off"
+	PowerActionCycle  PowerAction = "Cycle"
+	PowerActionPause  PowerAction = "Pause"
+	PowerActionResume PowerAction = "Resume"
+)
+
+// PowerEvent records a power action requested through the BMC
+type PowerEvent struct {
+	Action PowerAction
+	Time   time.Time
+}
+
+// ChassisStatus describes the power and the health of the virtual machine
+type ChassisStatus struct {
+	PowerState    PowerState
+	RestorePolicy PowerRestorePolicy
+	// LastPowerEvent is the last power action requested through the BMC, if any
+	LastPowerEvent *PowerEvent
+	// PowerFault tells whether the virtual machine instance failed
+	PowerFault bool
+	// DriveFault tells whether the volumes of the virtual machine are missing or failed to be provisioned
+	DriveFault bool
+}
+
 type ResourceManager interface {
 	GetComputerSystem() (ComputerSystemInterface, error)
 	GetManager() (ManagerInterface, error)
 
 	GetPowerStatus() (bool, error)
+	GetChassisStatus() (*ChassisStatus, error)
 	PowerOn() error
-	PowerOff() error
-	PowerCycle() error
-	SetBootDevice(BootDevice) error
+	PowerOff(force bool) error
+	PowerCycle(force bool) error
+	NMI() error
+	Pause() error
+	Unpause() error
+	SetBootDevice(device BootDevice, persistent, efi bool) error
+	GetBootOptions() (*BootOptions, error)
+	GetSystemUUID() (string, error)
+	// AcquireSerialConsole reserves the serial console for a single client of the BMC at a time, e.g., an IPMI Serial
+	// Over LAN session or a WebSocket, returning a function releasing it
+	AcquireSerialConsole() (func(), error)
+	SerialConsole() (io.ReadWriteCloser, error)
+	VNC() (io.ReadWriteCloser, error)
 }
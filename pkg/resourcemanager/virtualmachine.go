@@ -2,21 +2,36 @@ package resourcemanager
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 
 	kubevirttypev1 "kubevirt.io/kubevirtbmc/pkg/generated/clientset/versioned/typed/core/v1"
 	"kubevirt.io/kubevirtbmc/pkg/generated/redfish/server"
+	"kubevirt.io/kubevirtbmc/pkg/util"
 )
 
 const (
 	defaultManagerId        = "BMC"
 	defaultManagerName      = "Manager"
 	defaultComputerSystemId = "1"
+
+	// BootOnceAnnotation holds the boot order and bootloader replaced by a one-time boot override, to be restored once
+	// the virtual machine has booted
+	BootOnceAnnotation = "kubevirt.io/virtualmachinebmc-boot-once"
+
+	bootOnceCheckInterval = 10 * time.Second
 )
 
 var (
@@ -27,12 +42,32 @@ var (
 	bootSourceMap = map[BootDevice]server.ComputerSystemBootSource{
 		BootDevicePxe: server.COMPUTERSYSTEMBOOTSOURCE_PXE,
 		BootDeviceHdd: server.COMPUTERSYSTEMBOOTSOURCE_HDD,
+		BootDeviceCd:  server.COMPUTERSYSTEMBOOTSOURCE_CD,
+		BootDeviceUsb: server.COMPUTERSYSTEMBOOTSOURCE_USB,
 	}
 )
 
+// bootOnce is the content of the BootOnceAnnotation
+type bootOnce struct {
+	// VMIUID is the UID of the VMI running when the override was set, if any
+	VMIUID types.UID `json:"vmiUID,omitempty"`
+	// Disks and Interfaces map the device names to their boot order before the override
+	Disks      map[string]*uint `json:"disks,omitempty"`
+	Interfaces map[string]*uint `json:"interfaces,omitempty"`
+	// BootloaderReplaced tells whether the override switched the virtual machine to UEFI, replacing Bootloader
+	BootloaderReplaced bool                   `json:"bootloaderReplaced,omitempty"`
+	Bootloader         *kubevirtv1.Bootloader `json:"bootloader,omitempty"`
+}
+
 type KubeVirtClientInterface interface {
 	VirtualMachines(namespace string) kubevirttypev1.VirtualMachineInterface
 	VirtualMachineInstances(namespace string) kubevirttypev1.VirtualMachineInstanceInterface
+	SerialConsole(namespace, name string) (io.ReadWriteCloser, error)
+	VNC(namespace, name string) (io.ReadWriteCloser, error)
+	Stop(ctx context.Context, namespace, name string, options *kubevirtv1.StopOptions) error
+	Restart(ctx context.Context, namespace, name string, options *kubevirtv1.RestartOptions) error
+	Pause(ctx context.Context, namespace, name string, options *kubevirtv1.PauseOptions) error
+	Unpause(ctx context.Context, namespace, name string, options *kubevirtv1.UnpauseOptions) error
 }
 
 type VirtualMachineResourceManager struct {
@@ -44,6 +79,12 @@ type VirtualMachineResourceManager struct {
 
 	computerSystem *ComputerSystemAdapter
 	manager        *ManagerAdapter
+
+	// lastPowerEvent is the last power action requested through the BMC, if any
+	mu             sync.Mutex
+	lastPowerEvent *PowerEvent
+	// serialConsoleHeld tells whether a client of the BMC holds the serial console
+	serialConsoleHeld bool
 }
 
 func NewVirtualMachineResourceManager(
@@ -102,12 +143,17 @@ func (m *VirtualMachineResourceManager) GetComputerSystem() (ComputerSystemInter
 		return nil, err
 	}
 
-	switch vm.Status.Ready {
-	case true:
+	switch {
+	case vm.Status.PrintableStatus == kubevirtv1.VirtualMachineStatusPaused:
+		m.computerSystem.SetPowerState(server.RESOURCEPOWERSTATE_PAUSED)
+	case vm.Status.Ready:
 		m.computerSystem.SetPowerState(server.RESOURCEPOWERSTATE_ON)
-	case false:
+	default:
 		m.computerSystem.SetPowerState(server.RESOURCEPOWERSTATE_OFF)
 	}
+	if vm.Spec.Template != nil {
+		m.computerSystem.SetBootOptions(bootOptions(vm))
+	}
 
 	return m.computerSystem, nil
 }
@@ -116,6 +162,11 @@ func (m *VirtualMachineResourceManager) GetManager() (ManagerInterface, error) {
 	return m.manager, nil
 }
 
+// EnableGraphicalConsole advertises the VNC console in the manager, once initialized
+func (m *VirtualMachineResourceManager) EnableGraphicalConsole() {
+	m.manager.EnableGraphicalConsole()
+}
+
 func (m *VirtualMachineResourceManager) GetPowerStatus() (bool, error) {
 	// TODO: Implement a control loop to keep the power state in sync, then we will be able to
 	// return the power state from the intermediate object, i.e. ComputerSystem.
@@ -159,10 +210,32 @@ func (m *VirtualMachineResourceManager) PowerOn() error {
 		Update(m.ctx, vm, metav1.UpdateOptions{}); err != nil {
 		return err
 	}
+	m.recordPowerEvent(PowerActionOn)
 	return nil
 }
 
-func (m *VirtualMachineResourceManager) PowerOff() error {
+// PowerOff stops the virtual machine. The guest is given the termination grace period of the virtual machine instance
+// to shut down through ACPI, unless forced, in which case it is stopped right away.
+func (m *VirtualMachineResourceManager) PowerOff(force bool) error {
+	if force {
+		_, err := m.kvClient.VirtualMachineInstances(m.namespace).
+			Get(m.ctx, m.name, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			// The stop subresource also halts the virtual machine, whatever its run strategy
+			if err := m.kvClient.Stop(m.ctx, m.namespace, m.name, &kubevirtv1.StopOptions{
+				GracePeriod: util.Ptr[int64](0),
+			}); err != nil {
+				return err
+			}
+			m.recordPowerEvent(PowerActionOff)
+			return nil
+		case !apierrors.IsNotFound(err):
+			return err
+		}
+		// There is nothing to stop, halting the virtual machine is enough
+	}
+
 	vm, err := m.kvClient.VirtualMachines(m.namespace).
 		Get(m.ctx, m.name, metav1.GetOptions{})
 	if err != nil {
@@ -181,16 +254,157 @@ func (m *VirtualMachineResourceManager) PowerOff() error {
 		Update(m.ctx, vm, metav1.UpdateOptions{}); err != nil {
 		return err
 	}
+	m.recordPowerEvent(PowerActionOff)
+	return nil
+}
+
+// PowerCycle restarts the virtual machine. The guest is given the termination grace period of the virtual machine
+// instance to shut down through ACPI, unless forced, in which case it is stopped right away. A stopped virtual machine
+// is powered on.
+func (m *VirtualMachineResourceManager) PowerCycle(force bool) error {
+	_, err := m.kvClient.VirtualMachineInstances(m.namespace).
+		Get(m.ctx, m.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return m.PowerOn()
+	}
+	if err != nil {
+		return err
+	}
+
+	options := &kubevirtv1.RestartOptions{}
+	if force {
+		options.GracePeriodSeconds = util.Ptr[int64](0)
+	}
+	if err := m.kvClient.Restart(m.ctx, m.namespace, m.name, options); err != nil {
+		return err
+	}
+	m.recordPowerEvent(PowerActionCycle)
+	return nil
+}
+
+// NMI sends a non-maskable interrupt to the guest, e.g., to have a hung Linux guest dump its kernel through kdump.
+// KubeVirt offers no subresource to inject an NMI into a virtual machine instance, hence ErrNMINotSupported.
+func (m *VirtualMachineResourceManager) NMI() error {
+	return ErrNMINotSupported
+}
+
+// Pause freezes the guest of the running virtual machine instance
+func (m *VirtualMachineResourceManager) Pause() error {
+	if err := m.kvClient.Pause(m.ctx, m.namespace, m.name, &kubevirtv1.PauseOptions{}); err != nil {
+		return err
+	}
+	m.recordPowerEvent(PowerActionPause)
 	return nil
 }
 
-func (m *VirtualMachineResourceManager) PowerCycle() error {
-	return m.kvClient.VirtualMachineInstances(m.namespace).
-		Delete(m.ctx, m.name, metav1.DeleteOptions{})
+// Unpause resumes the guest of the paused virtual machine instance
+func (m *VirtualMachineResourceManager) Unpause() error {
+	if err := m.kvClient.Unpause(m.ctx, m.namespace, m.name, &kubevirtv1.UnpauseOptions{}); err != nil {
+		return err
+	}
+	m.recordPowerEvent(PowerActionResume)
+	return nil
+}
+
+// recordPowerEvent records a power action requested through the BMC as the last one
+func (m *VirtualMachineResourceManager) recordPowerEvent(action PowerAction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastPowerEvent = &PowerEvent{Action: action, Time: time.Now()}
+}
+
+// GetChassisStatus returns the power state of the virtual machine derived from the phase of its virtual machine
+// instance, the restore policy derived from its run strategy and the last power action requested through the BMC
+func (m *VirtualMachineResourceManager) GetChassisStatus() (*ChassisStatus, error) {
+	vm, err := m.kvClient.VirtualMachines(m.namespace).
+		Get(m.ctx, m.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	vmi, err := m.kvClient.VirtualMachineInstances(m.namespace).
+		Get(m.ctx, m.name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		vmi = nil
+	case err != nil:
+		return nil, err
+	}
+
+	status := &ChassisStatus{
+		PowerState:    powerState(vm, vmi),
+		RestorePolicy: restorePolicy(vm),
+		PowerFault:    vmi != nil && vmi.Status.Phase == kubevirtv1.Failed,
+		DriveFault: vm.Status.PrintableStatus == kubevirtv1.VirtualMachineStatusDataVolumeError ||
+			vm.Status.PrintableStatus == kubevirtv1.VirtualMachineStatusPvcNotFound,
+	}
+
+	m.mu.Lock()
+	status.LastPowerEvent = m.lastPowerEvent
+	m.mu.Unlock()
+
+	return status, nil
+}
+
+// powerState returns the power state of a virtual machine given its virtual machine instance, if any
+func powerState(vm *kubevirtv1.VirtualMachine, vmi *kubevirtv1.VirtualMachineInstance) PowerState {
+	if vmi == nil {
+		// The virtual machine instance is yet to be created, e.g., while the volumes are provisioned
+		switch vm.Status.PrintableStatus {
+		case kubevirtv1.VirtualMachineStatusProvisioning,
+			kubevirtv1.VirtualMachineStatusStarting,
+			kubevirtv1.VirtualMachineStatusWaitingForVolumeBinding:
+			return PowerStatePoweringOn
+		default:
+			return PowerStateOff
+		}
+	}
+
+	switch vmi.Status.Phase {
+	case kubevirtv1.Pending, kubevirtv1.Scheduling, kubevirtv1.Scheduled:
+		return PowerStatePoweringOn
+	case kubevirtv1.Running:
+		if vmi.DeletionTimestamp != nil || vm.Status.PrintableStatus == kubevirtv1.VirtualMachineStatusStopping {
+			return PowerStatePoweringOff
+		}
+		for _, condition := range vmi.Status.Conditions {
+			if condition.Type == kubevirtv1.VirtualMachineInstancePaused && condition.Status == corev1.ConditionTrue {
+				return PowerStatePaused
+			}
+		}
+		return PowerStateOn
+	default:
+		// The virtual machine instance is done, or its node is lost
+		return PowerStateOff
+	}
 }
 
-func (m *VirtualMachineResourceManager) SetBootDevice(bootDevice BootDevice) error {
-	logrus.Info("SetBootDevice")
+// restorePolicy returns the restore policy matching the run strategy of a virtual machine
+func restorePolicy(vm *kubevirtv1.VirtualMachine) PowerRestorePolicy {
+	runStrategy, err := vm.RunStrategy()
+	if err != nil {
+		return PowerRestorePolicyUnknown
+	}
+
+	switch runStrategy {
+	case kubevirtv1.RunStrategyAlways:
+		return PowerRestorePolicyAlwaysOn
+	case kubevirtv1.RunStrategyRerunOnFailure:
+		// The virtual machine instance is restarted on failure only, i.e., unless the guest shut down
+		return PowerRestorePolicyLastState
+	case kubevirtv1.RunStrategyHalted, kubevirtv1.RunStrategyManual, kubevirtv1.RunStrategyOnce:
+		return PowerRestorePolicyAlwaysOff
+	default:
+		return PowerRestorePolicyUnknown
+	}
+}
+
+// SetBootDevice makes the virtual machine boot from the given device, either persistently or on the next start only,
+// in which case the previous boot order is restored by RevertBootOnce. BootDeviceNone drops a pending one-time
+// override. The virtual machine is switched to UEFI when efi is set, for the next start only unless persistent, even
+// along with BootDeviceNone.
+func (m *VirtualMachineResourceManager) SetBootDevice(bootDevice BootDevice, persistent, efi bool) error {
+	logrus.Infof("SetBootDevice: %s", bootDevice)
 	vm, err := m.kvClient.VirtualMachines(m.namespace).
 		Get(m.ctx, m.name, metav1.GetOptions{})
 	if err != nil {
@@ -200,30 +414,62 @@ func (m *VirtualMachineResourceManager) SetBootDevice(bootDevice BootDevice) err
 	if vm.Spec.Template == nil {
 		return fmt.Errorf("no template found")
 	}
+	domain := &vm.Spec.Template.Spec.Domain
+	devices := &domain.Devices
+
+	// Neither the boot order nor the bootloader of a one-time override outlives a persistent override
+	if bootDevice == BootDeviceNone || persistent {
+		if value, ok := vm.Annotations[BootOnceAnnotation]; ok {
+			restoreBootOrder(domain, value)
+			delete(vm.Annotations, BootOnceAnnotation)
+		}
+	}
 
-	for i, intf := range vm.Spec.Template.Spec.Domain.Devices.Interfaces {
-		logrus.Infof("interface: %+v", intf)
-		vm.Spec.Template.Spec.Domain.Devices.Interfaces[i].BootOrder = nil
+	// Find the device before touching the boot order, so that a failure leaves the virtual machine untouched
+	disk, intf := -1, -1
+	if bootDevice != BootDeviceNone {
+		disk, intf, err = bootDeviceIndex(devices, bootDevice)
+		if err != nil {
+			return err
+		}
 	}
-	for i, dev := range vm.Spec.Template.Spec.Domain.Devices.Disks {
-		logrus.Infof("disk: %+v", dev)
-		vm.Spec.Template.Spec.Domain.Devices.Disks[i].BootOrder = nil
+
+	// Only the first of successive one-time overrides saves the boot order to restore. A one-time switch to UEFI
+	// without a boot device saves it as well, so that RevertBootOnce restores the bootloader.
+	if _, ok := vm.Annotations[BootOnceAnnotation]; !ok && !persistent && (bootDevice != BootDeviceNone || efi) {
+		if err := m.saveBootOrder(vm); err != nil {
+			return err
+		}
 	}
 
-	var firstOrder uint = 1
-	switch bootDevice {
-	case BootDevicePxe:
-		if vm.Spec.Template.Spec.Domain.Devices.Interfaces == nil {
-			return fmt.Errorf("no interfaces found")
+	if bootDevice != BootDeviceNone {
+		for i := range devices.Interfaces {
+			devices.Interfaces[i].BootOrder = nil
+		}
+		for i := range devices.Disks {
+			devices.Disks[i].BootOrder = nil
+		}
+
+		var firstOrder uint = 1
+		if disk >= 0 {
+			devices.Disks[disk].BootOrder = &firstOrder
+			logrus.Debugf("Booting from disk %s", devices.Disks[disk].Name)
+		} else {
+			devices.Interfaces[intf].BootOrder = &firstOrder
+			logrus.Debugf("Booting from interface %s", devices.Interfaces[intf].Name)
+		}
+	}
+
+	if efi {
+		var bootloader *kubevirtv1.Bootloader
+		if domain.Firmware != nil {
+			bootloader = domain.Firmware.Bootloader
 		}
-		vm.Spec.Template.Spec.Domain.Devices.Interfaces[0].BootOrder = &firstOrder
-		logrus.Infof("To be updated vm: %+v", vm.Spec.Template.Spec.Domain.Devices.Interfaces[0])
-	case BootDeviceHdd:
-		if vm.Spec.Template.Spec.Domain.Devices.Disks == nil {
-			return fmt.Errorf("no disks found")
+		if setEFIBootloader(vm) {
+			if err := saveBootloader(vm, bootloader); err != nil {
+				return err
+			}
 		}
-		vm.Spec.Template.Spec.Domain.Devices.Disks[0].BootOrder = &firstOrder
-		logrus.Infof("To be updated vm: %+v", vm.Spec.Template.Spec.Domain.Devices.Disks[0])
 	}
 
 	if _, err := m.kvClient.VirtualMachines(m.namespace).
@@ -232,11 +478,300 @@ func (m *VirtualMachineResourceManager) SetBootDevice(bootDevice BootDevice) err
 		return err
 	}
 
-	if m.computerSystem == nil {
-		logrus.Warn("computer system not initialized")
+	return nil
+}
+
+// bootDeviceIndex returns the index of either the disk or the interface to boot from for the given device, the other
+// index being -1
+func bootDeviceIndex(devices *kubevirtv1.Devices, bootDevice BootDevice) (int, int, error) {
+	switch bootDevice {
+	case BootDevicePxe:
+		if len(devices.Interfaces) == 0 {
+			return -1, -1, fmt.Errorf("%w: no interfaces found", ErrBootDeviceNotFound)
+		}
+		return -1, 0, nil
+	case BootDeviceHdd, BootDeviceCd, BootDeviceUsb:
+		for i, disk := range devices.Disks {
+			if diskBootDevice(disk) == bootDevice {
+				return i, -1, nil
+			}
+		}
+		return -1, -1, fmt.Errorf("%w: no disks of kind %s found", ErrBootDeviceNotFound, bootDevice)
+	default:
+		return -1, -1, fmt.Errorf("%w: %q", ErrUnsupportedBootDevice, bootDevice)
+	}
+}
+
+// diskBootDevice returns the kind of a disk
+func diskBootDevice(disk kubevirtv1.Disk) BootDevice {
+	switch {
+	case disk.CDRom != nil:
+		return BootDeviceCd
+	case disk.Disk != nil && disk.Disk.Bus == kubevirtv1.DiskBusUSB:
+		return BootDeviceUsb
+	default:
+		return BootDeviceHdd
+	}
+}
+
+// saveBootOrder records the boot order of the virtual machine in the BootOnceAnnotation along with the VMI running
+// with it, if any
+func (m *VirtualMachineResourceManager) saveBootOrder(vm *kubevirtv1.VirtualMachine) error {
+	saved := bootOnce{
+		Disks:      map[string]*uint{},
+		Interfaces: map[string]*uint{},
+	}
+	for _, disk := range vm.Spec.Template.Spec.Domain.Devices.Disks {
+		saved.Disks[disk.Name] = disk.BootOrder
+	}
+	for _, intf := range vm.Spec.Template.Spec.Domain.Devices.Interfaces {
+		saved.Interfaces[intf.Name] = intf.BootOrder
+	}
+
+	vmi, err := m.kvClient.VirtualMachineInstances(m.namespace).
+		Get(m.ctx, m.name, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		saved.VMIUID = vmi.UID
+	case !apierrors.IsNotFound(err):
+		return err
+	}
+
+	value, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if vm.Annotations == nil {
+		vm.Annotations = map[string]string{}
+	}
+	vm.Annotations[BootOnceAnnotation] = string(value)
+
+	return nil
+}
+
+// saveBootloader records in the BootOnceAnnotation, if any, the bootloader replaced by the switch to UEFI. The
+// bootloader recorded by an earlier one-time override is kept, being the one to restore.
+func saveBootloader(vm *kubevirtv1.VirtualMachine, bootloader *kubevirtv1.Bootloader) error {
+	value, ok := vm.Annotations[BootOnceAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var saved bootOnce
+	if err := json.Unmarshal([]byte(value), &saved); err != nil {
+		// The invalid annotation is discarded by RevertBootOnce
+		return nil
+	}
+	if saved.BootloaderReplaced {
+		return nil
+	}
+	saved.BootloaderReplaced = true
+	saved.Bootloader = bootloader
+
+	newValue, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	vm.Annotations[BootOnceAnnotation] = string(newValue)
+
+	return nil
+}
+
+// RevertBootOnce restores the boot order and bootloader replaced by a one-time boot override once a VMI other than
+// the one running at the time of the override has started, i.e., once the virtual machine has booted with the override
+func (m *VirtualMachineResourceManager) RevertBootOnce() error {
+	vm, err := m.kvClient.VirtualMachines(m.namespace).
+		Get(m.ctx, m.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	value, ok := vm.Annotations[BootOnceAnnotation]
+	if !ok {
 		return nil
 	}
-	m.computerSystem.SetBootOverride(bootSourceMap[bootDevice])
+
+	// An invalid annotation is discarded right away
+	var saved bootOnce
+	if err := json.Unmarshal([]byte(value), &saved); err == nil {
+		vmi, err := m.kvClient.VirtualMachineInstances(m.namespace).
+			Get(m.ctx, m.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if vmi.UID == saved.VMIUID {
+			return nil
+		}
+	}
+
+	if vm.Spec.Template != nil {
+		restoreBootOrder(&vm.Spec.Template.Spec.Domain, value)
+	}
+	delete(vm.Annotations, BootOnceAnnotation)
+
+	if _, err := m.kvClient.VirtualMachines(m.namespace).
+		Update(m.ctx, vm, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	logrus.Info("Reverted the one-time boot override")
 
 	return nil
 }
+
+// restoreBootOrder restores the boot order and bootloader saved in the BootOnceAnnotation
+func restoreBootOrder(domain *kubevirtv1.DomainSpec, value string) {
+	var saved bootOnce
+	if err := json.Unmarshal([]byte(value), &saved); err != nil {
+		// There is nothing to restore from an invalid annotation
+		logrus.Errorf("discarding invalid %s annotation: %v", BootOnceAnnotation, err)
+		return
+	}
+
+	devices := &domain.Devices
+	for i, disk := range devices.Disks {
+		if bootOrder, ok := saved.Disks[disk.Name]; ok {
+			devices.Disks[i].BootOrder = bootOrder
+		}
+	}
+	for i, intf := range devices.Interfaces {
+		if bootOrder, ok := saved.Interfaces[intf.Name]; ok {
+			devices.Interfaces[i].BootOrder = bootOrder
+		}
+	}
+
+	if saved.BootloaderReplaced && domain.Firmware != nil {
+		domain.Firmware.Bootloader = saved.Bootloader
+	}
+}
+
+// Start reverts the one-time boot overrides in the background until the context is done
+func (m *VirtualMachineResourceManager) Start() {
+	go wait.UntilWithContext(m.ctx, func(context.Context) {
+		if err := m.RevertBootOnce(); err != nil {
+			logrus.Errorf("unable to revert the one-time boot override: %v", err)
+		}
+	}, bootOnceCheckInterval)
+}
+
+// GetBootOptions returns the boot options currently set on the virtual machine
+func (m *VirtualMachineResourceManager) GetBootOptions() (*BootOptions, error) {
+	vm, err := m.kvClient.VirtualMachines(m.namespace).
+		Get(m.ctx, m.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if vm.Spec.Template == nil {
+		return nil, fmt.Errorf("no template found")
+	}
+
+	return bootOptions(vm), nil
+}
+
+// bootOptions returns the boot options of a virtual machine having a template
+func bootOptions(vm *kubevirtv1.VirtualMachine) *BootOptions {
+	domain := vm.Spec.Template.Spec.Domain
+	_, bootOncePending := vm.Annotations[BootOnceAnnotation]
+	return &BootOptions{
+		Device:     firstBootDevice(domain.Devices),
+		Persistent: !bootOncePending,
+		EFI:        domain.Firmware != nil && domain.Firmware.Bootloader != nil && domain.Firmware.Bootloader.EFI != nil,
+	}
+}
+
+// setEFIBootloader switches the virtual machine to UEFI, leaving an EFI bootloader already set untouched, and tells
+// whether the bootloader was replaced
+func setEFIBootloader(vm *kubevirtv1.VirtualMachine) bool {
+	domain := &vm.Spec.Template.Spec.Domain
+	if domain.Firmware == nil {
+		domain.Firmware = &kubevirtv1.Firmware{}
+	}
+	if domain.Firmware.Bootloader != nil && domain.Firmware.Bootloader.EFI != nil {
+		return false
+	}
+	// Secure Boot would require the SMM feature, which the virtual machine may lack
+	domain.Firmware.Bootloader = &kubevirtv1.Bootloader{
+		EFI: &kubevirtv1.EFI{
+			SecureBoot: util.Ptr(false),
+		},
+	}
+	return true
+}
+
+// firstBootDevice returns the kind of the device with the lowest boot order, if any
+func firstBootDevice(devices kubevirtv1.Devices) BootDevice {
+	var (
+		device BootDevice
+		order  uint
+	)
+	for _, disk := range devices.Disks {
+		if disk.BootOrder == nil || (device != "" && *disk.BootOrder >= order) {
+			continue
+		}
+		device, order = diskBootDevice(disk), *disk.BootOrder
+	}
+	for _, intf := range devices.Interfaces {
+		if intf.BootOrder == nil || (device != "" && *intf.BootOrder >= order) {
+			continue
+		}
+		device, order = BootDevicePxe, *intf.BootOrder
+	}
+	return device
+}
+
+// AcquireSerialConsole reserves the serial console for a single client of the BMC at a time
+func (m *VirtualMachineResourceManager) AcquireSerialConsole() (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.serialConsoleHeld {
+		return nil, ErrSerialConsoleInUse
+	}
+	m.serialConsoleHeld = true
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.serialConsoleHeld = false
+		})
+	}, nil
+}
+
+// SerialConsole connects to the serial console of the running virtual machine instance
+func (m *VirtualMachineResourceManager) SerialConsole() (io.ReadWriteCloser, error) {
+	return m.kvClient.SerialConsole(m.namespace, m.name)
+}
+
+// VNC connects to the VNC console of the running virtual machine instance
+func (m *VirtualMachineResourceManager) VNC() (io.ReadWriteCloser, error) {
+	return m.kvClient.VNC(m.namespace, m.name)
+}
+
+// GetSystemUUID returns the firmware UUID of the virtual machine, i.e., the SMBIOS system UUID seen by the guest
+func (m *VirtualMachineResourceManager) GetSystemUUID() (string, error) {
+	vm, err := m.kvClient.VirtualMachines(m.namespace).
+		Get(m.ctx, m.name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if vm.Spec.Template != nil && vm.Spec.Template.Spec.Domain.Firmware != nil &&
+		vm.Spec.Template.Spec.Domain.Firmware.UUID != "" {
+		return string(vm.Spec.Template.Spec.Domain.Firmware.UUID), nil
+	}
+
+	// KubeVirt assigns a stable firmware UUID to the VMI when the VM doesn't set one
+	vmi, err := m.kvClient.VirtualMachineInstances(m.namespace).
+		Get(m.ctx, m.name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if vmi.Spec.Domain.Firmware != nil && vmi.Spec.Domain.Firmware.UUID != "" {
+		return string(vmi.Spec.Domain.Firmware.UUID), nil
+	}
+
+	return "", fmt.Errorf("no firmware UUID found")
+}
@@ -6,10 +6,16 @@ import (
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 
 	"kubevirt.io/kubevirtbmc/pkg/builder"
 	"kubevirt.io/kubevirtbmc/pkg/fake"
+	"kubevirt.io/kubevirtbmc/pkg/generated/redfish/server"
 	"kubevirt.io/kubevirtbmc/pkg/util"
 )
 
@@ -186,7 +192,7 @@ func TestPowerOff(t *testing.T) {
 			}
 
 			// Test PowerOff
-			err := vmrm.PowerOff()
+			err := vmrm.PowerOff(false)
 			require.NoError(t, err)
 			require.Equal(t, tc.expectedVM, tc.vm)
 
@@ -197,12 +203,338 @@ func TestPowerOff(t *testing.T) {
 	}
 }
 
+func TestForcePowerOff(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachineinstances"}, "test-vm")
+
+	t.Run("Force off a running virtual machine should stop it right away", func(t *testing.T) {
+		mockClient := new(fake.MockKubevirtClient)
+		mockVMIInterface := new(fake.MockVirtualMachineInstanceInterface)
+		mockClient.On("VirtualMachineInstances", "default").Return(mockVMIInterface)
+		mockVMIInterface.On("Get", mock.Anything, "test-vm", mock.Anything).
+			Return(&kubevirtv1.VirtualMachineInstance{}, nil)
+		mockClient.On("Stop", mock.Anything, "default", "test-vm", mock.Anything).Return(nil)
+
+		vmrm := &VirtualMachineResourceManager{
+			ctx:       context.TODO(),
+			kvClient:  mockClient,
+			namespace: "default",
+			name:      "test-vm",
+		}
+
+		require.NoError(t, vmrm.PowerOff(true))
+		mockClient.AssertCalled(t, "Stop", mock.Anything, "default", "test-vm",
+			&kubevirtv1.StopOptions{GracePeriod: util.Ptr[int64](0)})
+	})
+
+	t.Run("Force off a stopped virtual machine should halt it", func(t *testing.T) {
+		vm := builder.NewVirtualMachineBuilder("default", "test-vm").
+			RunStrategy(kubevirtv1.RunStrategyRerunOnFailure).Build()
+
+		mockClient := new(fake.MockKubevirtClient)
+		mockVMInterface := new(fake.MockVirtualMachineInterface)
+		mockVMIInterface := new(fake.MockVirtualMachineInstanceInterface)
+		mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+		mockClient.On("VirtualMachineInstances", "default").Return(mockVMIInterface)
+		mockVMIInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(nil, notFound)
+		mockVMInterface.
+			On("Get", mock.Anything, "test-vm", mock.Anything).Return(vm, nil).
+			On("Update", mock.Anything, vm, mock.Anything).Return(vm, nil)
+
+		vmrm := &VirtualMachineResourceManager{
+			ctx:       context.TODO(),
+			kvClient:  mockClient,
+			namespace: "default",
+			name:      "test-vm",
+		}
+
+		require.NoError(t, vmrm.PowerOff(true))
+		require.Equal(t, builder.NewVirtualMachineBuilder("default", "test-vm").
+			RunStrategy(kubevirtv1.RunStrategyHalted).Build(), vm)
+		mockClient.AssertNotCalled(t, "Stop", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestNMI(t *testing.T) {
+	vmrm := &VirtualMachineResourceManager{
+		ctx:       context.TODO(),
+		kvClient:  new(fake.MockKubevirtClient),
+		namespace: "default",
+		name:      "test-vm",
+	}
+
+	// KubeVirt can't inject an NMI into a virtual machine instance
+	require.ErrorIs(t, vmrm.NMI(), ErrNMINotSupported)
+}
+
+func TestPauseUnpause(t *testing.T) {
+	mockClient := new(fake.MockKubevirtClient)
+	mockClient.
+		On("Pause", mock.Anything, "default", "test-vm", mock.Anything).Return(nil).
+		On("Unpause", mock.Anything, "default", "test-vm", mock.Anything).Return(nil)
+
+	vmrm := &VirtualMachineResourceManager{
+		ctx:       context.TODO(),
+		kvClient:  mockClient,
+		namespace: "default",
+		name:      "test-vm",
+	}
+
+	require.NoError(t, vmrm.Pause())
+	mockClient.AssertCalled(t, "Pause", mock.Anything, "default", "test-vm", &kubevirtv1.PauseOptions{})
+	require.NoError(t, vmrm.Unpause())
+	mockClient.AssertCalled(t, "Unpause", mock.Anything, "default", "test-vm", &kubevirtv1.UnpauseOptions{})
+}
+
+func TestGetComputerSystemPowerState(t *testing.T) {
+	testCases := []struct {
+		name   string
+		vm     *kubevirtv1.VirtualMachine
+		expect server.ResourcePowerState
+	}{
+		{
+			name:   "Ready virtual machine",
+			vm:     builder.NewVirtualMachineBuilder("default", "test-vm").Ready(true).Build(),
+			expect: server.RESOURCEPOWERSTATE_ON,
+		},
+		{
+			name:   "Stopped virtual machine",
+			vm:     builder.NewVirtualMachineBuilder("default", "test-vm").Ready(false).Build(),
+			expect: server.RESOURCEPOWERSTATE_OFF,
+		},
+		{
+			name: "Paused virtual machine",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				PrintableStatus(kubevirtv1.VirtualMachineStatusPaused).Build(),
+			expect: server.RESOURCEPOWERSTATE_PAUSED,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockClient := new(fake.MockKubevirtClient)
+			mockVMInterface := new(fake.MockVirtualMachineInterface)
+			mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+			mockVMInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(tc.vm, nil)
+
+			vmrm := &VirtualMachineResourceManager{
+				ctx:       context.TODO(),
+				kvClient:  mockClient,
+				namespace: "default",
+				name:      "test-vm",
+				computerSystem: NewComputerSystem(
+					defaultComputerSystemId, "default/test-vm", server.RESOURCEPOWERSTATE_OFF,
+				),
+			}
+
+			computerSystem, err := vmrm.GetComputerSystem()
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, computerSystem.GetPowerState())
+		})
+	}
+}
+
 func TestPowerCycle(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachineinstances"}, "test-vm")
+
+	testCases := []struct {
+		name            string
+		force           bool
+		vmiErr          error
+		expectedOptions *kubevirtv1.RestartOptions
+	}{
+		{
+			name:            "Restart a running virtual machine gracefully",
+			force:           false,
+			expectedOptions: &kubevirtv1.RestartOptions{},
+		},
+		{
+			name:            "Restart a running virtual machine right away",
+			force:           true,
+			expectedOptions: &kubevirtv1.RestartOptions{GracePeriodSeconds: util.Ptr[int64](0)},
+		},
+		{
+			name:   "Power cycle a stopped virtual machine should power it on",
+			force:  true,
+			vmiErr: notFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := builder.NewVirtualMachineBuilder("default", "test-vm").
+				RunStrategy(kubevirtv1.RunStrategyHalted).Build()
+
+			mockClient := new(fake.MockKubevirtClient)
+			mockVMInterface := new(fake.MockVirtualMachineInterface)
+			mockVMIInterface := new(fake.MockVirtualMachineInstanceInterface)
+			mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+			mockClient.On("VirtualMachineInstances", "default").Return(mockVMIInterface)
+			mockClient.On("Restart", mock.Anything, "default", "test-vm", mock.Anything).Return(nil)
+
+			var vmi *kubevirtv1.VirtualMachineInstance
+			if tc.vmiErr == nil {
+				vmi = &kubevirtv1.VirtualMachineInstance{}
+			}
+			mockVMIInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(vmi, tc.vmiErr)
+			mockVMInterface.
+				On("Get", mock.Anything, "test-vm", mock.Anything).Return(vm, nil).
+				On("Update", mock.Anything, vm, mock.Anything).Return(vm, nil)
+
+			vmrm := &VirtualMachineResourceManager{
+				ctx:       context.TODO(),
+				kvClient:  mockClient,
+				namespace: "default",
+				name:      "test-vm",
+			}
+
+			// Test PowerCycle
+			err := vmrm.PowerCycle(tc.force)
+			require.NoError(t, err)
+
+			// Assertion
+			if tc.expectedOptions != nil {
+				mockClient.AssertCalled(t, "Restart", mock.Anything, "default", "test-vm", tc.expectedOptions)
+				mockVMInterface.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				mockClient.AssertNotCalled(t, "Restart", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				require.Equal(t, builder.NewVirtualMachineBuilder("default", "test-vm").
+					RunStrategy(kubevirtv1.RunStrategyRerunOnFailure).Build(), vm)
+			}
+		})
+	}
+}
+
+func TestGetChassisStatus(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachineinstances"}, "test-vm")
+	vmiInPhase := func(phase kubevirtv1.VirtualMachineInstancePhase) *kubevirtv1.VirtualMachineInstance {
+		return &kubevirtv1.VirtualMachineInstance{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-vm"},
+			Status:     kubevirtv1.VirtualMachineInstanceStatus{Phase: phase},
+		}
+	}
+	deletedVMI := vmiInPhase(kubevirtv1.Running)
+	deletedVMI.DeletionTimestamp = &metav1.Time{}
+	pausedVMI := vmiInPhase(kubevirtv1.Running)
+	pausedVMI.Status.Conditions = []kubevirtv1.VirtualMachineInstanceCondition{
+		{Type: kubevirtv1.VirtualMachineInstancePaused, Status: corev1.ConditionTrue},
+	}
+
+	testCases := []struct {
+		name   string
+		vm     *kubevirtv1.VirtualMachine
+		vmi    *kubevirtv1.VirtualMachineInstance
+		vmiErr error
+		expect *ChassisStatus
+	}{
+		{
+			name:   "Running virtual machine",
+			vm:     builder.NewVirtualMachineBuilder("default", "test-vm").Running(true).Build(),
+			vmi:    vmiInPhase(kubevirtv1.Running),
+			expect: &ChassisStatus{PowerState: PowerStateOn, RestorePolicy: PowerRestorePolicyAlwaysOn},
+		},
+		{
+			name:   "Stopped virtual machine",
+			vm:     builder.NewVirtualMachineBuilder("default", "test-vm").Running(false).Build(),
+			vmiErr: notFound,
+			expect: &ChassisStatus{PowerState: PowerStateOff, RestorePolicy: PowerRestorePolicyAlwaysOff},
+		},
+		{
+			name: "Virtual machine waiting for its volumes",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				RunStrategy(kubevirtv1.RunStrategyRerunOnFailure).
+				PrintableStatus(kubevirtv1.VirtualMachineStatusWaitingForVolumeBinding).Build(),
+			vmiErr: notFound,
+			expect: &ChassisStatus{PowerState: PowerStatePoweringOn, RestorePolicy: PowerRestorePolicyLastState},
+		},
+		{
+			name: "Scheduling virtual machine instance",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				RunStrategy(kubevirtv1.RunStrategyManual).Build(),
+			vmi:    vmiInPhase(kubevirtv1.Scheduling),
+			expect: &ChassisStatus{PowerState: PowerStatePoweringOn, RestorePolicy: PowerRestorePolicyAlwaysOff},
+		},
+		{
+			name: "Stopping virtual machine instance",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				RunStrategy(kubevirtv1.RunStrategyHalted).Build(),
+			vmi:    deletedVMI,
+			expect: &ChassisStatus{PowerState: PowerStatePoweringOff, RestorePolicy: PowerRestorePolicyAlwaysOff},
+		},
+		{
+			name: "Paused virtual machine instance",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				RunStrategy(kubevirtv1.RunStrategyAlways).
+				PrintableStatus(kubevirtv1.VirtualMachineStatusPaused).Build(),
+			vmi:    pausedVMI,
+			expect: &ChassisStatus{PowerState: PowerStatePaused, RestorePolicy: PowerRestorePolicyAlwaysOn},
+		},
+		{
+			name: "Failed virtual machine instance",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				RunStrategy(kubevirtv1.RunStrategyOnce).Build(),
+			vmi: vmiInPhase(kubevirtv1.Failed),
+			expect: &ChassisStatus{
+				PowerState:    PowerStateOff,
+				RestorePolicy: PowerRestorePolicyAlwaysOff,
+				PowerFault:    true,
+			},
+		},
+		{
+			name: "Virtual machine missing its volumes",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				RunStrategy(kubevirtv1.RunStrategyAlways).
+				PrintableStatus(kubevirtv1.VirtualMachineStatusPvcNotFound).Build(),
+			vmiErr: notFound,
+			expect: &ChassisStatus{
+				PowerState:    PowerStateOff,
+				RestorePolicy: PowerRestorePolicyAlwaysOn,
+				DriveFault:    true,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockClient := new(fake.MockKubevirtClient)
+			mockVMInterface := new(fake.MockVirtualMachineInterface)
+			mockVMIInterface := new(fake.MockVirtualMachineInstanceInterface)
+			mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+			mockClient.On("VirtualMachineInstances", "default").Return(mockVMIInterface)
+
+			mockVMInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(tc.vm, nil)
+			mockVMIInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(tc.vmi, tc.vmiErr)
+
+			vmrm := &VirtualMachineResourceManager{
+				ctx:       context.TODO(),
+				kvClient:  mockClient,
+				namespace: "default",
+				name:      "test-vm",
+			}
+
+			// Test GetChassisStatus
+			status, err := vmrm.GetChassisStatus()
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, status)
+		})
+	}
+}
+
+func TestLastPowerEvent(t *testing.T) {
+	vm := builder.NewVirtualMachineBuilder("default", "test-vm").Running(false).Build()
+
 	mockClient := new(fake.MockKubevirtClient)
+	mockVMInterface := new(fake.MockVirtualMachineInterface)
 	mockVMIInterface := new(fake.MockVirtualMachineInstanceInterface)
+	mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
 	mockClient.On("VirtualMachineInstances", "default").Return(mockVMIInterface)
-
-	mockVMIInterface.On("Delete", mock.Anything, "test-vm", mock.Anything).Return(nil)
+	mockVMInterface.
+		On("Get", mock.Anything, "test-vm", mock.Anything).Return(vm, nil).
+		On("Update", mock.Anything, vm, mock.Anything).Return(vm, nil)
+	mockVMIInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(&kubevirtv1.VirtualMachineInstance{}, nil)
+	mockClient.
+		On("Restart", mock.Anything, "default", "test-vm", mock.Anything).Return(nil).
+		On("Pause", mock.Anything, "default", "test-vm", mock.Anything).Return(nil).
+		On("Unpause", mock.Anything, "default", "test-vm", mock.Anything).Return(nil)
 
 	vmrm := &VirtualMachineResourceManager{
 		ctx:       context.TODO(),
@@ -211,12 +543,29 @@ func TestPowerCycle(t *testing.T) {
 		name:      "test-vm",
 	}
 
-	// Test PowerCycle
-	err := vmrm.PowerCycle()
+	// No power action was requested yet
+	status, err := vmrm.GetChassisStatus()
 	require.NoError(t, err)
+	require.Nil(t, status.LastPowerEvent)
 
-	// Assertion
-	mockVMIInterface.AssertCalled(t, "Delete", mock.Anything, "test-vm", mock.Anything)
+	for _, action := range []PowerAction{PowerActionOn, PowerActionPause, PowerActionResume, PowerActionCycle, PowerActionOff} {
+		switch action {
+		case PowerActionOn:
+			require.NoError(t, vmrm.PowerOn())
+		case PowerActionPause:
+			require.NoError(t, vmrm.Pause())
+		case PowerActionResume:
+			require.NoError(t, vmrm.Unpause())
+		case PowerActionCycle:
+			require.NoError(t, vmrm.PowerCycle(false))
+		case PowerActionOff:
+			require.NoError(t, vmrm.PowerOff(false))
+		}
+		status, err := vmrm.GetChassisStatus()
+		require.NoError(t, err)
+		require.NotNil(t, status.LastPowerEvent)
+		require.Equal(t, action, status.LastPowerEvent.Action)
+	}
 }
 
 func TestSetBootDevice(t *testing.T) {
@@ -395,6 +744,64 @@ func TestSetBootDevice(t *testing.T) {
 				AddInterface("test-interface", nil).Build(),
 			shouldError: false,
 		},
+		{
+			name: "Set boot device to HDD for a virtual machine with a CD-ROM first should skip the CD-ROM",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddCDRom("test-cdrom", util.Ptr[uint](1)).
+				AddDisk("test-disk", nil).Build(),
+			bootDevice: BootDeviceHdd,
+			expectedVM: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddCDRom("test-cdrom", nil).
+				AddDisk("test-disk", util.Ptr[uint](1)).Build(),
+			shouldError: false,
+		},
+		{
+			name: "Set boot device to CD for a virtual machine with a CD-ROM should succeed",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", util.Ptr[uint](1)).
+				AddCDRom("test-cdrom", nil).Build(),
+			bootDevice: BootDeviceCd,
+			expectedVM: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", nil).
+				AddCDRom("test-cdrom", util.Ptr[uint](1)).Build(),
+			shouldError: false,
+		},
+		{
+			name: "Set boot device to CD for a virtual machine without CD-ROM should fail",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", util.Ptr[uint](1)).Build(),
+			bootDevice:  BootDeviceCd,
+			shouldError: true,
+		},
+		{
+			name: "Set boot device to USB for a virtual machine with a USB disk should succeed",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", util.Ptr[uint](1)).
+				AddUSBDisk("test-usb", nil).Build(),
+			bootDevice: BootDeviceUsb,
+			expectedVM: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", nil).
+				AddUSBDisk("test-usb", util.Ptr[uint](1)).Build(),
+			shouldError: false,
+		},
+		{
+			name: "Set no boot device should keep the boot order",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", util.Ptr[uint](2)).
+				AddInterface("test-interface", util.Ptr[uint](1)).Build(),
+			bootDevice: BootDeviceNone,
+			expectedVM: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", util.Ptr[uint](2)).
+				AddInterface("test-interface", util.Ptr[uint](1)).Build(),
+			shouldError: false,
+		},
+		{
+			name: "Set an unknown boot device should fail",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", util.Ptr[uint](1)).Build(),
+			bootDevice:  "",
+			shouldError: true,
+		},
 		// {
 		// 	name: "Set boot device to HDD for a virtual machine with disks and interfaces and with first boot order set to disk should have no effect",
 		// 	vm: builder.NewVirtualMachineBuilder("default", "test-vm").
@@ -502,9 +909,10 @@ func TestSetBootDevice(t *testing.T) {
 			}
 
 			// Test SetBootDevice
-			err := vmrm.SetBootDevice(tc.bootDevice)
+			err := vmrm.SetBootDevice(tc.bootDevice, true, false)
 			if tc.shouldError {
 				require.Error(t, err)
+				mockVMInterface.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
 			} else {
 				require.NoError(t, err)
 				require.Equal(t, tc.expectedVM, tc.vm)
@@ -515,3 +923,400 @@ func TestSetBootDevice(t *testing.T) {
 		})
 	}
 }
+
+func TestSetBootDeviceOnce(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachineinstances"}, "test-vm")
+	runningVMI := func(uid types.UID) *kubevirtv1.VirtualMachineInstance {
+		return &kubevirtv1.VirtualMachineInstance{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-vm", UID: uid},
+		}
+	}
+
+	vm := builder.NewVirtualMachineBuilder("default", "test-vm").
+		AddDisk("test-disk", util.Ptr[uint](1)).
+		AddInterface("test-interface", util.Ptr[uint](2)).Build()
+
+	mockClient := new(fake.MockKubevirtClient)
+	mockVMInterface := new(fake.MockVirtualMachineInterface)
+	mockVMIInterface := new(fake.MockVirtualMachineInstanceInterface)
+	mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+	mockClient.On("VirtualMachineInstances", "default").Return(mockVMIInterface)
+	mockVMInterface.
+		On("Get", mock.Anything, "test-vm", mock.Anything).Return(vm, nil).
+		On("Update", mock.Anything, vm, mock.Anything).Return(vm, nil)
+	vmiGet := mockVMIInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(runningVMI("first"), nil)
+
+	vmrm := &VirtualMachineResourceManager{
+		ctx:       context.TODO(),
+		kvClient:  mockClient,
+		namespace: "default",
+		name:      "test-vm",
+	}
+
+	// A one-time override records the boot order to restore
+	require.NoError(t, vmrm.SetBootDevice(BootDevicePxe, false, false))
+	require.Contains(t, vm.Annotations, BootOnceAnnotation)
+	options, err := vmrm.GetBootOptions()
+	require.NoError(t, err)
+	require.Equal(t, &BootOptions{Device: BootDevicePxe, Persistent: false}, options)
+
+	// Another one-time override keeps the boot order recorded by the first one
+	require.NoError(t, vmrm.SetBootDevice(BootDeviceHdd, false, false))
+	require.NoError(t, vmrm.SetBootDevice(BootDevicePxe, false, false))
+
+	// The override stays as long as the same VMI runs, or none does
+	require.NoError(t, vmrm.RevertBootOnce())
+	require.Contains(t, vm.Annotations, BootOnceAnnotation)
+	vmiGet.Return(nil, notFound)
+	require.NoError(t, vmrm.RevertBootOnce())
+	require.Contains(t, vm.Annotations, BootOnceAnnotation)
+
+	// The boot order is restored once the virtual machine has restarted
+	vmiGet.Return(runningVMI("second"), nil)
+	require.NoError(t, vmrm.RevertBootOnce())
+	require.Equal(t, builder.NewVirtualMachineBuilder("default", "test-vm").
+		AddDisk("test-disk", util.Ptr[uint](1)).
+		AddInterface("test-interface", util.Ptr[uint](2)).Build().Spec, vm.Spec)
+	require.NotContains(t, vm.Annotations, BootOnceAnnotation)
+
+	// A persistent override discards a pending one-time override
+	require.NoError(t, vmrm.SetBootDevice(BootDevicePxe, false, false))
+	require.NoError(t, vmrm.SetBootDevice(BootDevicePxe, true, false))
+	require.NotContains(t, vm.Annotations, BootOnceAnnotation)
+
+	// No override restores the boot order right away
+	vmiGet.Return(runningVMI("third"), nil)
+	require.NoError(t, vmrm.SetBootDevice(BootDeviceHdd, false, false))
+	require.NoError(t, vmrm.SetBootDevice(BootDeviceNone, false, false))
+	require.Equal(t, builder.NewVirtualMachineBuilder("default", "test-vm").
+		AddDisk("test-disk", nil).
+		AddInterface("test-interface", util.Ptr[uint](1)).Build().Spec, vm.Spec)
+	require.NotContains(t, vm.Annotations, BootOnceAnnotation)
+}
+
+func TestSetBootDeviceEFI(t *testing.T) {
+	testCases := []struct {
+		name      string
+		vm        *kubevirtv1.VirtualMachine
+		efi       bool
+		expectEFI bool
+	}{
+		{
+			name: "Legacy boot keeps the BIOS",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", nil).Build(),
+		},
+		{
+			name: "EFI boot switches to UEFI",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", nil).Build(),
+			efi:       true,
+			expectEFI: true,
+		},
+		{
+			name: "Legacy boot keeps the UEFI",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", nil).EFI().Build(),
+			expectEFI: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockClient := new(fake.MockKubevirtClient)
+			mockVMInterface := new(fake.MockVirtualMachineInterface)
+			mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+
+			mockVMInterface.
+				On("Get", mock.Anything, "test-vm", mock.Anything).Return(tc.vm, nil).
+				On("Update", mock.Anything, tc.vm, mock.Anything).Return(tc.vm, nil)
+
+			vmrm := &VirtualMachineResourceManager{
+				ctx:       context.TODO(),
+				kvClient:  mockClient,
+				namespace: "default",
+				name:      "test-vm",
+			}
+
+			// Test SetBootDevice
+			require.NoError(t, vmrm.SetBootDevice(BootDeviceHdd, true, tc.efi))
+			options, err := vmrm.GetBootOptions()
+			require.NoError(t, err)
+			require.Equal(t, tc.expectEFI, options.EFI)
+		})
+	}
+}
+
+func TestSetBootDeviceOnceEFI(t *testing.T) {
+	vm := builder.NewVirtualMachineBuilder("default", "test-vm").
+		AddDisk("test-disk", util.Ptr[uint](1)).
+		AddInterface("test-interface", util.Ptr[uint](2)).Build()
+
+	mockClient := new(fake.MockKubevirtClient)
+	mockVMInterface := new(fake.MockVirtualMachineInterface)
+	mockVMIInterface := new(fake.MockVirtualMachineInstanceInterface)
+	mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+	mockClient.On("VirtualMachineInstances", "default").Return(mockVMIInterface)
+	mockVMInterface.
+		On("Get", mock.Anything, "test-vm", mock.Anything).Return(vm, nil).
+		On("Update", mock.Anything, vm, mock.Anything).Return(vm, nil)
+	vmiGet := mockVMIInterface.On("Get", mock.Anything, "test-vm", mock.Anything).
+		Return(&kubevirtv1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{UID: "first"}}, nil)
+
+	vmrm := &VirtualMachineResourceManager{
+		ctx:       context.TODO(),
+		kvClient:  mockClient,
+		namespace: "default",
+		name:      "test-vm",
+	}
+
+	// A one-time UEFI override, even following a legacy one, switches to UEFI for the next start only
+	require.NoError(t, vmrm.SetBootDevice(BootDeviceHdd, false, false))
+	require.NoError(t, vmrm.SetBootDevice(BootDevicePxe, false, true))
+	options, err := vmrm.GetBootOptions()
+	require.NoError(t, err)
+	require.Equal(t, &BootOptions{Device: BootDevicePxe, Persistent: false, EFI: true}, options)
+
+	vmiGet.Return(&kubevirtv1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{UID: "second"}}, nil)
+	require.NoError(t, vmrm.RevertBootOnce())
+	options, err = vmrm.GetBootOptions()
+	require.NoError(t, err)
+	require.Equal(t, &BootOptions{Device: BootDeviceHdd, Persistent: true, EFI: false}, options)
+	require.Nil(t, vm.Spec.Template.Spec.Domain.Firmware.Bootloader)
+
+	// A persistent override drops the UEFI of a pending one-time override unless asked for
+	require.NoError(t, vmrm.SetBootDevice(BootDevicePxe, false, true))
+	require.NoError(t, vmrm.SetBootDevice(BootDevicePxe, true, false))
+	options, err = vmrm.GetBootOptions()
+	require.NoError(t, err)
+	require.Equal(t, &BootOptions{Device: BootDevicePxe, Persistent: true, EFI: false}, options)
+
+	require.NoError(t, vmrm.SetBootDevice(BootDeviceHdd, false, true))
+	require.NoError(t, vmrm.SetBootDevice(BootDeviceHdd, true, true))
+	options, err = vmrm.GetBootOptions()
+	require.NoError(t, err)
+	require.Equal(t, &BootOptions{Device: BootDeviceHdd, Persistent: true, EFI: true}, options)
+}
+
+func TestSetBootDeviceNoneOnceEFI(t *testing.T) {
+	vm := builder.NewVirtualMachineBuilder("default", "test-vm").
+		AddDisk("test-disk", util.Ptr[uint](1)).
+		AddInterface("test-interface", util.Ptr[uint](2)).Build()
+
+	mockClient := new(fake.MockKubevirtClient)
+	mockVMInterface := new(fake.MockVirtualMachineInterface)
+	mockVMIInterface := new(fake.MockVirtualMachineInstanceInterface)
+	mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+	mockClient.On("VirtualMachineInstances", "default").Return(mockVMIInterface)
+	mockVMInterface.
+		On("Get", mock.Anything, "test-vm", mock.Anything).Return(vm, nil).
+		On("Update", mock.Anything, vm, mock.Anything).Return(vm, nil)
+	vmiGet := mockVMIInterface.On("Get", mock.Anything, "test-vm", mock.Anything).
+		Return(&kubevirtv1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{UID: "first"}}, nil)
+
+	vmrm := &VirtualMachineResourceManager{
+		ctx:       context.TODO(),
+		kvClient:  mockClient,
+		namespace: "default",
+		name:      "test-vm",
+	}
+
+	// No boot device with a one-time UEFI override drops the pending override and switches to UEFI for the next start
+	require.NoError(t, vmrm.SetBootDevice(BootDevicePxe, false, false))
+	require.NoError(t, vmrm.SetBootDevice(BootDeviceNone, false, true))
+	options, err := vmrm.GetBootOptions()
+	require.NoError(t, err)
+	require.Equal(t, &BootOptions{Device: BootDeviceHdd, Persistent: false, EFI: true}, options)
+
+	vmiGet.Return(&kubevirtv1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{UID: "second"}}, nil)
+	require.NoError(t, vmrm.RevertBootOnce())
+	options, err = vmrm.GetBootOptions()
+	require.NoError(t, err)
+	require.Equal(t, &BootOptions{Device: BootDeviceHdd, Persistent: true, EFI: false}, options)
+	require.Equal(t, builder.NewVirtualMachineBuilder("default", "test-vm").
+		AddDisk("test-disk", util.Ptr[uint](1)).
+		AddInterface("test-interface", util.Ptr[uint](2)).Build().Spec.Template.Spec.Domain.Devices,
+		vm.Spec.Template.Spec.Domain.Devices)
+	require.Nil(t, vm.Spec.Template.Spec.Domain.Firmware.Bootloader)
+	require.NotContains(t, vm.Annotations, BootOnceAnnotation)
+}
+
+func TestGetBootOptions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		vm          *kubevirtv1.VirtualMachine
+		expected    *BootOptions
+		shouldError bool
+	}{
+		{
+			name: "Boot from the network",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", util.Ptr[uint](2)).
+				AddInterface("test-interface", util.Ptr[uint](1)).Build(),
+			expected: &BootOptions{Device: BootDevicePxe, Persistent: true},
+		},
+		{
+			name: "Boot from the disk with UEFI",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddCDRom("test-cdrom", util.Ptr[uint](3)).
+				AddDisk("test-disk", util.Ptr[uint](1)).
+				AddInterface("test-interface", util.Ptr[uint](2)).
+				EFI().Build(),
+			expected: &BootOptions{Device: BootDeviceHdd, Persistent: true, EFI: true},
+		},
+		{
+			name: "Boot from the CD-ROM",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", nil).
+				AddCDRom("test-cdrom", util.Ptr[uint](1)).Build(),
+			expected: &BootOptions{Device: BootDeviceCd, Persistent: true},
+		},
+		{
+			name: "Boot from the removable disk",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", util.Ptr[uint](2)).
+				AddUSBDisk("test-usb", util.Ptr[uint](1)).Build(),
+			expected: &BootOptions{Device: BootDeviceUsb, Persistent: true},
+		},
+		{
+			name: "No boot order",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				AddDisk("test-disk", nil).
+				AddInterface("test-interface", nil).Build(),
+			expected: &BootOptions{Persistent: true},
+		},
+		{
+			name:        "No template",
+			vm:          builder.NewVirtualMachineBuilder("default", "test-vm").Build(),
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockClient := new(fake.MockKubevirtClient)
+			mockVMInterface := new(fake.MockVirtualMachineInterface)
+			mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+
+			mockVMInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(tc.vm, nil)
+
+			vmrm := &VirtualMachineResourceManager{
+				ctx:       context.TODO(),
+				kvClient:  mockClient,
+				namespace: "default",
+				name:      "test-vm",
+			}
+
+			// Test GetBootOptions
+			options, err := vmrm.GetBootOptions()
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, options)
+			}
+		})
+	}
+}
+
+func TestGetSystemUUID(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachineinstances"}, "test-vm")
+
+	testCases := []struct {
+		name        string
+		vm          *kubevirtv1.VirtualMachine
+		vmi         *kubevirtv1.VirtualMachineInstance
+		vmiErr      error
+		expect      string
+		shouldError bool
+	}{
+		{
+			name: "Firmware UUID set on the virtual machine",
+			vm: builder.NewVirtualMachineBuilder("default", "test-vm").
+				FirmwareUUID("5e1a4c6f-31b2-4d8e-9a07-c2f3b4d5e6f7").Build(),
+			expect: "5e1a4c6f-31b2-4d8e-9a07-c2f3b4d5e6f7",
+		},
+		{
+			name: "Firmware UUID assigned to the running virtual machine instance",
+			vm:   builder.NewVirtualMachineBuilder("default", "test-vm").Build(),
+			vmi: &kubevirtv1.VirtualMachineInstance{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-vm"},
+				Spec: kubevirtv1.VirtualMachineInstanceSpec{
+					Domain: kubevirtv1.DomainSpec{
+						Firmware: &kubevirtv1.Firmware{UUID: "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0"},
+					},
+				},
+			},
+			expect: "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0",
+		},
+		{
+			name:        "No firmware UUID on a stopped virtual machine",
+			vm:          builder.NewVirtualMachineBuilder("default", "test-vm").Build(),
+			vmiErr:      notFound,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockClient := new(fake.MockKubevirtClient)
+			mockVMInterface := new(fake.MockVirtualMachineInterface)
+			mockVMIInterface := new(fake.MockVirtualMachineInstanceInterface)
+			mockClient.On("VirtualMachines", "default").Return(mockVMInterface)
+			mockClient.On("VirtualMachineInstances", "default").Return(mockVMIInterface)
+
+			mockVMInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(tc.vm, nil)
+			mockVMIInterface.On("Get", mock.Anything, "test-vm", mock.Anything).Return(tc.vmi, tc.vmiErr)
+
+			vmrm := &VirtualMachineResourceManager{
+				ctx:       context.TODO(),
+				kvClient:  mockClient,
+				namespace: "default",
+				name:      "test-vm",
+			}
+
+			// Test GetSystemUUID
+			systemUUID, err := vmrm.GetSystemUUID()
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expect, systemUUID)
+			}
+		})
+	}
+}
+
+func TestEnableGraphicalConsole(t *testing.T) {
+	vmrm := &VirtualMachineResourceManager{
+		manager: NewManager(defaultManagerId, defaultManagerName),
+	}
+	require.False(t, vmrm.manager.GetManager().GraphicalConsole.ServiceEnabled)
+
+	vmrm.EnableGraphicalConsole()
+	graphicalConsole := vmrm.manager.GetManager().GraphicalConsole
+	require.True(t, graphicalConsole.ServiceEnabled)
+	require.Equal(t, []server.ManagerV1190GraphicalConnectTypesSupported{
+		server.MANAGERV1190GRAPHICALCONNECTTYPESSUPPORTED_KVMIP,
+	}, graphicalConsole.ConnectTypesSupported)
+}
+
+func TestAcquireSerialConsole(t *testing.T) {
+	vmrm := &VirtualMachineResourceManager{}
+
+	release, err := vmrm.AcquireSerialConsole()
+	require.NoError(t, err)
+
+	// A single client holds the serial console at a time
+	_, err = vmrm.AcquireSerialConsole()
+	require.ErrorIs(t, err, ErrSerialConsoleInUse)
+
+	// Releasing it twice doesn't release it on behalf of the next holder
+	release()
+	next, err := vmrm.AcquireSerialConsole()
+	require.NoError(t, err)
+	release()
+	_, err = vmrm.AcquireSerialConsole()
+	require.ErrorIs(t, err, ErrSerialConsoleInUse)
+	next()
+}
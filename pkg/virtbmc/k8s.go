@@ -1,13 +1,36 @@
 package virtbmc
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/websocket"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	kubevirtv1 "kubevirt.io/api/core/v1"
 
 	kubevirtv1type "kubevirt.io/kubevirtbmc/pkg/generated/clientset/versioned/typed/core/v1"
 )
 
-func NewK8sClient(options Options) *kubevirtv1type.KubevirtV1Client {
+// subresourceProtocol is the WebSocket subprotocol of the KubeVirt console subresources, carrying the raw stream in
+// binary messages
+const subresourceProtocol = "plain.kubevirt.io"
+
+// KubeVirtClient is the KubeVirt clientset along with the subresources of the virtual machines and the virtual machine
+// instances, which the generated clientset lacks
+type KubeVirtClient struct {
+	*kubevirtv1type.KubevirtV1Client
+	config *rest.Config
+}
+
+func NewK8sClient(options Options) *KubeVirtClient {
 	var (
 		config *rest.Config
 		err    error
@@ -37,5 +60,114 @@ genClientset:
 		panic(err.Error())
 	}
 
-	return clientset
+	return &KubeVirtClient{
+		KubevirtV1Client: clientset,
+		config:           config,
+	}
+}
+
+// SerialConsole connects to the serial console of a virtual machine instance
+func (c *KubeVirtClient) SerialConsole(namespace, name string) (io.ReadWriteCloser, error) {
+	return c.stream(namespace, name, "console")
+}
+
+// VNC connects to the VNC console of a virtual machine instance
+func (c *KubeVirtClient) VNC(namespace, name string) (io.ReadWriteCloser, error) {
+	return c.stream(namespace, name, "vnc")
+}
+
+// Stop stops a virtual machine, shortening the termination grace period of its virtual machine instance to the one of
+// the options, if set
+func (c *KubeVirtClient) Stop(ctx context.Context, namespace, name string, options *kubevirtv1.StopOptions) error {
+	return c.put(ctx, namespace, "virtualmachines", name, "stop", options)
+}
+
+// Restart restarts a virtual machine, stopping its virtual machine instance right away if the options set a zero grace
+// period
+func (c *KubeVirtClient) Restart(ctx context.Context, namespace, name string, options *kubevirtv1.RestartOptions) error {
+	return c.put(ctx, namespace, "virtualmachines", name, "restart", options)
+}
+
+// Pause pauses a virtual machine instance, freezing the guest
+func (c *KubeVirtClient) Pause(ctx context.Context, namespace, name string, options *kubevirtv1.PauseOptions) error {
+	return c.put(ctx, namespace, "virtualmachineinstances", name, "pause", options)
+}
+
+// Unpause resumes a paused virtual machine instance
+func (c *KubeVirtClient) Unpause(
+	ctx context.Context, namespace, name string, options *kubevirtv1.UnpauseOptions,
+) error {
+	return c.put(ctx, namespace, "virtualmachineinstances", name, "unpause", options)
+}
+
+// put requests an action through a subresource of a virtual machine or a virtual machine instance
+func (c *KubeVirtClient) put(ctx context.Context, namespace, resource, name, subresource string, options any) error {
+	body, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return c.RESTClient().Put().
+		AbsPath("/apis/subresources.kubevirt.io/v1/namespaces", namespace, resource, name, subresource).
+		Body(body).
+		Do(ctx).
+		Error()
+}
+
+// stream opens a WebSocket connection to a streaming subresource of a virtual machine instance
+func (c *KubeVirtClient) stream(namespace, name, subresource string) (io.ReadWriteCloser, error) {
+	location, err := url.Parse(c.config.Host)
+	if err != nil {
+		return nil, err
+	}
+	switch location.Scheme {
+	case "https", "":
+		location.Scheme = "wss"
+	case "http":
+		location.Scheme = "ws"
+	}
+	location.Path = path.Join(location.Path, "/apis/subresources.kubevirt.io/v1/namespaces", namespace, "virtualmachineinstances", name, subresource)
+
+	config, err := websocket.NewConfig(location.String(), "http://localhost")
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{subresourceProtocol}
+	if config.TlsConfig, err = rest.TLSConfigFor(c.config); err != nil {
+		return nil, err
+	}
+	if config.Header, err = c.authorization(); err != nil {
+		return nil, err
+	}
+
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the %s of %s/%s: %w", subresource, namespace, name, err)
+	}
+	conn.PayloadType = websocket.BinaryFrame
+
+	return conn, nil
+}
+
+// authorization returns the headers authenticating the agent against the API server. The token file is read on
+// every call as the projected service account tokens get rotated.
+func (c *KubeVirtClient) authorization() (http.Header, error) {
+	header := http.Header{}
+
+	token := c.config.BearerToken
+	if c.config.BearerTokenFile != "" {
+		b, err := os.ReadFile(c.config.BearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	switch {
+	case token != "":
+		header.Set("Authorization", "Bearer "+token)
+	case c.config.Username != "":
+		req := &http.Request{Header: header}
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	return header, nil
 }
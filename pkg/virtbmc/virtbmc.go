@@ -3,13 +3,20 @@ package virtbmc
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/sirupsen/logrus"
+	kubevirtapiv1 "kubevirt.io/api/core/v1"
 
+	"kubevirt.io/kubevirtbmc/pkg/credential"
 	kubevirtv1 "kubevirt.io/kubevirtbmc/pkg/generated/clientset/versioned/typed/core/v1"
 	"kubevirt.io/kubevirtbmc/pkg/ipmi"
 	"kubevirt.io/kubevirtbmc/pkg/redfish"
 	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
+	"kubevirt.io/kubevirtbmc/pkg/vnc"
 )
 
 type VMNameKey struct{}
@@ -20,12 +27,37 @@ type Options struct {
 	KubeconfigPath string
 	Address        string
 	IPMIPort       int
-	RedfishPort    int
+	// SOLPort is the port the remote consoles reach the IPMI port at, e.g., through a Service, which is the IPMI port
+	// if it is 0
+	SOLPort int
+	// SOLPortFile points to a file holding the SOL port, usually a mounted ConfigMap. It is read whenever the port is
+	// reported, and takes precedence over SOLPort unless it can't be read.
+	SOLPortFile string
+	RedfishPort int
+	// VNCPort is the port of the VNC proxy, which is disabled if it is 0
+	VNCPort int
+
+	// Version is the version of the agent, reported as the BMC firmware
+	// revision.
+	Version string
+
+	// CredentialsDir points to a directory containing the username and
+	// password files, usually a mounted Secret. It takes precedence over
+	// Username and Password.
+	CredentialsDir string
+	Username       string
+	Password       string
 }
 
 type KubeVirtClientInterface interface {
 	VirtualMachines(namespace string) kubevirtv1.VirtualMachineInterface
 	VirtualMachineInstances(namespace string) kubevirtv1.VirtualMachineInstanceInterface
+	SerialConsole(namespace, name string) (io.ReadWriteCloser, error)
+	VNC(namespace, name string) (io.ReadWriteCloser, error)
+	Stop(ctx context.Context, namespace, name string, options *kubevirtapiv1.StopOptions) error
+	Restart(ctx context.Context, namespace, name string, options *kubevirtapiv1.RestartOptions) error
+	Pause(ctx context.Context, namespace, name string, options *kubevirtapiv1.PauseOptions) error
+	Unpause(ctx context.Context, namespace, name string, options *kubevirtapiv1.UnpauseOptions) error
 }
 
 type VirtBMC struct {
@@ -33,6 +65,7 @@ type VirtBMC struct {
 	address     string
 	ipmiPort    int
 	redfishPort int
+	vncPort     int
 	vmNamespace string
 	vmName      string
 
@@ -42,31 +75,79 @@ type VirtBMC struct {
 
 	ipmiSimulator   *ipmi.Simulator
 	redfishEmulator *redfish.Emulator
+	vncProxy        *vnc.Proxy
 }
 
 func NewVirtBMC(ctx context.Context, options Options, inCluster bool) (*VirtBMC, error) {
 	kvClient := NewK8sClient(options)
 	resourceManager := resourcemanager.NewVirtualMachineResourceManager(ctx, kvClient)
+	credentials, err := newCredentialProvider(options)
+	if err != nil {
+		return nil, err
+	}
+	var vncProxy *vnc.Proxy
+	if options.VNCPort != 0 {
+		vncProxy = vnc.NewProxy(options.Address, options.VNCPort, resourceManager, credentials)
+	}
 	return &VirtBMC{
 		context:         ctx,
 		address:         options.Address,
 		ipmiPort:        options.IPMIPort,
 		redfishPort:     options.RedfishPort,
+		vncPort:         options.VNCPort,
 		vmNamespace:     ctx.Value(VMNamespaceKey{}).(string),
 		vmName:          ctx.Value(VMNameKey{}).(string),
 		kvClient:        kvClient,
 		resourceManager: resourceManager,
-		ipmiSimulator:   ipmi.NewSimulator(options.Address, options.IPMIPort, resourceManager),
-		redfishEmulator: redfish.NewEmulator(ctx, options.RedfishPort, resourceManager),
+		ipmiSimulator:   ipmi.NewSimulator(options.Address, options.IPMIPort, newSOLPortFunc(options), resourceManager, credentials, options.Version),
+		redfishEmulator: redfish.NewEmulator(ctx, options.RedfishPort, resourceManager, credentials),
+		vncProxy:        vncProxy,
 	}, nil
 }
 
+// newCredentialProvider refuses to fall back to a well-known credential, so the
+// agent doesn't start when none is configured.
+func newCredentialProvider(options Options) (credential.Provider, error) {
+	if options.CredentialsDir != "" {
+		logrus.Infof("Loading credentials from %s", options.CredentialsDir)
+		return credential.NewFileProvider(options.CredentialsDir), nil
+	}
+	if options.Username == "" || options.Password == "" {
+		return nil, fmt.Errorf("no credentials configured: set --credentials-dir, or both --username and --password")
+	}
+	return credential.NewStaticProvider(options.Username, options.Password), nil
+}
+
+// newSOLPortFunc returns the port the remote consoles reach the IPMI port at. The file is read on every call so that a
+// ConfigMap volume updated by the kubelet, e.g., once a node port is allocated, takes effect without restarting the
+// process.
+func newSOLPortFunc(options Options) func() int {
+	if options.SOLPortFile == "" {
+		return func() int { return options.SOLPort }
+	}
+	return func() int {
+		b, err := os.ReadFile(options.SOLPortFile)
+		if err != nil {
+			logrus.Debugf("Unable to read the SOL port, falling back to %d: %v", options.SOLPort, err)
+			return options.SOLPort
+		}
+		port, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil || port < 0 || port > 65535 {
+			logrus.Warnf("Invalid SOL port %q in %s, falling back to %d", b, options.SOLPortFile, options.SOLPort)
+			return options.SOLPort
+		}
+		return port
+	}
+}
+
 func (b *VirtBMC) Run() error {
 	logrus.Info("Initializing the the VirtBMC agent...")
 
 	if err := b.resourceManager.Initialize(b.vmNamespace, b.vmName); err != nil {
 		return fmt.Errorf("unable to initialize the resource manager: %v", err)
 	}
+	// Revert the one-time boot overrides once the virtual machine has booted
+	b.resourceManager.Start()
 
 	// Start the IPMI simulator
 	if err := b.ipmiSimulator.Run(); err != nil {
@@ -80,10 +161,22 @@ func (b *VirtBMC) Run() error {
 	}
 	logrus.Infof("Redfish service listens on %s:%d", b.address, b.redfishPort)
 
+	// Start the VNC proxy
+	if b.vncProxy != nil {
+		if err := b.vncProxy.Run(); err != nil {
+			return fmt.Errorf("unable to run the vnc proxy: %v", err)
+		}
+		b.resourceManager.EnableGraphicalConsole()
+		logrus.Infof("VNC service listens on %s:%d", b.address, b.vncPort)
+	}
+
 	<-b.context.Done()
 	logrus.Info("Gracefully shutting down the VirtBMC agent...")
 	b.ipmiSimulator.Stop()
 	b.redfishEmulator.Stop()
+	if b.vncProxy != nil {
+		b.vncProxy.Stop()
+	}
 
 	return nil
 }
@@ -0,0 +1,447 @@
+package vnc
+
+import (
+	"bufio"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"kubevirt.io/kubevirtbmc/pkg/credential"
+	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
+)
+
+// RFB protocol versions per section 7.1.1 of RFC 6143
+const (
+	protocolVersion33 = "RFB 003.003\n"
+	protocolVersion37 = "RFB 003.007\n"
+	protocolVersion38 = "RFB 003.008\n"
+
+	protocolVersionSize = 12
+)
+
+// Security types per section 7.1.2 of RFC 6143
+const (
+	securityTypeNone    = 1
+	securityTypeVNCAuth = 2
+)
+
+// Security results per section 7.1.3 of RFC 6143
+const (
+	securityResultOK     = 0
+	securityResultFailed = 1
+)
+
+const (
+	challengeSize = 16
+	// passwordSize is the number of significant characters of a VNC password, used as the DES key
+	passwordSize = 8
+	// handshakeTimeout bounds the time a client has to authenticate
+	handshakeTimeout = 30 * time.Second
+	// failureDelay slows down the clients guessing the password
+	failureDelay = time.Second
+	// maxHandshakes bounds the number of clients authenticating at the same time, the others being disconnected
+	maxHandshakes = 4
+)
+
+var errSecurityFailed = errors.New("security handshake failed")
+
+// Proxy serves the VNC console of the virtual machine over RFB. The clients authenticate with the VNC
+// authentication scheme keyed by the VNC password of the credentials, never by the BMC password which the scheme
+// would truncate, while the connection to the VNC console of the virtual machine instance, which the API server
+// already authenticated, requires no authentication.
+type Proxy struct {
+	address string
+	port    int
+
+	rm          resourcemanager.ResourceManager
+	credentials credential.Provider
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	// handshakes holds a token per client going through the handshake
+	handshakes chan struct{}
+
+	mu      sync.Mutex
+	stopped bool
+	conns   map[net.Conn]struct{}
+	// inSession is set while an authenticated client holds the console, which serves one session at a time
+	inSession bool
+}
+
+func NewProxy(
+	address string,
+	port int,
+	resourceManager resourcemanager.ResourceManager,
+	credentials credential.Provider,
+) *Proxy {
+	return &Proxy{
+		address:     address,
+		port:        port,
+		rm:          resourceManager,
+		credentials: credentials,
+		handshakes:  make(chan struct{}, maxHandshakes),
+		conns:       map[net.Conn]struct{}{},
+	}
+}
+
+func (p *Proxy) Run() error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(p.address, strconv.Itoa(p.port)))
+	if err != nil {
+		return err
+	}
+	p.listener = listener
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.serve()
+	}()
+
+	return nil
+}
+
+func (p *Proxy) Stop() {
+	if p.listener != nil {
+		_ = p.listener.Close()
+	}
+
+	p.mu.Lock()
+	p.stopped = true
+	for conn := range p.conns {
+		_ = conn.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	logrus.Info("VNC proxy gracefully stopped")
+}
+
+func (p *Proxy) localAddr() net.Addr {
+	if p.listener == nil {
+		return nil
+	}
+	return p.listener.Addr()
+}
+
+func (p *Proxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return // listener closed
+		}
+
+		select {
+		case p.handshakes <- struct{}{}:
+		default:
+			logrus.Warnf("VNC connection from %s refused: too many clients authenticating", conn.RemoteAddr())
+			_ = conn.Close()
+			continue
+		}
+
+		if !p.track(conn) {
+			_ = conn.Close()
+			return
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer p.untrack(conn)
+			defer conn.Close()
+
+			if err := p.handle(conn, sync.OnceFunc(func() { <-p.handshakes })); err != nil {
+				logrus.Warnf("VNC connection from %s closed: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// track records a client connection, which is closed when the proxy stops, returning false if it is stopping already
+func (p *Proxy) track(conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return false
+	}
+	p.conns[conn] = struct{}{}
+	return true
+}
+
+func (p *Proxy) untrack(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.conns, conn)
+}
+
+// acquireSession reserves the console for an authenticated client, returning false if another one holds it already
+func (p *Proxy) acquireSession() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inSession {
+		return false
+	}
+	p.inSession = true
+	return true
+}
+
+func (p *Proxy) releaseSession() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.inSession = false
+}
+
+// handle authenticates a client, then proxies it to the VNC console of the virtual machine instance. endHandshake is
+// called once the client is done authenticating.
+func (p *Proxy) handle(conn net.Conn, endHandshake func()) error {
+	defer endHandshake()
+
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	r := bufio.NewReader(conn)
+
+	version, err := p.negotiateVersion(conn, r)
+	if err != nil {
+		return err
+	}
+	if err := p.authenticate(conn, r, version); err != nil {
+		return err
+	}
+	endHandshake()
+
+	if !p.acquireSession() {
+		_ = securityResult(conn, version, "VNC console in use")
+		return errors.New("VNC console in use")
+	}
+	defer p.releaseSession()
+
+	console, err := p.rm.VNC()
+	if err == nil {
+		err = connectConsole(console)
+		if err != nil {
+			_ = console.Close()
+		}
+	}
+	if err != nil {
+		_ = securityResult(conn, version, "VNC console unavailable")
+		return fmt.Errorf("unable to connect to the VNC console: %w", err)
+	}
+	defer console.Close()
+
+	if err := securityResult(conn, version, ""); err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	logrus.Infof("VNC console connected from %s", conn.RemoteAddr())
+	proxy(conn, r, console)
+	logrus.Infof("VNC console disconnected from %s", conn.RemoteAddr())
+
+	return nil
+}
+
+// negotiateVersion agrees on the protocol version with the client per section 7.1.1 of RFC 6143
+func (p *Proxy) negotiateVersion(conn net.Conn, r io.Reader) (string, error) {
+	if _, err := io.WriteString(conn, protocolVersion38); err != nil {
+		return "", err
+	}
+	b := make([]byte, protocolVersionSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+
+	switch version := string(b); version {
+	case protocolVersion33, protocolVersion37, protocolVersion38:
+		return version, nil
+	default:
+		// Versions other than the ones of RFC 6143 are treated as version 3.3 as advised by section 7.1.1
+		return protocolVersion33, nil
+	}
+}
+
+// authenticate runs the VNC authentication of the client per section 7.2.2 of RFC 6143. The security result is left
+// to the caller.
+func (p *Proxy) authenticate(conn net.Conn, r io.Reader, version string) error {
+	if version == protocolVersion33 {
+		// The server decides on the security type
+		if err := binary.Write(conn, binary.BigEndian, uint32(securityTypeVNCAuth)); err != nil {
+			return err
+		}
+	} else {
+		if _, err := conn.Write([]byte{1, securityTypeVNCAuth}); err != nil {
+			return err
+		}
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		if b[0] != securityTypeVNCAuth {
+			_ = securityResult(conn, version, "unsupported security type")
+			return fmt.Errorf("unsupported security type %d", b[0])
+		}
+	}
+
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return err
+	}
+	if _, err := conn.Write(challenge); err != nil {
+		return err
+	}
+	response := make([]byte, challengeSize)
+	if _, err := io.ReadFull(r, response); err != nil {
+		return err
+	}
+
+	c, err := p.credentials.Credential()
+	if err != nil {
+		_ = securityResult(conn, version, "authentication unavailable")
+		return fmt.Errorf("unable to load credentials: %w", err)
+	}
+	if c.VNCPassword == "" {
+		_ = securityResult(conn, version, "authentication unavailable")
+		return errors.New("no VNC password configured")
+	}
+	expected, err := vncAuthResponse(c.VNCPassword, challenge)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(expected, response) != 1 {
+		time.Sleep(failureDelay)
+		_ = securityResult(conn, version, "authentication failed")
+		return errors.New("authentication failed")
+	}
+
+	return nil
+}
+
+// securityResult sends the result of the security handshake, which failed if reason is set. The reason is only sent
+// to the clients of version 3.8.
+func securityResult(w io.Writer, version, reason string) error {
+	if reason == "" {
+		return binary.Write(w, binary.BigEndian, uint32(securityResultOK))
+	}
+
+	b := binary.BigEndian.AppendUint32(nil, securityResultFailed)
+	if version == protocolVersion38 {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(reason)))
+		b = append(b, reason...)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// vncAuthResponse encrypts the challenge of the VNC authentication with the password. The password is truncated or
+// padded with zeros to 8 characters, and the bits of every character are reversed to make the DES key.
+func vncAuthResponse(password string, challenge []byte) ([]byte, error) {
+	key := make([]byte, passwordSize)
+	copy(key, password)
+	for i := range key {
+		key[i] = bits.Reverse8(key[i])
+	}
+
+	block, err := des.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]byte, len(challenge))
+	for i := 0; i < len(challenge); i += block.BlockSize() {
+		block.Encrypt(response[i:], challenge[i:])
+	}
+	return response, nil
+}
+
+// connectConsole runs the handshake with the VNC console of the virtual machine instance up to the security result,
+// picking no authentication, so that the client and the console carry on with the initialization messages
+func connectConsole(console io.ReadWriter) error {
+	b := make([]byte, protocolVersionSize)
+	if _, err := io.ReadFull(console, b); err != nil {
+		return err
+	}
+	if string(b) != protocolVersion38 && string(b) != protocolVersion37 {
+		return fmt.Errorf("unsupported protocol version %q", b)
+	}
+	if _, err := io.WriteString(console, string(b)); err != nil {
+		return err
+	}
+
+	var count uint8
+	if err := binary.Read(console, binary.BigEndian, &count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s", errSecurityFailed, readReason(console))
+	}
+	types := make([]byte, count)
+	if _, err := io.ReadFull(console, types); err != nil {
+		return err
+	}
+	supported := false
+	for _, t := range types {
+		supported = supported || t == securityTypeNone
+	}
+	if !supported {
+		return fmt.Errorf("%w: security types %v offered", errSecurityFailed, types)
+	}
+	if _, err := console.Write([]byte{securityTypeNone}); err != nil {
+		return err
+	}
+
+	// Version 3.7 sends no security result for the None security type
+	if string(b) == protocolVersion37 {
+		return nil
+	}
+	var result uint32
+	if err := binary.Read(console, binary.BigEndian, &result); err != nil {
+		return err
+	}
+	if result != securityResultOK {
+		return fmt.Errorf("%w: %s", errSecurityFailed, readReason(console))
+	}
+	return nil
+}
+
+// readReason reads the reason string following a failed security handshake
+func readReason(r io.Reader) string {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil || length > 1024 {
+		return "unknown reason"
+	}
+	reason := make([]byte, length)
+	if _, err := io.ReadFull(r, reason); err != nil {
+		return "unknown reason"
+	}
+	return string(reason)
+}
+
+// proxy copies the messages between the client and the console until either side closes. The client side is read
+// from its buffered reader, which may hold the messages already sent by the client.
+func proxy(conn net.Conn, r io.Reader, console io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(console, r)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, console)
+		done <- struct{}{}
+	}()
+	<-done
+
+	_ = console.Close()
+	_ = conn.Close()
+	<-done
+}
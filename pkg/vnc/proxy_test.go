@@ -0,0 +1,270 @@
+package vnc
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"kubevirt.io/kubevirtbmc/pkg/credential"
+	"kubevirt.io/kubevirtbmc/pkg/resourcemanager"
+)
+
+// testCredentials hands out a fixed credential, including the VNC password that the static provider lacks
+type testCredentials credential.Credential
+
+func (c testCredentials) Credential() (credential.Credential, error) {
+	return credential.Credential(c), nil
+}
+
+func newTestProxy(t *testing.T, mockRM resourcemanager.ResourceManager) *Proxy {
+	return newTestProxyWithCredentials(t, mockRM, testCredentials{
+		Username:    "admin",
+		Password:    "s3cr3t-password",
+		VNCPassword: "vncs3cr3",
+	})
+}
+
+func newTestProxyWithCredentials(
+	t *testing.T,
+	mockRM resourcemanager.ResourceManager,
+	credentials credential.Provider,
+) *Proxy {
+	p := NewProxy("127.0.0.1", 0, mockRM, credentials)
+	require.NoError(t, p.Run())
+	t.Cleanup(p.Stop)
+	return p
+}
+
+// dial connects to the proxy and runs the VNC authentication with the given version and password, returning the
+// connection and the security result
+func dial(t *testing.T, p *Proxy, version, password string) (net.Conn, uint32) {
+	conn, err := net.Dial("tcp", p.localAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	b := make([]byte, protocolVersionSize)
+	_, err = io.ReadFull(conn, b)
+	require.NoError(t, err)
+	assert.Equal(t, protocolVersion38, string(b))
+	_, err = io.WriteString(conn, version)
+	require.NoError(t, err)
+
+	if version == protocolVersion33 {
+		var securityType uint32
+		require.NoError(t, binary.Read(conn, binary.BigEndian, &securityType))
+		require.Equal(t, uint32(securityTypeVNCAuth), securityType)
+	} else {
+		b = make([]byte, 2)
+		_, err = io.ReadFull(conn, b)
+		require.NoError(t, err)
+		require.Equal(t, []byte{1, securityTypeVNCAuth}, b)
+		_, err = conn.Write([]byte{securityTypeVNCAuth})
+		require.NoError(t, err)
+	}
+
+	challenge := make([]byte, challengeSize)
+	_, err = io.ReadFull(conn, challenge)
+	require.NoError(t, err)
+	response, err := vncAuthResponse(password, challenge)
+	require.NoError(t, err)
+	_, err = conn.Write(response)
+	require.NoError(t, err)
+
+	var result uint32
+	require.NoError(t, binary.Read(conn, binary.BigEndian, &result))
+	return conn, result
+}
+
+// fakeConsole plays the VNC console of the virtual machine instance, offering no authentication
+func fakeConsole(t *testing.T) (io.ReadWriteCloser, net.Conn) {
+	proxyEnd, vmEnd := net.Pipe()
+	t.Cleanup(func() { _ = vmEnd.Close() })
+
+	go func() {
+		_, _ = io.WriteString(vmEnd, protocolVersion38)
+		b := make([]byte, protocolVersionSize)
+		if _, err := io.ReadFull(vmEnd, b); err != nil {
+			return
+		}
+		_, _ = vmEnd.Write([]byte{1, securityTypeNone})
+		if _, err := io.ReadFull(vmEnd, b[:1]); err != nil || b[0] != securityTypeNone {
+			return
+		}
+		_ = binary.Write(vmEnd, binary.BigEndian, uint32(securityResultOK))
+	}()
+
+	return proxyEnd, vmEnd
+}
+
+func readReasonFrom(t *testing.T, conn net.Conn) string {
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	return readReason(conn)
+}
+
+func TestProxy(t *testing.T) {
+	for _, version := range []string{protocolVersion38, protocolVersion37, protocolVersion33} {
+		t.Run(version[:len(version)-1], func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockRM := resourcemanager.NewMockResourceManager(ctrl)
+			console, vmEnd := fakeConsole(t)
+			mockRM.EXPECT().VNC().Return(console, nil)
+			p := newTestProxy(t, mockRM)
+
+			conn, result := dial(t, p, version, "vncs3cr3")
+			require.Equal(t, uint32(securityResultOK), result)
+
+			// The initialization messages go through
+			_, err := conn.Write([]byte{0x01}) // ClientInit, shared
+			require.NoError(t, err)
+			b := make([]byte, 1)
+			_, err = io.ReadFull(vmEnd, b)
+			require.NoError(t, err)
+			assert.Equal(t, []byte{0x01}, b)
+
+			go func() { _, _ = io.WriteString(vmEnd, "ServerInit") }()
+			b = make([]byte, len("ServerInit"))
+			_, err = io.ReadFull(conn, b)
+			require.NoError(t, err)
+			assert.Equal(t, "ServerInit", string(b))
+
+			// The console is closed along with the client connection
+			require.NoError(t, conn.Close())
+			_, err = vmEnd.Read(b)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestProxyAuthenticationFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	p := newTestProxy(t, mockRM)
+
+	conn, result := dial(t, p, protocolVersion38, "password")
+	require.Equal(t, uint32(securityResultFailed), result)
+	assert.Equal(t, "authentication failed", readReasonFrom(t, conn))
+}
+
+func TestProxyBMCPasswordRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	p := newTestProxy(t, mockRM)
+
+	// The BMC password doesn't open the VNC console
+	conn, result := dial(t, p, protocolVersion38, "s3cr3t-password")
+	require.Equal(t, uint32(securityResultFailed), result)
+	assert.Equal(t, "authentication failed", readReasonFrom(t, conn))
+}
+
+func TestProxyNoVNCPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	p := newTestProxyWithCredentials(t, mockRM, credential.NewStaticProvider("admin", "s3cr3t-password"))
+
+	// Without a VNC password nobody is let in, not even with an empty password
+	conn, result := dial(t, p, protocolVersion38, "")
+	require.Equal(t, uint32(securityResultFailed), result)
+	assert.Equal(t, "authentication unavailable", readReasonFrom(t, conn))
+}
+
+func TestProxyConsoleUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	mockRM.EXPECT().VNC().Return(nil, errors.New("vmi not running"))
+	p := newTestProxy(t, mockRM)
+
+	conn, result := dial(t, p, protocolVersion38, "vncs3cr3")
+	require.Equal(t, uint32(securityResultFailed), result)
+	assert.Equal(t, "VNC console unavailable", readReasonFrom(t, conn))
+}
+
+func TestProxyConsoleInUse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	console, _ := fakeConsole(t)
+	mockRM.EXPECT().VNC().Return(console, nil)
+	p := newTestProxy(t, mockRM)
+
+	conn, result := dial(t, p, protocolVersion38, "vncs3cr3")
+	require.Equal(t, uint32(securityResultOK), result)
+
+	// A second client is turned away while the first one holds the console
+	other, result := dial(t, p, protocolVersion38, "vncs3cr3")
+	require.Equal(t, uint32(securityResultFailed), result)
+	assert.Equal(t, "VNC console in use", readReasonFrom(t, other))
+
+	// The console is available again once the first client disconnects
+	require.NoError(t, conn.Close())
+	console, _ = fakeConsole(t)
+	mockRM.EXPECT().VNC().Return(console, nil)
+	require.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return !p.inSession
+	}, 5*time.Second, 10*time.Millisecond)
+	_, result = dial(t, p, protocolVersion38, "vncs3cr3")
+	assert.Equal(t, uint32(securityResultOK), result)
+}
+
+func TestProxyHandshakeLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRM := resourcemanager.NewMockResourceManager(ctrl)
+	p := newTestProxy(t, mockRM)
+
+	connect := func() (net.Conn, error) {
+		conn, err := net.Dial("tcp", p.localAddr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+		b := make([]byte, protocolVersionSize)
+		_, err = io.ReadFull(conn, b)
+		return conn, err
+	}
+
+	// Clients stalling in the handshake take up all the slots
+	stalled := make([]net.Conn, 0, maxHandshakes)
+	for range maxHandshakes {
+		conn, err := connect()
+		require.NoError(t, err)
+		stalled = append(stalled, conn)
+	}
+
+	_, err := connect()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// A slot is freed once a stalled client goes away
+	require.NoError(t, stalled[0].Close())
+	require.Eventually(t, func() bool {
+		_, err := connect()
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestVNCAuthResponse(t *testing.T) {
+	challenge := []byte("0123456789abcdef")
+
+	// DES with the bit-reversed password as the key
+	response, err := vncAuthResponse("password", challenge)
+	require.NoError(t, err)
+	expected, _ := hex.DecodeString("5645abeb5f1e6475e8feb11beb66ea19")
+	assert.Equal(t, expected, response)
+
+	// The password is truncated to 8 characters
+	truncated, err := vncAuthResponse("password-suffix", challenge)
+	require.NoError(t, err)
+	assert.Equal(t, response, truncated)
+
+	other, err := vncAuthResponse("passwore", challenge)
+	require.NoError(t, err)
+	assert.NotEqual(t, response, other)
+}
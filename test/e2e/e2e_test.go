@@ -14,6 +14,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	virtualmachinev1 "kubevirt.io/kubevirtbmc/api/v1alpha1"
+	ctlvirtualmachinebmc "kubevirt.io/kubevirtbmc/internal/controller/virtualmachinebmc"
 )
 
 const (
@@ -95,7 +96,7 @@ var _ = Describe("KubeVirtBMC controller manager", Ordered, func() {
 
 		It("should create a VirtualMachineBMC", func() {
 			vmBMCLookupKey := types.NamespacedName{
-				Name:      strings.Join([]string{vm.Namespace, vm.Name}, "-"),
+				Name:      ctlvirtualmachinebmc.VirtualMachineBMCName(vm.Namespace, vm.Name),
 				Namespace: kubeVirtBMCNamespace,
 			}
 			createdVMBMC = &virtualmachinev1.VirtualMachineBMC{}
@@ -106,19 +107,23 @@ var _ = Describe("KubeVirtBMC controller manager", Ordered, func() {
 		})
 
 		It("should create a agent Pod", func() {
-			agentPodLookupKey := types.NamespacedName{
-				Name:      strings.Join([]string{createdVMBMC.Name, "virtbmc"}, "-"),
-				Namespace: kubeVirtBMCNamespace,
+			sets := labels.Set{
+				ctlvirtualmachinebmc.VirtualMachineBMCNameLabel: createdVMBMC.Name,
 			}
-			pod := &corev1.Pod{}
 			Eventually(func() bool {
-				err := k8sClient.Get(context.TODO(), agentPodLookupKey, pod)
+				var podList corev1.PodList
+				err := k8sClient.List(context.TODO(), &podList, &client.ListOptions{
+					Namespace:     kubeVirtBMCNamespace,
+					LabelSelector: labels.SelectorFromSet(sets),
+				})
 				if err != nil {
 					return false
 				}
-				for _, condition := range pod.Status.Conditions {
-					if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
-						return true
+				for _, pod := range podList.Items {
+					for _, condition := range pod.Status.Conditions {
+						if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+							return true
+						}
 					}
 				}
 				return false